@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/didil/goblero/pkg/blero"
+	"github.com/didil/goblero/pkg/client"
+)
+
+// commands are the blero subcommands, without one blero runs the server
+var commands = map[string]func(args []string) error{
+	"backup":  runBackup,
+	"restore": runRestore,
+	"export":  runExport,
+	"import":  runImport,
+}
+
+// target is the db of a subcommand, either a db directory or a running server
+type target struct {
+	dbPath    string
+	addr      string
+	keyFile   string
+	tokenFile string
+}
+
+func (t *target) register(fs *flag.FlagSet) {
+	fs.StringVar(&t.dbPath, "db", "", "badger db directory, the db must not be open by a server, use -addr instead")
+	fs.StringVar(&t.addr, "addr", "", `address of a running server, such as "localhost:7070" or "unix:/run/blero.sock"`)
+	fs.StringVar(&t.keyFile, "encryption-key-file", "", "file holding the encryption key of the db")
+	fs.StringVar(&t.tokenFile, "token-file", "", "file holding the bearer token of the server, defaults to the BLERO_TOKEN env var")
+}
+
+func (t *target) validate() error {
+	if (t.dbPath == "") == (t.addr == "") {
+		return errors.New("Either -db or -addr is required")
+	}
+	return nil
+}
+
+// options returns the options of the db
+func (t *target) options() (blero.Options, error) {
+	opts := blero.DefaultOptions(t.dbPath)
+	opts.Logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	if t.keyFile != "" {
+		var err error
+		opts.EncryptionKey, err = os.ReadFile(t.keyFile)
+		if err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
+
+// client returns a client of the server, sending the bearer token if any
+func (t *target) client() (*client.Client, error) {
+	token, err := readToken(t.tokenFile)
+	if err != nil {
+		return nil, err
+	}
+	return client.New(t.addr).WithToken(token), nil
+}
+
+// open opens and starts the Blero db
+func (t *target) open() (*blero.Blero, error) {
+	opts, err := t.options()
+	if err != nil {
+		return nil, err
+	}
+	bl, err := blero.NewWithOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	err = bl.Start()
+	if err != nil {
+		return nil, err
+	}
+	return bl, nil
+}
+
+// createOutput opens the output file, or stdout for "-"
+func createOutput(path string) (io.WriteCloser, error) {
+	if path == "-" {
+		return os.Stdout, nil
+	}
+	return os.Create(path)
+}
+
+// openInput opens the input file, or stdin for "-"
+func openInput(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return os.Stdin, nil
+	}
+	return os.Open(path)
+}
+
+// runBackup writes a full or incremental backup of a live db
+//
+//	blero backup -addr localhost:7070 -o blero.bak
+//	blero backup -addr localhost:7070 -since 42 -o blero-42.bak
+func runBackup(args []string) error {
+	var t target
+	fs := flag.NewFlagSet("blero backup", flag.ContinueOnError)
+	t.register(fs)
+	out := fs.String("o", "-", `backup file, "-" for stdout`)
+	since := fs.Uint64("since", 0, "version of a previous backup, to only write the changes since that backup")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	err = t.validate()
+	if err != nil {
+		return err
+	}
+
+	// open the db first so that the output isn't created when it's locked
+	var bl *blero.Blero
+	var c *client.Client
+	if t.dbPath != "" {
+		bl, err = t.open()
+		if err != nil {
+			return err
+		}
+		defer bl.Stop()
+	} else {
+		c, err = t.client()
+		if err != nil {
+			return err
+		}
+	}
+
+	w, err := createOutput(*out)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	var version uint64
+	if bl != nil {
+		version, err = bl.Backup(w, *since)
+	} else {
+		version, err = c.Backup(context.Background(), w, *since)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Backup version %v, use -since %v for the next incremental backup\n", version, version)
+	return w.Close()
+}
+
+// runRestore restores a full backup and its incremental backups into a new db
+//
+//	blero restore -db db/ blero.bak blero-42.bak
+func runRestore(args []string) error {
+	var t target
+	fs := flag.NewFlagSet("blero restore", flag.ContinueOnError)
+	t.register(fs)
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if t.dbPath == "" || t.addr != "" {
+		return errors.New("-db is required, backups can't be restored by a running server")
+	}
+	if fs.NArg() == 0 {
+		return errors.New("Backup files are required, the full backup followed by the incremental backups")
+	}
+
+	var backups []io.Reader
+	for _, path := range fs.Args() {
+		r, err := openInput(path)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		backups = append(backups, r)
+	}
+
+	opts, err := t.options()
+	if err != nil {
+		return err
+	}
+	return blero.RestoreBackup(opts, backups...)
+}
+
+// runExport exports the jobs as JSON lines
+//
+//	blero export -addr localhost:7070 -o jobs.jsonl
+func runExport(args []string) error {
+	var t target
+	fs := flag.NewFlagSet("blero export", flag.ContinueOnError)
+	t.register(fs)
+	out := fs.String("o", "-", `export file, "-" for stdout`)
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	err = t.validate()
+	if err != nil {
+		return err
+	}
+
+	// open the db first so that the output isn't created when it's locked
+	var bl *blero.Blero
+	var c *client.Client
+	if t.dbPath != "" {
+		bl, err = t.open()
+		if err != nil {
+			return err
+		}
+		defer bl.Stop()
+	} else {
+		c, err = t.client()
+		if err != nil {
+			return err
+		}
+	}
+
+	w, err := createOutput(*out)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	var n int
+	if bl != nil {
+		n, err = bl.ExportJobs(w)
+	} else {
+		n, err = c.ExportJobs(context.Background(), w)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %v jobs\n", n)
+	return w.Close()
+}
+
+// runImport imports jobs exported by blero export
+//
+//	blero import -addr localhost:7070 -i jobs.jsonl
+func runImport(args []string) error {
+	var t target
+	fs := flag.NewFlagSet("blero import", flag.ContinueOnError)
+	t.register(fs)
+	in := fs.String("i", "-", `export file, "-" for stdin`)
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	err = t.validate()
+	if err != nil {
+		return err
+	}
+
+	r, err := openInput(*in)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	var n int
+	if t.addr != "" {
+		var c *client.Client
+		c, err = t.client()
+		if err != nil {
+			return err
+		}
+		n, err = c.ImportJobs(context.Background(), r)
+	} else {
+		var bl *blero.Blero
+		bl, err = t.open()
+		if err != nil {
+			return err
+		}
+		defer bl.Stop()
+		n, err = bl.ImportJobs(r)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Imported %v jobs\n", n)
+	return nil
+}
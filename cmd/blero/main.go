@@ -0,0 +1,155 @@
+// Command blero runs a Blero server exposing a Blero DB over an HTTP/JSON API
+//
+// Usage:
+//
+//	blero -db db/ -addr localhost:7070
+//	blero -db db/ -addr unix:/run/blero.sock
+//	BLERO_TOKEN=secret blero -db db/ -addr :7070
+//
+// The API is unauthenticated unless a bearer token is set with -token-file or BLERO_TOKEN,
+// so the server listens on localhost by default, clients send the token the same way.
+//
+// The backup, restore, export and import subcommands back up and move jobs,
+// from a running server with -addr or from a db which isn't open with -db:
+//
+//	blero backup -addr localhost:7070 -o blero.bak
+//	blero restore -db restored/ blero.bak
+//	blero export -addr localhost:7070 -o jobs.jsonl
+//	blero import -db other/ -i jobs.jsonl
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/didil/goblero/pkg/blero"
+	"github.com/didil/goblero/pkg/server"
+)
+
+func main() {
+	err := run(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	if len(args) > 0 {
+		if cmd, ok := commands[args[0]]; ok {
+			return cmd(args[1:])
+		}
+	}
+
+	defaults := blero.DefaultOptions("db/")
+
+	fs := flag.NewFlagSet("blero", flag.ContinueOnError)
+	dbPath := fs.String("db", defaults.DBPath, "badger db directory")
+	addr := fs.String("addr", "localhost:7070", `listen address, a TCP address or a Unix socket such as "unix:/run/blero.sock"`)
+	tokenFile := fs.String("token-file", "", "file holding the bearer token required by the API, defaults to the BLERO_TOKEN env var, the API is unauthenticated without one")
+	leaseTimeout := fs.Duration("lease-timeout", defaults.LeaseTimeout, "lease timeout of in-progress jobs, 0 disables leases")
+	retryMaxAttempts := fs.Int("retry-max-attempts", defaults.RetryPolicy.MaxAttempts, "max attempts of failed jobs and jobs whose lease expired, 0 is unlimited")
+	retryBackoff := fs.Duration("retry-backoff", defaults.RetryPolicy.Backoff, "delay before the first retry, it doubles on each retry")
+	retryMaxBackoff := fs.Duration("retry-max-backoff", defaults.RetryPolicy.MaxBackoff, "max delay between retries, 0 is uncapped")
+	retention := fs.Duration("retention", defaults.Retention, "retention of complete and failed jobs, 0 keeps them forever")
+	keyFile := fs.String("encryption-key-file", "", "file holding a 16, 24 or 32 bytes key enabling encryption at rest")
+	logLevel := fs.String("log-level", "info", "log level: debug, info, warn or error")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	var level slog.Level
+	err = level.UnmarshalText([]byte(*logLevel))
+	if err != nil {
+		return err
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+
+	opts := defaults
+	opts.DBPath = *dbPath
+	opts.LeaseTimeout = *leaseTimeout
+	opts.HeartbeatInterval = *leaseTimeout / 3
+	opts.ReapInterval = *leaseTimeout / 3
+	opts.RetryPolicy = blero.RetryPolicy{MaxAttempts: *retryMaxAttempts, Backoff: *retryBackoff, MaxBackoff: *retryMaxBackoff}
+	opts.Retention = *retention
+	opts.Logger = logger
+	if *keyFile != "" {
+		opts.EncryptionKey, err = os.ReadFile(*keyFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	token, err := readToken(*tokenFile)
+	if err != nil {
+		return err
+	}
+
+	bl, err := blero.NewWithOptions(opts)
+	if err != nil {
+		return err
+	}
+	err = bl.Start()
+	if err != nil {
+		return err
+	}
+	defer bl.Stop()
+
+	l, err := server.Listen(*addr)
+	if err != nil {
+		return err
+	}
+	handler := server.NewHandler(bl, logger)
+	if token != "" {
+		handler = server.RequireToken(token, handler)
+	} else {
+		logger.Warn("The API is unauthenticated, set -token-file or BLERO_TOKEN to require a bearer token")
+	}
+	srv := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errCh := make(chan error, 1)
+	go func() {
+		logger.Info("Listening", "addr", l.Addr().String())
+		errCh <- srv.Serve(l)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	logger.Info("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err = srv.Shutdown(shutdownCtx)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// readToken reads the bearer token from file, or from the BLERO_TOKEN env var without a file
+func readToken(file string) (string, error) {
+	if file == "" {
+		return os.Getenv("BLERO_TOKEN"), nil
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
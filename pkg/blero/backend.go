@@ -1,43 +1,130 @@
 package blero
 
-import "fmt"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
 
 // Blero struct
 type Blero struct {
+	opts       Options
 	dispatcher *dispatcher
 	queue      *queue
+	tracing    *tracing
 }
 
-// New creates new Blero Backend
+// New creates new Blero Backend with the default options
 func New(dbPath string) *Blero {
-	bl := &Blero{}
+	return newBlero(DefaultOptions(dbPath))
+}
+
+// NewWithOptions creates new Blero Backend, it returns an error if the options are invalid
+func NewWithOptions(opts Options) (*Blero, error) {
+	err := opts.validate()
+	if err != nil {
+		return nil, err
+	}
+	return newBlero(opts), nil
+}
+
+// NewWithBackend creates new Blero Backend storing jobs in the given storage Backend
+func NewWithBackend(backend Backend) *Blero {
+	opts := DefaultOptions("")
+	opts.Backend = backend
+	return newBlero(opts)
+}
+
+func newBlero(opts Options) *Blero {
+	// share a single logger
+	opts.Logger = opts.logger()
+	bl := &Blero{opts: opts}
+	bl.tracing = opts.tracing()
 	pStore := newProcessorsStore()
-	bl.dispatcher = newDispatcher(pStore)
-	bl.queue = newQueue(queueOpts{DBPath: dbPath})
+	bl.dispatcher = newDispatcher(pStore, opts.dispatcherOpts(bl.tracing))
+	bl.queue = newQueue(opts.queueOpts())
+	// signal that reaped jobs can be assigned again
+	bl.queue.requeued = bl.dispatcher.signalLoop
+	// signal that jobs enqueued with EnqueueJobTxn were committed
+	bl.queue.committed = bl.dispatcher.signalLoop
 	return bl
 }
 
 // Start Blero
 func (bl *Blero) Start() error {
-	fmt.Println("Starting Blero ...")
-	err := bl.queue.start()
+	// New doesn't return errors so the options are validated here too
+	err := bl.opts.validate()
+	if err != nil {
+		return err
+	}
+
+	bl.queue.opts.Logger.Info("Starting Blero")
+
+	err = bl.queue.start()
 	if err != nil {
 		return err
 	}
+	err = bl.dispatcher.loadPaused(bl.queue)
+	if err != nil {
+		bl.queue.stop()
+		return err
+	}
 	bl.dispatcher.startLoop(bl.queue)
 	return nil
 }
 
 // Stop Blero and Release resources
 func (bl *Blero) Stop() error {
-	fmt.Println("Stopping Blero ...")
+	bl.queue.opts.Logger.Info("Stopping Blero")
 	bl.dispatcher.stopLoop()
 	return bl.queue.stop()
 }
 
 // EnqueueJob enqueues a new Job and returns the job id
 func (bl *Blero) EnqueueJob(name string, data []byte) (uint64, error) {
-	jID, err := bl.queue.enqueueJob(name, data)
+	return bl.EnqueueJobContext(context.Background(), name, data)
+}
+
+// EnqueueJobContext enqueues a new Job and returns the job id
+// The span context of ctx is stored with the job so the processing span continues the trace
+func (bl *Blero) EnqueueJobContext(ctx context.Context, name string, data []byte) (uint64, error) {
+	return bl.EnqueueJobOptions(ctx, name, data, EnqueueOptions{})
+}
+
+// EnqueueOptions are the per job enqueue options
+type EnqueueOptions struct {
+	// Compression of the job data, CompressionDefault applies Options.Compression over Options.CompressionThreshold
+	Compression Compression
+	// Headers are stored with the job and visible to processors, jobs can be listed by header
+	// Header names cannot be empty, names and values cannot contain NUL bytes
+	Headers map[string]string
+	// Tags are stored with the job and visible to processors, jobs can be listed by tag
+	// Tags must be unique, non-empty and cannot contain NUL bytes
+	Tags []string
+	// Key is a unique ID of the job chosen by the caller, such as an idempotency key of the request enqueuing the job
+	// Enqueuing a job with the key of an existing job returns the ID of the existing job, until it's deleted or swept
+	// Keys are printable UTF-8 strings of up to 255 bytes which aren't numbers
+	Key string
+}
+
+// ErrInvalidEnqueueOptions is returned by EnqueueJobOptions when the options are invalid
+var ErrInvalidEnqueueOptions = errors.New("Invalid enqueue options")
+
+// validate checks the enqueue options
+func (opts EnqueueOptions) validate() error {
+	err := errors.Join(opts.Compression.validate(), validateHeadersTags(opts.Headers, opts.Tags), validateKey(opts.Key))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidEnqueueOptions, err)
+	}
+	return nil
+}
+
+// EnqueueJobOptions enqueues a new Job with per job options and returns the job id
+func (bl *Blero) EnqueueJobOptions(ctx context.Context, name string, data []byte, opts EnqueueOptions) (uint64, error) {
+	jID, err := bl.enqueue(ctx, name, data, opts, bl.queue.enqueueJob)
 	if err != nil {
 		return 0, err
 	}
@@ -48,6 +135,55 @@ func (bl *Blero) EnqueueJob(name string, data []byte) (uint64, error) {
 	return jID, nil
 }
 
+// enqueue builds a new Job from opts and stores it with insert in an enqueue span
+func (bl *Blero) enqueue(ctx context.Context, name string, data []byte, opts EnqueueOptions, insert func(j *Job) (uint64, error)) (uint64, error) {
+	err := opts.validate()
+	if err != nil {
+		return 0, err
+	}
+
+	j := &Job{Key: opts.Key, Name: name, Data: data, Headers: maps.Clone(opts.Headers), Tags: slices.Clone(opts.Tags)}
+	bl.queue.compressJob(j, opts.Compression)
+
+	_, span := bl.tracing.startEnqueue(ctx, j)
+	jID, err := insert(j)
+	span.SetAttributes(jobIDAttr(jID))
+	endSpan(span, err)
+	return jID, err
+}
+
+// SetRateLimit sets or replaces the rate limit of a job name
+// Jobs over their limit stay pending without blocking jobs with other names
+func (bl *Blero) SetRateLimit(name string, limit RateLimit) error {
+	err := limit.validate()
+	if err != nil {
+		return err
+	}
+	bl.dispatcher.setRateLimit(name, limit)
+	return nil
+}
+
+// RemoveRateLimit removes the rate limit of a job name
+func (bl *Blero) RemoveRateLimit(name string) {
+	bl.dispatcher.removeRateLimit(name)
+}
+
+// SetConcurrencyCap sets the max number of jobs with a given name running at once
+// Jobs over their cap stay pending without blocking jobs with other names
+func (bl *Blero) SetConcurrencyCap(name string, max int) error {
+	err := validateConcurrency(max)
+	if err != nil {
+		return err
+	}
+	bl.dispatcher.setConcurrencyCap(name, max)
+	return nil
+}
+
+// RemoveConcurrencyCap removes the concurrency cap of a job name
+func (bl *Blero) RemoveConcurrencyCap(name string) {
+	bl.dispatcher.removeConcurrencyCap(name)
+}
+
 // EnqueueJobs enqueues new Jobs
 /*func (bl *Blero) EnqueueJobs(names string) (uint64, error) {
 
@@ -63,8 +199,117 @@ func (bl *Blero) RegisterProcessorFunc(f func(j *Job) error) int {
 	return bl.dispatcher.registerProcessor(ProcessorFunc(f))
 }
 
-// UnregisterProcessor unregisters a processor
+// RegisterProcessorConcurrency registers a new processor running up to concurrency jobs at a time and returns the processor id
+func (bl *Blero) RegisterProcessorConcurrency(p Processor, concurrency int) (int, error) {
+	err := validateConcurrency(concurrency)
+	if err != nil {
+		return 0, err
+	}
+	return bl.dispatcher.registerProcessorSlots(p, concurrency), nil
+}
+
+// RegisterProcessorFuncConcurrency registers a new ProcessorFunc running up to concurrency jobs at a time and returns the processor id
+func (bl *Blero) RegisterProcessorFuncConcurrency(f func(j *Job) error, concurrency int) (int, error) {
+	return bl.RegisterProcessorConcurrency(ProcessorFunc(f), concurrency)
+}
+
+// SetProcessorConcurrency scales a processor up or down
+// When scaling down, running jobs are not cancelled but no new jobs are assigned until the processor is under its concurrency
+func (bl *Blero) SetProcessorConcurrency(pID int, concurrency int) error {
+	err := validateConcurrency(concurrency)
+	if err != nil {
+		return err
+	}
+	return bl.dispatcher.setProcessorSlots(pID, concurrency)
+}
+
+// UnregisterProcessor unregisters a processor and all its slots
 // No more jobs will be assigned but if will not cancel a job that already started processing
 func (bl *Blero) UnregisterProcessor(pID int) {
 	bl.dispatcher.unregisterProcessor(pID)
 }
+
+// GetJob fetches a job by ID and returns its status
+func (bl *Blero) GetJob(id uint64) (*Job, JobStatus, error) {
+	return bl.queue.getJob(id)
+}
+
+// ListJobs lists the jobs in a status in ID order
+func (bl *Blero) ListJobs(opts ListOptions) ([]*Job, error) {
+	return bl.queue.listJobs(opts)
+}
+
+// CountJobs returns the number of jobs per status
+func (bl *Blero) CountJobs() (map[JobStatus]int, error) {
+	return bl.queue.countJobs()
+}
+
+// DeleteJob deletes a job, jobs in progress cannot be deleted
+func (bl *Blero) DeleteJob(id uint64) error {
+	return bl.queue.deleteJob(id)
+}
+
+// RequeueJob moves a complete or failed job back to pending so it runs again
+// Its attempts are reset and the stack trace of a previous panic is cleared
+func (bl *Blero) RequeueJob(id uint64) error {
+	err := bl.queue.requeueJob(id)
+	if err != nil {
+		return err
+	}
+
+	// signal that a job is pending
+	bl.dispatcher.signalLoop()
+
+	return nil
+}
+
+// LeaseJobs leases up to max pending jobs which aren't paused to an external worker identified by owner
+// The worker extends the leases with ExtendLease and finishes the jobs with AckJob or NackJob
+// Rate limits and concurrency caps only apply to the registered processors
+func (bl *Blero) LeaseJobs(owner string, max int) ([]*Job, error) {
+	if owner == "" {
+		return nil, errors.New("Lease owner is required")
+	}
+	if max < 1 {
+		return nil, fmt.Errorf("Max must be at least 1, got %v", max)
+	}
+	return bl.dispatcher.leaseJobs(bl.queue, owner, max)
+}
+
+// ExtendLease extends the lease of a job attempt and returns the new expiry
+// It returns ErrLeaseLost if the lease expired and the job was reaped
+func (bl *Blero) ExtendLease(id uint64, attempt int) (time.Time, error) {
+	return bl.queue.extendLease(id, attempt)
+}
+
+// AckJob marks a leased job attempt complete
+func (bl *Blero) AckJob(id uint64, attempt int) error {
+	if attempt < 1 {
+		return fmt.Errorf("Attempt must be at least 1, got %v", attempt)
+	}
+	return bl.queue.finishLease(id, attempt, attemptResult{status: JobComplete})
+}
+
+// NackJob marks a leased job attempt failed, the job is retried according to the RetryPolicy
+func (bl *Blero) NackJob(id uint64, attempt int) error {
+	return bl.NackJobReason(id, attempt, "")
+}
+
+// NackJobReason marks a leased job attempt failed and records the reason in the job history
+func (bl *Blero) NackJobReason(id uint64, attempt int, reason string) error {
+	var err error
+	if reason != "" {
+		err = errors.New(reason)
+	}
+	return bl.NackJobError(id, attempt, err)
+}
+
+// NackJobError marks a leased job attempt failed and records the error in the job history
+// The job is retried like the jobs of local processors, according to the RetryPolicy and the Permanent, RetryAfter and Snooze errors
+// The stack trace of a *PanicError is kept on the job, see Job.PanicStack
+func (bl *Blero) NackJobError(id uint64, attempt int, err error) error {
+	if attempt < 1 {
+		return fmt.Errorf("Attempt must be at least 1, got %v", attempt)
+	}
+	return bl.queue.finishLease(id, attempt, bl.queue.failedAttempt(attempt, err, Transition{}))
+}
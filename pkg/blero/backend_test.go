@@ -57,4 +57,41 @@ func BenchmarkEnqueue(b *testing.B) {
 		}
 	})
 
+	b.Run("dequeueJobs", func(b *testing.B) {
+		b.StopTimer()
+		for n := 0; n < b.N; n++ {
+			_, err := bl.EnqueueJob(jobName, jobData)
+			if err != nil {
+				b.Error(err)
+			}
+		}
+		b.StartTimer()
+
+		// lease in batches of 100 jobs per transaction
+		for leased := 0; leased < b.N; {
+			jobs, err := bl.queue.dequeueJobs(100, localLeaseOwner, nil, nil)
+			if err != nil {
+				b.Error(err)
+			}
+			leased += len(jobs)
+		}
+	})
+}
+
+func TestBlero_NewWithBackend(t *testing.T) {
+	bl := NewWithBackend(NewMemoryBackend())
+	err := bl.Start()
+	assert.NoError(t, err)
+	defer bl.Stop()
+
+	ch := make(chan string)
+	bl.RegisterProcessorFunc(func(j *Job) error {
+		ch <- j.Name
+		return nil
+	})
+
+	_, err = bl.EnqueueJob("MyJob", nil)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "MyJob", <-ch)
 }
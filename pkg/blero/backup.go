@@ -0,0 +1,190 @@
+package blero
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"time"
+)
+
+// ErrBackupNotSupported is returned when backing up or restoring a db which isn't stored by the default badger backend
+var ErrBackupNotSupported = errors.New("Backup is only supported by the default badger backend")
+
+// ErrInvalidImport is returned by ImportJobs when a line isn't a valid exported job
+var ErrInvalidImport = errors.New("Invalid exported job")
+
+// invalidImportError is the error of an invalid exported job, it matches ErrInvalidImport and its cause
+type invalidImportError struct {
+	n   int
+	err error
+}
+
+func (e *invalidImportError) Error() string {
+	return fmt.Sprintf("Job %v: %v", e.n, e.err)
+}
+
+func (e *invalidImportError) Unwrap() []error {
+	return []error{ErrInvalidImport, e.err}
+}
+
+// restoreMaxPendingWrites is the max number of pending writes while loading a backup
+const restoreMaxPendingWrites = 256
+
+// Backup streams a backup of the live db to w without stopping Blero and returns the backup version
+// Only the changes since a previous backup version are written when since isn't 0, use 0 for a full backup
+// Backups are written in the badger backup format, see RestoreBackup
+// A shared BadgerDB is backed up by the application
+func (bl *Blero) Backup(w io.Writer, since uint64) (uint64, error) {
+	b, ok := bl.queue.badgerBackend()
+	if !ok || b.shared {
+		return 0, ErrBackupNotSupported
+	}
+	return b.db.Backup(w, since)
+}
+
+// RestoreBackup loads a full backup written by Blero.Backup, followed by its incremental backups in order, into the db at opts.DBPath
+// The db must not be open and must not hold jobs
+// opts.EncryptionKey is the key of the restored db, not the key of the backed up db
+func RestoreBackup(opts Options, backups ...io.Reader) error {
+	if opts.Backend != nil || opts.BadgerDB != nil {
+		return ErrBackupNotSupported
+	}
+	err := opts.validate()
+	if err != nil {
+		return err
+	}
+
+	b, err := openBadgerBackend(opts.queueOpts().badgerOptions())
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	err = newNamespacedBackend(b, opts.Namespace).View(func(tx Tx) error {
+		k, _, err := getFirstKVForPrefix(tx, []byte("q:"))
+		if err == nil && k != nil {
+			return fmt.Errorf("Cannot restore into %v, the db already holds jobs", opts.DBPath)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, r := range backups {
+		err = b.db.Load(r, restoreMaxPendingWrites)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportedJob is a line of a JSONL export
+type ExportedJob struct {
+	Status string `json:"status"`
+	Job    *Job   `json:"job"`
+}
+
+// exportJobs writes the jobs in all statuses to w, one JSON object per line, and returns the number of exported jobs
+// The jobs are read in a single transaction so the export is consistent
+func (q *queue) exportJobs(w io.Writer) (int, error) {
+	enc := json.NewEncoder(w)
+	n := 0
+	err := q.backend.View(func(tx Tx) error {
+		for _, s := range jobStatuses {
+			err := tx.Iterate([]byte(getQueueKeyPrefix(s)), nil, func(k, v []byte) (bool, error) {
+				j, err := decodeJob(v)
+				if err != nil {
+					return false, err
+				}
+				err = loadBlob(tx, j)
+				if err != nil {
+					return false, err
+				}
+
+				// the data is exported inline
+				if _, ok := j.Meta[blobMetaKey]; ok {
+					j.Meta = maps.Clone(j.Meta)
+					delete(j.Meta, blobMetaKey)
+				}
+				err = enc.Encode(ExportedJob{Status: s.String(), Job: j})
+				if err != nil {
+					return false, err
+				}
+				n++
+				return true, nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return n, err
+}
+
+// importJob stores an exported job with a new ID
+// In-progress jobs are imported as pending since their leases don't carry over
+func (q *queue) importJob(j *Job, status JobStatus) (uint64, error) {
+	if status == JobInProgress {
+		status = JobPending
+	}
+	j.LeaseOwner = ""
+	j.LeaseExpiresAt = time.Time{}
+	if j.StatusChangedAt.IsZero() {
+		j.StatusChangedAt = timeNow()
+	}
+	delete(j.Meta, blobMetaKey)
+	q.compressJob(j, CompressionDefault)
+	return q.insertJob(j, status)
+}
+
+// ExportJobs writes the jobs in all statuses, with their data and metadata, to w as JSON lines and returns the number of exported jobs
+// Blero keeps running during the export, see ImportJobs to import them in another db
+func (bl *Blero) ExportJobs(w io.Writer) (int, error) {
+	return bl.queue.exportJobs(w)
+}
+
+// ImportJobs imports the jobs written by ExportJobs and returns the number of imported jobs
+// Imported jobs get new IDs and keep their status, except in-progress jobs which are imported as pending
+// Jobs are imported one by one, the jobs before an invalid line stay imported, invalid lines return ErrInvalidImport
+func (bl *Blero) ImportJobs(r io.Reader) (int, error) {
+	dec := json.NewDecoder(r)
+	n := 0
+	for {
+		var ej ExportedJob
+		err := dec.Decode(&ej)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return n, &invalidImportError{n: n + 1, err: err}
+		}
+		status, err := ParseJobStatus(ej.Status)
+		if err != nil {
+			return n, &invalidImportError{n: n + 1, err: err}
+		}
+		if ej.Job == nil {
+			return n, &invalidImportError{n: n + 1, err: errors.New("job is required")}
+		}
+		err = errors.Join(validateHeadersTags(ej.Job.Headers, ej.Job.Tags), validateKey(ej.Job.Key))
+		if err != nil {
+			return n, &invalidImportError{n: n + 1, err: err}
+		}
+
+		_, err = bl.queue.importJob(ej.Job, status)
+		if err != nil {
+			return n, fmt.Errorf("Job %v: %w", n+1, err)
+		}
+		n++
+	}
+
+	// signal that jobs might be pending
+	if n > 0 {
+		bl.dispatcher.signalLoop()
+	}
+	return n, nil
+}
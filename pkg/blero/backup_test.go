@@ -0,0 +1,173 @@
+package blero
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newBadgerTestOptions(t *testing.T) Options {
+	opts := DefaultOptions(t.TempDir())
+	opts.Logger = slog.New(slog.DiscardHandler)
+	return opts
+}
+
+func TestBlero_BackupRestore(t *testing.T) {
+	opts := newBadgerTestOptions(t)
+	bl, err := NewWithOptions(opts)
+	assert.NoError(t, err)
+	assert.NoError(t, bl.Start())
+
+	id1, err := bl.EnqueueJob("TestJob", []byte("one"))
+	assert.NoError(t, err)
+	j, err := bl.queue.dequeueJob()
+	assert.NoError(t, err)
+	assert.NoError(t, bl.queue.markJobDone(j.ID, JobComplete))
+
+	var full bytes.Buffer
+	version, err := bl.Backup(&full, 0)
+	assert.NoError(t, err)
+	assert.NotZero(t, version)
+
+	// incremental backup
+	id2, err := bl.EnqueueJob("TestJob", []byte("two"))
+	assert.NoError(t, err)
+	var incremental bytes.Buffer
+	_, err = bl.Backup(&incremental, version)
+	assert.NoError(t, err)
+	assert.NoError(t, bl.Stop())
+
+	restoreOpts := newBadgerTestOptions(t)
+	assert.NoError(t, RestoreBackup(restoreOpts, &full, &incremental))
+
+	restored, err := NewWithOptions(restoreOpts)
+	assert.NoError(t, err)
+	assert.NoError(t, restored.Start())
+	defer restored.Stop()
+
+	j, status, err := restored.GetJob(id1)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, JobComplete, status)
+	assert.Equal(t, []byte("one"), j.Data)
+	j, status, err = restored.GetJob(id2)
+	assert.NoError(t, err)
+	assert.Equal(t, JobPending, status)
+	assert.Equal(t, []byte("two"), j.Data)
+
+	// the sequence is restored too
+	id3, err := restored.EnqueueJob("TestJob", nil)
+	assert.NoError(t, err)
+	assert.Greater(t, id3, id2)
+}
+
+func TestRestoreBackup_Errors(t *testing.T) {
+	bl := NewWithBackend(NewMemoryBackend())
+	assert.NoError(t, bl.Start())
+	defer bl.Stop()
+	_, err := bl.Backup(&bytes.Buffer{}, 0)
+	assert.Equal(t, ErrBackupNotSupported, err)
+
+	opts := DefaultOptions("")
+	opts.Backend = NewMemoryBackend()
+	assert.Equal(t, ErrBackupNotSupported, RestoreBackup(opts, &bytes.Buffer{}))
+
+	// the db must be empty
+	opts = newBadgerTestOptions(t)
+	full, err := NewWithOptions(opts)
+	assert.NoError(t, err)
+	assert.NoError(t, full.Start())
+	_, err = full.EnqueueJob("TestJob", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, full.Stop())
+	assert.EqualError(t, RestoreBackup(opts, &bytes.Buffer{}), "Cannot restore into "+opts.DBPath+", the db already holds jobs")
+}
+
+func TestBlero_ExportImportJobs(t *testing.T) {
+	opts := DefaultOptions("")
+	opts.Backend = NewMemoryBackend()
+	opts.BlobThreshold = 16
+	bl, err := NewWithOptions(opts)
+	assert.NoError(t, err)
+	assert.NoError(t, bl.Start())
+	defer bl.Stop()
+
+	large := bytes.Repeat([]byte("x"), 64)
+	_, err = bl.EnqueueJobOptions(t.Context(), "Large", large, EnqueueOptions{Compression: CompressionNone})
+	assert.NoError(t, err)
+	_, err = bl.EnqueueJob("Small", []byte("small"))
+	assert.NoError(t, err)
+	_, err = bl.EnqueueJob("Done", nil)
+	assert.NoError(t, err)
+	leased, err := bl.LeaseJobs("worker", 3)
+	assert.NoError(t, err)
+	assert.NoError(t, bl.AckJob(leased[2].ID, 1))
+
+	var export bytes.Buffer
+	n, err := bl.ExportJobs(&export)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, 3, strings.Count(export.String(), "\n"))
+	assert.NotContains(t, export.String(), blobMetaKey)
+
+	target := NewWithBackend(NewMemoryBackend())
+	assert.NoError(t, target.Start())
+	defer target.Stop()
+	_, err = target.EnqueueJob("Existing", nil)
+	assert.NoError(t, err)
+
+	n, err = target.ImportJobs(&export)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	// in-progress jobs are imported as pending with new IDs
+	pending, err := target.ListJobs(ListOptions{Status: JobPending})
+	assert.NoError(t, err)
+	assert.Len(t, pending, 3)
+	assert.Equal(t, "Existing", pending[0].Name)
+	assert.Equal(t, "Large", pending[1].Name)
+	assert.Equal(t, uint64(2), pending[1].ID)
+	assert.Equal(t, large, pending[1].Data)
+	assert.Equal(t, 1, pending[1].Attempts)
+	assert.Empty(t, pending[1].LeaseOwner)
+	assert.Equal(t, "Small", pending[2].Name)
+	assert.Equal(t, []byte("small"), pending[2].Data)
+
+	complete, err := target.ListJobs(ListOptions{Status: JobComplete})
+	assert.NoError(t, err)
+	assert.Len(t, complete, 1)
+	assert.Equal(t, "Done", complete[0].Name)
+	assert.False(t, complete[0].FinishedAt.IsZero())
+	assert.Equal(t, leased[2].EnqueuedAt, complete[0].EnqueuedAt)
+}
+
+func TestBlero_ImportJobsErrors(t *testing.T) {
+	backend := &failingBackend{Backend: NewMemoryBackend()}
+	bl := NewWithBackend(backend)
+	assert.NoError(t, bl.Start())
+	defer bl.Stop()
+
+	n, err := bl.ImportJobs(strings.NewReader(`{"status":"pending","job":{"Name":"TestJob"}}` + "\n" + `{"status":"Unknown","job":{}}`))
+	assert.EqualError(t, err, `Job 2: Unknown job status "Unknown"`)
+	assert.ErrorIs(t, err, ErrInvalidImport)
+	assert.Equal(t, 1, n)
+
+	_, err = bl.ImportJobs(strings.NewReader(`{"status":"pending"}`))
+	assert.EqualError(t, err, "Job 1: job is required")
+
+	_, err = bl.ImportJobs(strings.NewReader(`{`))
+	assert.EqualError(t, err, "Job 1: unexpected EOF")
+	assert.ErrorIs(t, err, ErrInvalidImport)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	// storage errors aren't invalid imports
+	backend.fail.Store(true)
+	_, err = bl.ImportJobs(strings.NewReader(`{"status":"pending","job":{"Name":"TestJob"}}`))
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrInvalidImport)
+}
@@ -0,0 +1,189 @@
+package blero
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// blobMetaKey is the job meta key holding the number of blob chunks of jobs whose data is stored as a blob
+const blobMetaKey = "blero.blob"
+
+// blobPrefix is the prefix of the blob chunk keys
+const blobPrefix = "b:"
+
+func getBlobKeyPrefix(jID uint64) string {
+	return blobPrefix + jIDString(jID) + ":"
+}
+
+// parseBlobKey returns the job ID of a blob chunk key
+func parseBlobKey(k []byte) (uint64, error) {
+	s := strings.TrimPrefix(string(k), blobPrefix)
+	id, _, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, fmt.Errorf("Invalid blob key %q", k)
+	}
+	jID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid blob key %q", k)
+	}
+	return jID, nil
+}
+
+func getBlobChunkKey(jID uint64, chunk int) string {
+	return fmt.Sprintf("%v%06d", getBlobKeyPrefix(jID), chunk)
+}
+
+// blobChunks returns the number of blob chunks of the job data, 0 when the data is stored in the job record
+func (j *Job) blobChunks() int {
+	v, ok := j.Meta[blobMetaKey]
+	if !ok {
+		return 0
+	}
+	n, _ := strconv.Atoi(v)
+	return n
+}
+
+// storedData returns the data as written to the db, compressed if the job is compressed
+func (j *Job) storedData() []byte {
+	if j.isCompressed() {
+		return j.compressed
+	}
+	return j.Data
+}
+
+// storeBlob writes the data of a new job over BlobThreshold to the blob key space, one transaction per chunk
+// so that large payloads don't exceed the transaction size limits
+// The job record only references the blob, status transitions don't rewrite the data
+// Chunks left behind when the job record isn't written are deleted by deleteOrphanBlobs
+func (q *queue) storeBlob(j *Job) (bool, error) {
+	return q.writeBlob(j, func(k, chunk []byte) error {
+		return q.backend.Update(func(tx Tx) error {
+			return tx.Set(k, chunk)
+		})
+	})
+}
+
+// writeBlob writes the stored data of a job over BlobThreshold as chunks with set and records the number of chunks in its metadata
+func (q *queue) writeBlob(j *Job, set func(k, chunk []byte) error) (bool, error) {
+	data := j.storedData()
+	if q.opts.BlobThreshold <= 0 || len(data) < q.opts.BlobThreshold {
+		return false, nil
+	}
+
+	chunks := 0
+	for off := 0; off < len(data); off += q.opts.BlobChunkSize {
+		chunk := data[off:min(off+q.opts.BlobChunkSize, len(data))]
+		err := set([]byte(getBlobChunkKey(j.ID, chunks)), chunk)
+		if err != nil {
+			return false, err
+		}
+		chunks++
+	}
+
+	if j.Meta == nil {
+		j.Meta = make(map[string]string)
+	}
+	j.Meta[blobMetaKey] = strconv.Itoa(chunks)
+	return true, nil
+}
+
+// loadBlob reads the blob of a job into its data, it's a no-op for jobs whose data is stored in the record
+func loadBlob(tx Tx, j *Job) error {
+	chunks := j.blobChunks()
+	if chunks == 0 {
+		return nil
+	}
+
+	var data []byte
+	n := 0
+	err := tx.Iterate([]byte(getBlobKeyPrefix(j.ID)), nil, func(k, v []byte) (bool, error) {
+		data = append(data, v...)
+		n++
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	if n != chunks {
+		return fmt.Errorf("Job %v blob has %v chunks, expected %v", j.ID, n, chunks)
+	}
+
+	if !j.isCompressed() {
+		j.Data = data
+		return nil
+	}
+	j.compressed = data
+	j.Data, err = decompressData(j.compression, data)
+	if err != nil {
+		return fmt.Errorf("Cannot decompress job %v data: %w", j.ID, err)
+	}
+	return nil
+}
+
+// deleteBlob deletes the blob of a job, it's a no-op for jobs whose data is stored in the record
+func deleteBlob(tx Tx, j *Job) error {
+	for i := 0; i < j.blobChunks(); i++ {
+		err := tx.Delete([]byte(getBlobChunkKey(j.ID, i)))
+		if err != nil && err != ErrKeyNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// blobFitsRecordTx checks if the blob of a new job is a single chunk, which is written in the transaction of its record
+func (q *queue) blobFitsRecordTx(j *Job) bool {
+	return len(j.storedData()) <= q.opts.BlobChunkSize
+}
+
+// deleteOrphanBlobs deletes the blob chunks of jobs without a record, left behind when Blero stopped
+// between writing the chunks of a new job and its record
+func (q *queue) deleteOrphanBlobs() (int, error) {
+	var orphans [][]byte
+	err := q.backend.View(func(tx Tx) error {
+		var lastID uint64
+		orphan := false
+		return tx.Iterate([]byte(blobPrefix), nil, func(k, v []byte) (bool, error) {
+			id, err := parseBlobKey(k)
+			if err != nil {
+				return false, err
+			}
+			if id != lastID {
+				lastID = id
+				_, _, err := findJobKey(tx, id)
+				if err != nil && err != ErrKeyNotFound {
+					return false, err
+				}
+				orphan = err == ErrKeyNotFound
+			}
+			if orphan {
+				orphans = append(orphans, append([]byte(nil), k...))
+			}
+			return true, nil
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for len(orphans) > 0 {
+		batch := orphans[:min(len(orphans), migrationBatchSize)]
+		orphans = orphans[len(batch):]
+		err := q.backend.Update(func(tx Tx) error {
+			for _, k := range batch {
+				err := tx.Delete(k)
+				if err != nil && err != ErrKeyNotFound {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return total, err
+		}
+		total += len(batch)
+	}
+	return total, nil
+}
@@ -0,0 +1,269 @@
+package blero
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"log/slog"
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countBlobChunks counts the blob chunks stored for a job
+func countBlobChunks(t *testing.T, q *queue, id uint64) int {
+	n := 0
+	err := q.backend.View(func(tx Tx) error {
+		return tx.Iterate([]byte(getBlobKeyPrefix(id)), nil, func(k, v []byte) (bool, error) {
+			n++
+			return true, nil
+		})
+	})
+	assert.NoError(t, err)
+	return n
+}
+
+// storedRecordSize returns the size of the stored job record
+func storedRecordSize(t *testing.T, q *queue, status JobStatus, id uint64) int {
+	var size int
+	err := q.backend.View(func(tx Tx) error {
+		b, err := tx.Get([]byte(getJobKey(status, id)))
+		size = len(b)
+		return err
+	})
+	assert.NoError(t, err)
+	return size
+}
+
+func newBlobTestBlero(t *testing.T) *Blero {
+	opts := DefaultOptions("")
+	opts.Backend = NewMemoryBackend()
+	opts.BlobThreshold = 1024
+	opts.BlobChunkSize = 1000
+	bl, err := NewWithOptions(opts)
+	assert.NoError(t, err)
+	assert.NoError(t, bl.Start())
+	return bl
+}
+
+func TestBlero_BlobLifecycle(t *testing.T) {
+	bl := newBlobTestBlero(t)
+	defer bl.Stop()
+	q := bl.queue
+
+	// random data doesn't compress
+	data := make([]byte, 2500)
+	_, err := rand.Read(data)
+	assert.NoError(t, err)
+
+	id, err := bl.EnqueueJob("Large", data)
+	assert.NoError(t, err)
+	smallID, err := bl.EnqueueJob("Small", []byte("small"))
+	assert.NoError(t, err)
+
+	assert.Equal(t, 3, countBlobChunks(t, q, id))
+	assert.Equal(t, 0, countBlobChunks(t, q, smallID))
+	assert.Less(t, storedRecordSize(t, q, JobPending, id), 100)
+
+	j, status, err := bl.GetJob(id)
+	assert.NoError(t, err)
+	assert.Equal(t, JobPending, status)
+	assert.Equal(t, data, j.Data)
+	assert.Equal(t, "3", j.Meta[blobMetaKey])
+
+	jobs, err := bl.ListJobs(ListOptions{Status: JobPending})
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 2)
+	assert.Equal(t, data, jobs[0].Data)
+
+	// status transitions only move the record
+	leased, err := bl.LeaseJobs("worker", 1)
+	assert.NoError(t, err)
+	assert.Len(t, leased, 1)
+	assert.Equal(t, data, leased[0].Data)
+	assert.Less(t, storedRecordSize(t, q, JobInProgress, id), 100)
+
+	assert.NoError(t, bl.AckJob(id, 1))
+	assert.Less(t, storedRecordSize(t, q, JobComplete, id), 100)
+	j, _, err = bl.GetJob(id)
+	assert.NoError(t, err)
+	assert.Equal(t, data, j.Data)
+
+	// blobs are deleted with their jobs
+	n, err := q.sweepJobs(timeNow().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 0, countBlobChunks(t, q, id))
+}
+
+func TestBlero_BlobCompressed(t *testing.T) {
+	bl := newBlobTestBlero(t)
+	defer bl.Stop()
+	q := bl.queue
+
+	// the threshold applies to the compressed data
+	data := testPayload(64 << 10)
+	id, err := bl.EnqueueJobOptions(t.Context(), "Large", data, EnqueueOptions{Compression: CompressionSnappy})
+	assert.NoError(t, err)
+	_, compressed := compressData(CompressionSnappy, data)
+	assert.Equal(t, (len(compressed)+999)/1000, countBlobChunks(t, q, id))
+
+	j, err := q.dequeueJob()
+	assert.NoError(t, err)
+	assert.Equal(t, data, j.Data)
+
+	assert.NoError(t, q.markJobDone(id, JobFailed))
+	assert.NoError(t, bl.DeleteJob(id))
+	assert.Equal(t, 0, countBlobChunks(t, q, id))
+}
+
+func TestBlero_BlobMissingChunk(t *testing.T) {
+	bl := newBlobTestBlero(t)
+	defer bl.Stop()
+	q := bl.queue
+
+	data := make([]byte, 2500)
+	id, err := bl.EnqueueJobOptions(t.Context(), "Large", data, EnqueueOptions{Compression: CompressionNone})
+	assert.NoError(t, err)
+
+	err = q.backend.Update(func(tx Tx) error {
+		return tx.Delete([]byte(getBlobChunkKey(id, 1)))
+	})
+	assert.NoError(t, err)
+
+	_, _, err = bl.GetJob(id)
+	assert.EqualError(t, err, "Job 1 blob has 2 chunks, expected 3")
+}
+
+func TestOptions_ValidateBlob(t *testing.T) {
+	opts := DefaultOptions(testDBPath)
+	opts.BlobChunkSize = 0
+	assert.EqualError(t, opts.validate(), "BlobChunkSize must be greater than 0 when BlobThreshold is set, got 0")
+
+	opts.BlobThreshold = -1
+	assert.EqualError(t, opts.validate(), "BlobThreshold cannot be negative, got -1")
+}
+
+func BenchmarkMoveBlob(b *testing.B) {
+	data := testPayload(4 << 20)
+	for _, threshold := range []int{0, 64 << 10} {
+		name := "inline"
+		if threshold > 0 {
+			name = "blob"
+		}
+		b.Run(name, func(b *testing.B) {
+			opts := DefaultOptions("")
+			opts.Backend = NewMemoryBackend()
+			opts.BlobThreshold = threshold
+			bl, err := NewWithOptions(opts)
+			if err != nil {
+				b.Fatal(err)
+			}
+			err = bl.Start()
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer bl.Stop()
+
+			q := bl.queue
+			id, err := bl.EnqueueJobOptions(b.Context(), "MyJob", data, EnqueueOptions{Compression: CompressionNone})
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// only the status transitions are measured, dequeueJob returns the data
+				b.StopTimer()
+				_, err := q.dequeueJob()
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+
+				err = q.markJobDone(id, JobComplete)
+				if err != nil {
+					b.Fatal(err)
+				}
+				err = q.requeueJob(id)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestBlero_DeleteOrphanBlobs(t *testing.T) {
+	bl := newBlobTestBlero(t)
+	defer bl.Stop()
+	q := bl.queue
+
+	data := make([]byte, 2500)
+	_, err := rand.Read(data)
+	assert.NoError(t, err)
+	id, err := bl.EnqueueJob("Large", data)
+	assert.NoError(t, err)
+
+	// chunks written before a crash, without their record
+	err = q.backend.Update(func(tx Tx) error {
+		for i := 0; i < 2; i++ {
+			err := tx.Set([]byte(getBlobChunkKey(999, i)), []byte("chunk"))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	n, err := q.deleteOrphanBlobs()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 0, countBlobChunks(t, q, 999))
+	assert.Equal(t, 3, countBlobChunks(t, q, id))
+
+	j, _, err := bl.GetJob(id)
+	assert.NoError(t, err)
+	assert.Equal(t, data, j.Data)
+}
+
+// failAfterBackend fails the read-write transactions once left reaches 0
+type failAfterBackend struct {
+	Backend
+	left atomic.Int32
+}
+
+func (b *failAfterBackend) Update(fn func(tx Tx) error) error {
+	if b.left.Add(-1) < 0 {
+		return errors.New("disk full")
+	}
+	return b.Backend.Update(fn)
+}
+
+func TestBlero_BlobCleanupError(t *testing.T) {
+	var logs bytes.Buffer
+	backend := &failAfterBackend{Backend: NewMemoryBackend()}
+	backend.left.Store(math.MaxInt32)
+	opts := DefaultOptions("")
+	opts.Backend = backend
+	opts.BlobThreshold = 1024
+	opts.BlobChunkSize = 1000
+	opts.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+	bl, err := NewWithOptions(opts)
+	assert.NoError(t, err)
+	assert.NoError(t, bl.Start())
+	defer bl.Stop()
+
+	// the 3 chunks are stored, the record and the cleanup fail
+	backend.left.Store(3)
+	data := make([]byte, 2500)
+	_, err = rand.Read(data)
+	assert.NoError(t, err)
+	_, err = bl.EnqueueJob("Large", data)
+	assert.EqualError(t, err, "disk full")
+	assert.Contains(t, logs.String(), `msg="Cannot delete orphan blob" job_id=1 error="disk full"`)
+}
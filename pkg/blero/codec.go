@@ -0,0 +1,414 @@
+package blero
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Codec encodes jobs to and decodes jobs from their stored representation
+type Codec interface {
+	// ID identifies the codec in stored records, it must be unique and never change
+	ID() byte
+	// Marshal encodes a job
+	Marshal(j *Job) ([]byte, error)
+	// Unmarshal decodes a job
+	Unmarshal(b []byte) (*Job, error)
+}
+
+// Built-in codec IDs
+const (
+	gobCodecID    byte = 1
+	jsonCodecID   byte = 2
+	binaryCodecID byte = 3
+)
+
+// recordMagic marks records prefixed with a codec header
+// Legacy records are raw gob streams which never start with this byte
+const recordMagic byte = 0xB1
+
+var (
+	codecsL sync.RWMutex
+	codecs  = map[byte]Codec{
+		gobCodecID:    GobCodec{},
+		jsonCodecID:   JSONCodec{},
+		binaryCodecID: BinaryCodec{},
+	}
+)
+
+// RegisterCodec registers a custom codec so that records written with it can be decoded
+func RegisterCodec(c Codec) error {
+	codecsL.Lock()
+	defer codecsL.Unlock()
+
+	if c.ID() == 0 {
+		return errors.New("Codec ID 0 is reserved")
+	}
+	if _, ok := codecs[c.ID()]; ok {
+		return fmt.Errorf("Codec ID %v already registered", c.ID())
+	}
+
+	codecs[c.ID()] = c
+	return nil
+}
+
+// getCodec fetches a registered codec by ID
+func getCodec(id byte) (Codec, error) {
+	codecsL.RLock()
+	defer codecsL.RUnlock()
+
+	c, ok := codecs[id]
+	if !ok {
+		return nil, fmt.Errorf("Unknown codec ID %v", id)
+	}
+	return c, nil
+}
+
+// encodeJob encodes a job with codec c and prefixes the codec header
+// The data of compressed jobs is written compressed and flagged in the header, the data of blob jobs is left out
+func encodeJob(c Codec, j *Job) ([]byte, error) {
+	if !j.isCompressed() && j.blobChunks() == 0 {
+		b, err := c.Marshal(j)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{recordMagic, c.ID()}, b...), nil
+	}
+
+	cj := *j
+	cj.Data = j.storedData()
+	if j.blobChunks() > 0 {
+		cj.Data = nil
+	}
+	b, err := c.Marshal(&cj)
+	if err != nil {
+		return nil, err
+	}
+	if !j.isCompressed() {
+		return append([]byte{recordMagic, c.ID()}, b...), nil
+	}
+	return append([]byte{compressedRecordMagic, c.ID(), byte(j.compression)}, b...), nil
+}
+
+// decodeJob decodes a record written by any registered codec or a legacy gob record
+// Compressed data is decompressed, the compressed data is kept so moving the job doesn't compress it again
+// The data of blob jobs isn't in the record, see loadBlob
+func decodeJob(b []byte) (*Job, error) {
+	if !hasCodecHeader(b) {
+		return GobCodec{}.Unmarshal(b)
+	}
+
+	c, err := getCodec(b[1])
+	if err != nil {
+		return nil, err
+	}
+
+	if b[0] == recordMagic {
+		return c.Unmarshal(b[2:])
+	}
+
+	if len(b) < 3 {
+		return nil, errors.New("Truncated compressed record")
+	}
+	j, err := c.Unmarshal(b[3:])
+	if err != nil {
+		return nil, err
+	}
+	j.compression = Compression(b[2])
+	if j.blobChunks() > 0 {
+		// decompressed by loadBlob
+		return j, nil
+	}
+	j.compressed = j.Data
+	j.Data, err = decompressData(j.compression, j.compressed)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot decompress job %v data: %w", j.ID, err)
+	}
+	return j, nil
+}
+
+// hasCodecHeader checks if a record was written with a codec header
+func hasCodecHeader(b []byte) bool {
+	return len(b) >= 2 && (b[0] == recordMagic || b[0] == compressedRecordMagic)
+}
+
+// GobCodec encodes jobs using encoding/gob, it is the format used by legacy records
+type GobCodec struct{}
+
+// ID of the gob codec
+func (GobCodec) ID() byte { return gobCodecID }
+
+// Marshal encodes a job using gob
+func (GobCodec) Marshal(j *Job) ([]byte, error) {
+	var b bytes.Buffer
+	err := gob.NewEncoder(&b).Encode(j)
+	return b.Bytes(), err
+}
+
+// Unmarshal decodes a job using gob
+func (GobCodec) Unmarshal(b []byte) (*Job, error) {
+	var j *Job
+	err := gob.NewDecoder(bytes.NewBuffer(b)).Decode(&j)
+	if err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// JSONCodec encodes jobs as JSON, which keeps the records readable from other tools
+type JSONCodec struct{}
+
+// ID of the JSON codec
+func (JSONCodec) ID() byte { return jsonCodecID }
+
+// Marshal encodes a job as JSON
+func (JSONCodec) Marshal(j *Job) ([]byte, error) {
+	return json.Marshal(j)
+}
+
+// Unmarshal decodes a job from JSON
+func (JSONCodec) Unmarshal(b []byte) (*Job, error) {
+	j := &Job{}
+	err := json.Unmarshal(b, j)
+	if err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// BinaryCodec encodes jobs in a compact binary format
+// Each field is written as a tag byte followed by a uvarint length and the field bytes
+// Unknown tags are skipped when decoding so fields can be added without breaking older records
+type BinaryCodec struct{}
+
+// binary codec field tags
+const (
+	binTagID   byte = 1
+	binTagName byte = 2
+	binTagData byte = 3
+	// times are stored as unix nanoseconds, zero times are omitted
+	binTagEnqueuedAt byte = 4
+	binTagFinishedAt byte = 5
+	binTagAttempts   byte = 6
+	binTagMeta       byte = 7
+	binTagLeaseOwner byte = 8
+	binTagLeaseUntil byte = 9
+	binTagHeaders    byte = 10
+	binTagTags       byte = 11
+	binTagChangedAt  byte = 12
+	binTagKey        byte = 13
+	binTagRunAt      byte = 14
+)
+
+var errBinaryTruncated = errors.New("Binary codec: truncated record")
+
+// ID of the binary codec
+func (BinaryCodec) ID() byte { return binaryCodecID }
+
+// Marshal encodes a job in the binary format
+func (BinaryCodec) Marshal(j *Job) ([]byte, error) {
+	b := make([]byte, 0, 32+len(j.Name)+len(j.Data))
+	b = appendBinaryUvarint(b, binTagID, j.ID)
+	b = appendBinaryField(b, binTagName, []byte(j.Name))
+	b = appendBinaryField(b, binTagData, j.Data)
+	b = appendBinaryTime(b, binTagEnqueuedAt, j.EnqueuedAt)
+	b = appendBinaryTime(b, binTagFinishedAt, j.FinishedAt)
+	if j.Attempts > 0 {
+		b = appendBinaryUvarint(b, binTagAttempts, uint64(j.Attempts))
+	}
+	if len(j.Meta) > 0 {
+		b = appendBinaryField(b, binTagMeta, appendBinaryStringMap(nil, j.Meta))
+	}
+	if j.LeaseOwner != "" {
+		b = appendBinaryField(b, binTagLeaseOwner, []byte(j.LeaseOwner))
+	}
+	b = appendBinaryTime(b, binTagLeaseUntil, j.LeaseExpiresAt)
+	if len(j.Headers) > 0 {
+		b = appendBinaryField(b, binTagHeaders, appendBinaryStringMap(nil, j.Headers))
+	}
+	if len(j.Tags) > 0 {
+		b = appendBinaryField(b, binTagTags, appendBinaryStringList(nil, j.Tags))
+	}
+	b = appendBinaryTime(b, binTagChangedAt, j.StatusChangedAt)
+	if j.Key != "" {
+		b = appendBinaryField(b, binTagKey, []byte(j.Key))
+	}
+	b = appendBinaryTime(b, binTagRunAt, j.RunAt)
+	return b, nil
+}
+
+// Unmarshal decodes a job from the binary format
+func (BinaryCodec) Unmarshal(b []byte) (*Job, error) {
+	j := &Job{}
+	var err error
+	for len(b) > 0 {
+		tag := b[0]
+		l, n := binary.Uvarint(b[1:])
+		if n <= 0 || uint64(len(b)-1-n) < l {
+			return nil, errBinaryTruncated
+		}
+		v := b[1+n : 1+n+int(l)]
+		b = b[1+n+int(l):]
+
+		switch tag {
+		case binTagID:
+			j.ID, err = readBinaryUvarint(v)
+		case binTagName:
+			j.Name = string(v)
+		case binTagData:
+			j.Data = append([]byte(nil), v...)
+		case binTagEnqueuedAt:
+			j.EnqueuedAt, err = readBinaryTime(v)
+		case binTagFinishedAt:
+			j.FinishedAt, err = readBinaryTime(v)
+		case binTagAttempts:
+			var attempts uint64
+			attempts, err = readBinaryUvarint(v)
+			j.Attempts = int(attempts)
+		case binTagMeta:
+			j.Meta, err = readBinaryStringMap(v)
+		case binTagLeaseOwner:
+			j.LeaseOwner = string(v)
+		case binTagLeaseUntil:
+			j.LeaseExpiresAt, err = readBinaryTime(v)
+		case binTagHeaders:
+			j.Headers, err = readBinaryStringMap(v)
+		case binTagTags:
+			j.Tags, err = readBinaryStringList(v)
+		case binTagChangedAt:
+			j.StatusChangedAt, err = readBinaryTime(v)
+		case binTagKey:
+			j.Key = string(v)
+		case binTagRunAt:
+			j.RunAt, err = readBinaryTime(v)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return j, nil
+}
+
+func appendBinaryField(b []byte, tag byte, v []byte) []byte {
+	b = append(b, tag)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendBinaryUvarint(b []byte, tag byte, x uint64) []byte {
+	return appendBinaryField(b, tag, binary.AppendUvarint(nil, x))
+}
+
+func readBinaryUvarint(v []byte) (uint64, error) {
+	x, n := binary.Uvarint(v)
+	if n <= 0 {
+		return 0, errBinaryTruncated
+	}
+	return x, nil
+}
+
+func appendBinaryTime(b []byte, tag byte, t time.Time) []byte {
+	if t.IsZero() {
+		return b
+	}
+	return appendBinaryField(b, tag, binary.AppendVarint(nil, t.UnixNano()))
+}
+
+func readBinaryTime(v []byte) (time.Time, error) {
+	ns, n := binary.Varint(v)
+	if n <= 0 {
+		return time.Time{}, errBinaryTruncated
+	}
+	return time.Unix(0, ns).UTC(), nil
+}
+
+// appendBinaryStringMap encodes a map as its uvarint length followed by the sorted length prefixed keys and values
+func appendBinaryStringMap(b []byte, m map[string]string) []byte {
+	keys := sortedKeys(m)
+	b = binary.AppendUvarint(b, uint64(len(keys)))
+	for _, k := range keys {
+		b = appendBinaryString(b, k)
+		b = appendBinaryString(b, m[k])
+	}
+	return b
+}
+
+func readBinaryStringMap(v []byte) (map[string]string, error) {
+	count, n := binary.Uvarint(v)
+	if n <= 0 {
+		return nil, errBinaryTruncated
+	}
+	v = v[n:]
+	// each entry takes at least 2 bytes, check the count before allocating
+	if count > uint64(len(v))/2 {
+		return nil, errBinaryTruncated
+	}
+
+	m := make(map[string]string, count)
+	for i := uint64(0); i < count; i++ {
+		var k, val string
+		var err error
+		k, v, err = readBinaryString(v)
+		if err != nil {
+			return nil, err
+		}
+		val, v, err = readBinaryString(v)
+		if err != nil {
+			return nil, err
+		}
+		m[k] = val
+	}
+	return m, nil
+}
+
+// appendBinaryStringList encodes a list as its uvarint length followed by the length prefixed strings
+func appendBinaryStringList(b []byte, l []string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(l)))
+	for _, s := range l {
+		b = appendBinaryString(b, s)
+	}
+	return b
+}
+
+func readBinaryStringList(v []byte) ([]string, error) {
+	count, n := binary.Uvarint(v)
+	if n <= 0 {
+		return nil, errBinaryTruncated
+	}
+	v = v[n:]
+	// each string takes at least 1 byte, check the count before allocating
+	if count > uint64(len(v)) {
+		return nil, errBinaryTruncated
+	}
+
+	l := make([]string, 0, count)
+	for i := uint64(0); i < count; i++ {
+		var s string
+		var err error
+		s, v, err = readBinaryString(v)
+		if err != nil {
+			return nil, err
+		}
+		l = append(l, s)
+	}
+	return l, nil
+}
+
+func appendBinaryString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// readBinaryString reads a length prefixed string and returns the remaining bytes
+func readBinaryString(v []byte) (string, []byte, error) {
+	l, n := binary.Uvarint(v)
+	if n <= 0 || uint64(len(v)-n) < l {
+		return "", nil, errBinaryTruncated
+	}
+	return string(v[n : n+int(l)]), v[n+int(l):], nil
+}
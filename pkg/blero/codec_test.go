@@ -0,0 +1,151 @@
+package blero
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCodecs_RoundTrip(t *testing.T) {
+	j := &Job{
+		ID:              42,
+		Key:             "order-42",
+		Name:            "TestJob",
+		Data:            []byte("TestJob Args"),
+		EnqueuedAt:      timeNow().Add(-time.Minute),
+		FinishedAt:      timeNow(),
+		StatusChangedAt: timeNow(),
+		Attempts:        2,
+		Meta:            map[string]string{"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", "empty": ""},
+		LeaseOwner:      "worker-1",
+		LeaseExpiresAt:  timeNow().Add(time.Minute),
+		Headers:         map[string]string{"tenant": "acme"},
+		Tags:            []string{"billing", "eu"},
+		RunAt:           timeNow().Add(time.Hour),
+	}
+
+	for _, c := range []Codec{GobCodec{}, JSONCodec{}, BinaryCodec{}} {
+		b, err := encodeJob(c, j)
+		assert.NoError(t, err)
+		assert.Equal(t, recordMagic, b[0])
+		assert.Equal(t, c.ID(), b[1])
+
+		decoded, err := decodeJob(b)
+		assert.NoError(t, err)
+		assert.Equal(t, j, decoded)
+	}
+}
+
+func TestCodecs_DecodeLegacyGob(t *testing.T) {
+	j := &Job{ID: 42, Name: "TestJob", Data: []byte("TestJob Args")}
+
+	b, err := GobCodec{}.Marshal(j)
+	assert.NoError(t, err)
+
+	decoded, err := decodeJob(b)
+	assert.NoError(t, err)
+	assert.Equal(t, j, decoded)
+}
+
+func TestCodecs_DecodeUnknownCodec(t *testing.T) {
+	_, err := decodeJob([]byte{recordMagic, 200, 1, 2})
+	assert.EqualError(t, err, "Unknown codec ID 200")
+}
+
+func TestBinaryCodec_Truncated(t *testing.T) {
+	b, err := BinaryCodec{}.Marshal(&Job{ID: 1, Name: "TestJob", Data: []byte("TestJob Args")})
+	assert.NoError(t, err)
+
+	_, err = BinaryCodec{}.Unmarshal(b[:len(b)-1])
+	assert.EqualError(t, err, "Binary codec: truncated record")
+}
+
+func TestBinaryCodec_CorruptCounts(t *testing.T) {
+	// a huge count isn't allocated
+	huge := binary.AppendUvarint(nil, math.MaxUint64)
+	_, err := readBinaryStringList(append(huge, 0))
+	assert.Equal(t, errBinaryTruncated, err)
+	_, err = readBinaryStringMap(append(huge, 0, 0))
+	assert.Equal(t, errBinaryTruncated, err)
+
+	b, err := BinaryCodec{}.Marshal(&Job{ID: 1, Name: "TestJob"})
+	assert.NoError(t, err)
+	b = appendBinaryField(b, binTagTags, append(binary.AppendUvarint(nil, 1<<40), 0))
+	_, err = BinaryCodec{}.Unmarshal(b)
+	assert.EqualError(t, err, "Binary codec: truncated record")
+
+	l, err := readBinaryStringList(appendBinaryStringList(nil, []string{"", ""}))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"", ""}, l)
+	m, err := readBinaryStringMap(appendBinaryStringMap(nil, map[string]string{"": ""}))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"": ""}, m)
+}
+
+func TestBinaryCodec_SkipsUnknownTags(t *testing.T) {
+	b, err := BinaryCodec{}.Marshal(&Job{ID: 1, Name: "TestJob"})
+	assert.NoError(t, err)
+
+	b = appendBinaryField(b, 250, []byte("future field"))
+	j, err := BinaryCodec{}.Unmarshal(b)
+	assert.NoError(t, err)
+	assert.Equal(t, &Job{ID: 1, Name: "TestJob"}, j)
+}
+
+type testCodec struct {
+	JSONCodec
+}
+
+func (testCodec) ID() byte { return 100 }
+
+func TestRegisterCodec(t *testing.T) {
+	err := RegisterCodec(testCodec{})
+	assert.NoError(t, err)
+	defer func() {
+		codecsL.Lock()
+		delete(codecs, 100)
+		codecsL.Unlock()
+	}()
+
+	err = RegisterCodec(testCodec{})
+	assert.EqualError(t, err, "Codec ID 100 already registered")
+
+	b, err := encodeJob(testCodec{}, &Job{ID: 1, Name: "TestJob"})
+	assert.NoError(t, err)
+	j, err := decodeJob(b)
+	assert.NoError(t, err)
+	assert.Equal(t, "TestJob", j.Name)
+}
+
+func TestBlero_MixedCodecs(t *testing.T) {
+	bl := New(testDBPath)
+	err := bl.Start()
+	assert.NoError(t, err)
+
+	// stop gracefully
+	defer deleteDBFolder(testDBPath)
+	defer bl.Stop()
+
+	q := bl.queue
+
+	q.opts.Codec = JSONCodec{}
+	j1ID, err := bl.EnqueueJob("JSONJob", nil)
+	assert.NoError(t, err)
+
+	q.opts.Codec = BinaryCodec{}
+	j2ID, err := bl.EnqueueJob("BinaryJob", nil)
+	assert.NoError(t, err)
+
+	j, err := q.dequeueJob()
+	assert.NoError(t, err)
+	assert.Equal(t, j1ID, j.ID)
+	assert.Equal(t, "JSONJob", j.Name)
+
+	j, err = q.dequeueJob()
+	assert.NoError(t, err)
+	assert.Equal(t, j2ID, j.ID)
+	assert.Equal(t, "BinaryJob", j.Name)
+}
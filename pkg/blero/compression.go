@@ -0,0 +1,133 @@
+package blero
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is a job data compression algorithm
+type Compression byte
+
+const (
+	// CompressionDefault compresses the data with Options.Compression when it's over Options.CompressionThreshold
+	CompressionDefault Compression = iota
+	// CompressionNone stores the data verbatim
+	CompressionNone
+	// CompressionSnappy compresses the data with snappy, faster but larger than zstd
+	CompressionSnappy
+	// CompressionZstd compresses the data with zstd
+	CompressionZstd
+)
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionDefault:
+		return "default"
+	case CompressionNone:
+		return "none"
+	case CompressionSnappy:
+		return "snappy"
+	case CompressionZstd:
+		return "zstd"
+	}
+	return fmt.Sprintf("Compression(%v)", byte(c))
+}
+
+// ParseCompression parses the name of a compression, as returned by Compression.String
+func ParseCompression(name string) (Compression, error) {
+	for c := CompressionDefault; c <= CompressionZstd; c++ {
+		if c.String() == name {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown compression %q", name)
+}
+
+// validate checks that the compression is a known algorithm
+func (c Compression) validate() error {
+	if c > CompressionZstd {
+		return fmt.Errorf("Unknown compression %v", c)
+	}
+	return nil
+}
+
+// compressedRecordMagic marks records whose job data is compressed
+// It is followed by the codec ID and the Compression, the codec payload holds the compressed data
+// Like recordMagic, legacy gob streams never start with this byte
+const compressedRecordMagic byte = 0xB2
+
+// the zstd encoder and decoder are safe for concurrent use with EncodeAll and DecodeAll
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+)
+
+func initZstd() {
+	zstdOnce.Do(func() {
+		zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+	})
+}
+
+// compressData compresses data, it returns CompressionNone and the data verbatim when compression doesn't make it smaller
+func compressData(c Compression, data []byte) (Compression, []byte) {
+	var b []byte
+	switch c {
+	case CompressionSnappy:
+		b = snappy.Encode(nil, data)
+	case CompressionZstd:
+		initZstd()
+		b = zstdEncoder.EncodeAll(data, make([]byte, 0, len(data)))
+	default:
+		return CompressionNone, data
+	}
+
+	if len(b) >= len(data) {
+		return CompressionNone, data
+	}
+	return c, b
+}
+
+// decompressData decompresses data compressed with c
+func decompressData(c Compression, data []byte) ([]byte, error) {
+	switch c {
+	case CompressionNone:
+		return data, nil
+	case CompressionSnappy:
+		return snappy.Decode(nil, data)
+	case CompressionZstd:
+		initZstd()
+		return zstdDecoder.DecodeAll(data, nil)
+	}
+	return nil, fmt.Errorf("Unknown compression %v", c)
+}
+
+// compressJob compresses the data of a new job according to the per job and default compression
+// The raw data stays in j.Data, the compressed data is kept aside and written by encodeJob
+func (q *queue) compressJob(j *Job, c Compression) {
+	if c == CompressionDefault {
+		if q.opts.CompressionThreshold <= 0 || len(j.Data) < q.opts.CompressionThreshold {
+			return
+		}
+		c = q.opts.Compression
+		if c == CompressionDefault {
+			c = CompressionZstd
+		}
+	}
+
+	c, b := compressData(c, j.Data)
+	if c == CompressionNone {
+		return
+	}
+	j.compression = c
+	j.compressed = b
+}
+
+// isCompressed checks if the job data is stored compressed
+func (j *Job) isCompressed() bool {
+	return j.compression != CompressionDefault && j.compression != CompressionNone
+}
@@ -0,0 +1,233 @@
+package blero
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testPayload returns a JSON document of about size bytes
+func testPayload(size int) []byte {
+	type item struct {
+		ID    int    `json:"id"`
+		Name  string `json:"name"`
+		Email string `json:"email"`
+		Tags  []string
+	}
+	var items []item
+	var b []byte
+	for i := 0; len(b) < size; i++ {
+		items = append(items, item{ID: i, Name: fmt.Sprintf("user %v", i), Email: fmt.Sprintf("user%v@example.com", i), Tags: []string{"a", "b"}})
+		if i%100 == 0 {
+			b, _ = json.Marshal(items)
+		}
+	}
+	return b[:size]
+}
+
+func TestCompression_RoundTrip(t *testing.T) {
+	data := testPayload(4096)
+	for _, c := range []Compression{CompressionSnappy, CompressionZstd} {
+		got, b := compressData(c, data)
+		assert.Equal(t, c, got)
+		assert.Less(t, len(b), len(data))
+
+		decompressed, err := decompressData(c, b)
+		assert.NoError(t, err)
+		assert.Equal(t, data, decompressed)
+	}
+}
+
+func TestCompression_Incompressible(t *testing.T) {
+	data := []byte("abc")
+	c, b := compressData(CompressionZstd, data)
+	assert.Equal(t, CompressionNone, c)
+	assert.Equal(t, data, b)
+}
+
+func TestParseCompression(t *testing.T) {
+	for c := CompressionDefault; c <= CompressionZstd; c++ {
+		parsed, err := ParseCompression(c.String())
+		assert.NoError(t, err)
+		assert.Equal(t, c, parsed)
+	}
+	_, err := ParseCompression("lz4")
+	assert.EqualError(t, err, `Unknown compression "lz4"`)
+}
+
+func TestCompression_Validate(t *testing.T) {
+	assert.NoError(t, CompressionZstd.validate())
+	assert.EqualError(t, Compression(9).validate(), "Unknown compression Compression(9)")
+
+	opts := DefaultOptions(testDBPath)
+	opts.Compression = 9
+	opts.CompressionThreshold = -1
+	assert.EqualError(t, opts.validate(), "Unknown compression Compression(9)\n"+
+		"CompressionThreshold cannot be negative, got -1")
+}
+
+func TestCodecs_RoundTripCompressed(t *testing.T) {
+	data := testPayload(4096)
+	for _, c := range []Codec{GobCodec{}, JSONCodec{}, BinaryCodec{}} {
+		j := &Job{ID: 42, Name: "TestJob", Data: data}
+		j.compression, j.compressed = compressData(CompressionSnappy, data)
+
+		b, err := encodeJob(c, j)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{compressedRecordMagic, c.ID(), byte(CompressionSnappy)}, b[:3])
+		assert.True(t, hasCodecHeader(b))
+		assert.Less(t, len(b), len(data))
+
+		decoded, err := decodeJob(b)
+		assert.NoError(t, err)
+		assert.Equal(t, data, decoded.Data)
+		assert.Equal(t, CompressionSnappy, decoded.compression)
+		assert.Equal(t, j.compressed, decoded.compressed)
+	}
+}
+
+func TestCodecs_DecodeCorruptCompressed(t *testing.T) {
+	b, err := BinaryCodec{}.Marshal(&Job{ID: 42, Name: "TestJob", Data: []byte("not zstd")})
+	assert.NoError(t, err)
+
+	_, err = decodeJob(append([]byte{compressedRecordMagic, binaryCodecID, byte(CompressionZstd)}, b...))
+	assert.ErrorContains(t, err, "Cannot decompress job 42 data")
+
+	_, err = decodeJob([]byte{compressedRecordMagic, binaryCodecID})
+	assert.EqualError(t, err, "Truncated compressed record")
+}
+
+func TestBlero_EnqueueCompressed(t *testing.T) {
+	opts := DefaultOptions("")
+	opts.Backend = NewMemoryBackend()
+	opts.CompressionThreshold = 1024
+	bl, err := NewWithOptions(opts)
+	assert.NoError(t, err)
+
+	err = bl.Start()
+	assert.NoError(t, err)
+	defer bl.Stop()
+
+	large := testPayload(4096)
+	small := testPayload(512)
+	ctx := context.Background()
+
+	largeID, err := bl.EnqueueJob("Large", large)
+	assert.NoError(t, err)
+	smallID, err := bl.EnqueueJob("Small", small)
+	assert.NoError(t, err)
+	forcedID, err := bl.EnqueueJobOptions(ctx, "Forced", small, EnqueueOptions{Compression: CompressionSnappy})
+	assert.NoError(t, err)
+	disabledID, err := bl.EnqueueJobOptions(ctx, "Disabled", large, EnqueueOptions{Compression: CompressionNone})
+	assert.NoError(t, err)
+
+	_, err = bl.EnqueueJobOptions(ctx, "Invalid", large, EnqueueOptions{Compression: 9})
+	assert.EqualError(t, err, "Invalid enqueue options: Unknown compression Compression(9)")
+
+	stored := func(id uint64) []byte {
+		var b []byte
+		err := bl.queue.backend.View(func(tx Tx) error {
+			var err error
+			b, err = tx.Get([]byte(getJobKey(JobPending, id)))
+			return err
+		})
+		assert.NoError(t, err)
+		return b
+	}
+	assert.Equal(t, []byte{compressedRecordMagic, binaryCodecID, byte(CompressionZstd)}, stored(largeID)[:3])
+	assert.Equal(t, recordMagic, stored(smallID)[0])
+	assert.Equal(t, []byte{compressedRecordMagic, binaryCodecID, byte(CompressionSnappy)}, stored(forcedID)[:3])
+	assert.Equal(t, recordMagic, stored(disabledID)[0])
+
+	// processors get the decompressed data
+	got := make(chan []byte, 4)
+	bl.RegisterProcessorFunc(func(j *Job) error {
+		got <- j.Data
+		return nil
+	})
+
+	var payloads [][]byte
+	for i := 0; i < 4; i++ {
+		select {
+		case b := <-got:
+			payloads = append(payloads, b)
+		case <-time.After(time.Second):
+			t.Fatal("jobs not processed")
+		}
+	}
+	assert.ElementsMatch(t, [][]byte{large, small, small, large}, payloads)
+
+	// the data stays compressed after status transitions
+	assert.Eventually(t, func() bool {
+		_, status, err := bl.GetJob(largeID)
+		return err == nil && status == JobComplete
+	}, time.Second, 5*time.Millisecond)
+	err = bl.queue.backend.View(func(tx Tx) error {
+		b, err := tx.Get([]byte(getJobKey(JobComplete, largeID)))
+		if err != nil {
+			return err
+		}
+		assert.Equal(t, compressedRecordMagic, b[0])
+		assert.Less(t, len(b), len(large))
+		return nil
+	})
+	assert.NoError(t, err)
+
+	j, _, err := bl.GetJob(largeID)
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(large, j.Data))
+}
+
+func BenchmarkCompression(b *testing.B) {
+	for _, size := range []int{1 << 10, 64 << 10, 1 << 20} {
+		data := testPayload(size)
+		for _, c := range []Compression{CompressionSnappy, CompressionZstd} {
+			_, compressed := compressData(c, data)
+			ratio := float64(len(compressed)) / float64(len(data))
+
+			b.Run(fmt.Sprintf("%v/%vKB/Compress", c, size>>10), func(b *testing.B) {
+				b.SetBytes(int64(size))
+				b.ReportMetric(ratio, "ratio")
+				for i := 0; i < b.N; i++ {
+					compressData(c, data)
+				}
+			})
+			b.Run(fmt.Sprintf("%v/%vKB/Decompress", c, size>>10), func(b *testing.B) {
+				b.SetBytes(int64(size))
+				b.ReportMetric(ratio, "ratio")
+				for i := 0; i < b.N; i++ {
+					decompressData(c, compressed)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkEnqueueCompressed(b *testing.B) {
+	data := testPayload(64 << 10)
+	for _, c := range []Compression{CompressionNone, CompressionSnappy, CompressionZstd} {
+		b.Run(c.String(), func(b *testing.B) {
+			bl := NewWithBackend(NewMemoryBackend())
+			err := bl.Start()
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer bl.Stop()
+
+			ctx := context.Background()
+			b.SetBytes(int64(len(data)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err := bl.EnqueueJobOptions(ctx, "MyJob", data, EnqueueOptions{Compression: c})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -1,32 +1,67 @@
 package blero
 
 import (
+	"errors"
 	"fmt"
-	"io"
-	"os"
+	"log/slog"
 	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// dispatcherOpts struct
+type dispatcherOpts struct {
+	// BatchSize is the max number of jobs leased per transaction
+	BatchSize int
+	// HeartbeatInterval is how often the leases of running jobs are extended
+	HeartbeatInterval time.Duration
+	Logger            *slog.Logger
+	Tracing           *tracing
+	// RateLimits per job name
+	RateLimits map[string]RateLimit
+	// ConcurrencyCaps is the max number of running jobs per job name
+	ConcurrencyCaps map[string]int
+	// PanicHandler is called when a processor panics
+	PanicHandler func(j *Job, err *PanicError)
+}
+
 // dispatcher struct
 type dispatcher struct {
+	opts      dispatcherOpts
 	dispatchL sync.Mutex
 	ch        chan int
 	quitCh    chan struct{}
 	pStore    *processorsStore
+	limiter   *rateLimiter
+	// caps and number of running jobs per job name
+	caps     map[string]int
+	inFlight map[string]int
+	// paused stops all jobs, pausedNames stops the jobs with these names
+	paused      bool
+	pausedNames map[string]bool
+	// wakeTimer signals the loop when rate limited jobs can be started
+	wakeTimer *time.Timer
+	wakeAt    time.Time
 }
 
 // newDispatcher creates new Dispatcher
-func newDispatcher(pStore *processorsStore) *dispatcher {
-	d := &dispatcher{}
-	d.ch = make(chan int, 100)
+func newDispatcher(pStore *processorsStore, opts dispatcherOpts) *dispatcher {
+	d := &dispatcher{opts: opts}
+	// a single pending signal is enough, the loop checks all free slots on each wake up
+	d.ch = make(chan int, 1)
 	d.quitCh = make(chan struct{})
 	d.pStore = pStore
+	d.limiter = newRateLimiter(opts.RateLimits)
+	d.caps = make(map[string]int)
+	for name, max := range opts.ConcurrencyCaps {
+		d.caps[name] = max
+	}
+	d.inFlight = make(map[string]int)
+	d.pausedNames = make(map[string]bool)
 	return d
 }
 
-// testable stderr
-var stdErr io.ReadWriter = os.Stderr
-
 // startLoop starts the dispatcher assignment loop
 func (d *dispatcher) startLoop(q *queue) {
 	go func() {
@@ -35,7 +70,7 @@ func (d *dispatcher) startLoop(q *queue) {
 			case <-d.ch:
 				err := d.assignJobs(q)
 				if err != nil {
-					fmt.Fprintf(stdErr, "Cannot assign jobs: %v", err)
+					d.opts.Logger.Error("Cannot assign jobs", "error", err)
 				}
 			case <-d.quitCh: // loop was stopped
 				return
@@ -45,20 +80,39 @@ func (d *dispatcher) startLoop(q *queue) {
 }
 
 // signalLoop signals to the dispatcher loop that an assignment check might need to run
+// Signals sent while one is already pending are coalesced, it never blocks
 func (d *dispatcher) signalLoop() {
-	go func() {
-		select {
-		case <-d.quitCh: // loop was stopped
-			return
-		case d.ch <- 1:
-			return
-		}
-	}()
+	select {
+	case d.ch <- 1:
+	default: // a signal is already pending
+	}
 }
 
 // stopLoop stops the dispatcher assignment loop
 func (d *dispatcher) stopLoop() {
 	close(d.quitCh)
+
+	d.dispatchL.Lock()
+	defer d.dispatchL.Unlock()
+	if d.wakeTimer != nil {
+		d.wakeTimer.Stop()
+	}
+}
+
+// wakeAfter signals the loop after a delay, unless an earlier signal is already scheduled
+// NOT THREAD SAFE !! only call from assignJobs
+func (d *dispatcher) wakeAfter(delay time.Duration) {
+	now := timeNow()
+	wakeAt := now.Add(delay)
+	if d.wakeAt.After(now) && !d.wakeAt.After(wakeAt) {
+		return
+	}
+
+	if d.wakeTimer != nil {
+		d.wakeTimer.Stop()
+	}
+	d.wakeAt = wakeAt
+	d.wakeTimer = time.AfterFunc(delay, d.signalLoop)
 }
 
 // registerProcessor registers a new processor
@@ -74,6 +128,34 @@ func (d *dispatcher) registerProcessor(p Processor) int {
 	return pID
 }
 
+// registerProcessorSlots registers a new processor running up to slots jobs concurrently
+func (d *dispatcher) registerProcessorSlots(p Processor, slots int) int {
+	d.dispatchL.Lock()
+	defer d.dispatchL.Unlock()
+
+	pID := d.pStore.registerProcessorSlots(p, slots)
+
+	// signal that the processor is now available
+	d.signalLoop()
+
+	return pID
+}
+
+// setProcessorSlots changes the number of slots of a processor
+func (d *dispatcher) setProcessorSlots(pID int, slots int) error {
+	d.dispatchL.Lock()
+	defer d.dispatchL.Unlock()
+
+	if !d.pStore.setSlots(pID, slots) {
+		return fmt.Errorf("Processor %v not found", pID)
+	}
+
+	// signal that slots might now be available
+	d.signalLoop()
+
+	return nil
+}
+
 // unregisterProcessor unregisters a processor
 // No more jobs will be assigned but if will not cancel a job that already started processing
 func (d *dispatcher) unregisterProcessor(pID int) {
@@ -88,75 +170,217 @@ func (d *dispatcher) assignJobs(q *queue) error {
 	d.dispatchL.Lock()
 	defer d.dispatchL.Unlock()
 
-	pIDs := d.pStore.getAvailableProcessorsIDs()
+	if d.paused {
+		return nil
+	}
 
-	for _, pID := range pIDs {
-		err := d.assignJob(q, pID)
+	for d.pStore.freeSlots() > 0 {
+		full, err := d.assignBatch(q)
 		if err != nil {
 			return err
 		}
+		// no more jobs can be assigned
+		if !full {
+			return d.wakeAtNextRunAt(q)
+		}
 	}
 
 	return nil
 }
 
-// assignJob assigns a pending job processor #pID and starts the run
+// wakeAtNextRunAt schedules a loop signal at the run time of the next job retried or snoozed
 // NOT THREAD SAFE !! only call from assignJobs
-func (d *dispatcher) assignJob(q *queue, pID int) error {
-	p := d.pStore.getProcessor(pID)
-	if p == nil {
-		return fmt.Errorf("Processor %v not found", pID)
+func (d *dispatcher) wakeAtNextRunAt(q *queue) error {
+	runAt, err := q.nextRunAt()
+	if err != nil || runAt.IsZero() {
+		return err
+	}
+	d.wakeAfter(max(runAt.Sub(timeNow()), 0))
+	return nil
+}
+
+// assignBatch leases a batch of pending jobs in a single transaction, assigns them to free processor slots and starts the runs
+// It returns true if the batch was full and more jobs might be pending
+// NOT THREAD SAFE !! only call from assignJobs
+func (d *dispatcher) assignBatch(q *queue) (bool, error) {
+	n := min(d.pStore.freeSlots(), d.opts.BatchSize)
+
+	// claim the slots before leasing so that leased jobs always have a processor
+	pIDs := make([]int, 0, n)
+	defer func() {
+		for _, pID := range pIDs {
+			d.pStore.pushFree(pID)
+		}
+	}()
+	for len(pIDs) < n {
+		pID, _ := d.pStore.popFree()
+		pIDs = append(pIDs, pID)
+		if d.pStore.getProcessor(pID) == nil {
+			return false, fmt.Errorf("Processor %v not found", pID)
+		}
 	}
 
-	j, err := q.dequeueJob()
+	// jobs leased in this batch count towards the concurrency caps
+	batch := make(map[string]int)
+	jobs, err := q.dequeueJobs(n, localLeaseOwner, pIDs, &dequeueFilter{
+		skipName: d.skipName,
+		allow:    func(j *Job) bool { return d.allowJob(j, batch) },
+	})
+	// the tokens are taken in the transaction, return those of the jobs which were not leased
+	// because the transaction failed or was retried
+	leased := make(map[string]int)
+	for _, j := range jobs {
+		leased[j.Name]++
+	}
+	for name, n := range batch {
+		if n > leased[name] {
+			d.limiter.giveBack(name, n-leased[name])
+		}
+	}
 	if err != nil {
-		return err
+		return false, err
 	}
-	// no jobs to assign
-	if j == nil {
-		return nil
+
+	for _, j := range jobs {
+		pID := pIDs[0]
+		pIDs = pIDs[1:]
+
+		d.pStore.setProcessing(pID, j.ID)
+		d.inFlight[j.Name]++
+
+		go d.runJob(q, pID, d.pStore.getProcessor(pID), j)
 	}
 
-	if d.pStore.isProcessorBusy(pID) {
-		return fmt.Errorf("Cannot assign job %v to Processor %v. Processor busy", j.ID, pID)
+	return len(jobs) == n, nil
+}
+
+// skipName checks if the jobs with a name can't start in the current batch, they are not read
+// Paused jobs are skipped until they are resumed
+// Jobs at their concurrency cap are skipped until a running job with the same name is done
+// NOT THREAD SAFE !! only call from assignJobs
+func (d *dispatcher) skipName(name string) bool {
+	if d.isPaused(name) {
+		return true
 	}
+	max, ok := d.caps[name]
+	return ok && d.inFlight[name] >= max
+}
 
-	d.pStore.setProcessing(pID, j.ID)
+// allowJob checks if a pending job can be started now, a rejected job skips the other jobs with the same name in the batch
+// Jobs over their concurrency cap are skipped until a running job with the same name is done
+// Jobs over their rate limit are skipped and the loop is woken up when a token is available
+// batch counts the jobs allowed per job name in the current batch
+// NOT THREAD SAFE !! only call from assignJobs
+func (d *dispatcher) allowJob(j *Job, batch map[string]int) bool {
+	if max, ok := d.caps[j.Name]; ok && d.inFlight[j.Name]+batch[j.Name] >= max {
+		return false
+	}
 
-	go d.runJob(q, pID, p, j)
+	ok, wait := d.limiter.take(j.Name)
+	if !ok {
+		d.wakeAfter(wait)
+		return false
+	}
 
-	return nil
+	batch[j.Name]++
+	return true
+}
+
+// setRateLimit sets the rate limit of a job name at runtime
+func (d *dispatcher) setRateLimit(name string, limit RateLimit) {
+	d.limiter.setLimit(name, limit)
+
+	// signal that more jobs might be allowed
+	d.signalLoop()
+}
+
+// removeRateLimit removes the rate limit of a job name at runtime
+func (d *dispatcher) removeRateLimit(name string) {
+	d.limiter.removeLimit(name)
+
+	// signal that more jobs might be allowed
+	d.signalLoop()
 }
 
 // unassignJob unmarks a job as assigned to #pID
-func (d *dispatcher) unassignJob(pID int) {
+func (d *dispatcher) unassignJob(pID int, j *Job) {
+	d.dispatchL.Lock()
+	defer d.dispatchL.Unlock()
+
+	d.pStore.unsetProcessing(pID, j.ID)
+	d.inFlight[j.Name]--
+	if d.inFlight[j.Name] <= 0 {
+		delete(d.inFlight, j.Name)
+	}
+}
+
+// setConcurrencyCap sets the max number of running jobs of a job name at runtime
+// Lowering a cap doesn't interrupt running jobs
+func (d *dispatcher) setConcurrencyCap(name string, max int) {
+	d.dispatchL.Lock()
+	defer d.dispatchL.Unlock()
+
+	d.caps[name] = max
+
+	// signal that more jobs might be allowed
+	d.signalLoop()
+}
+
+// removeConcurrencyCap removes the concurrency cap of a job name at runtime
+func (d *dispatcher) removeConcurrencyCap(name string) {
 	d.dispatchL.Lock()
 	defer d.dispatchL.Unlock()
 
-	d.pStore.unsetProcessing(pID)
+	delete(d.caps, name)
+
+	// signal that more jobs might be allowed
+	d.signalLoop()
 }
 
 // runJob runs a job on the corresponding processor and moves it to the right queue depending on results
 func (d *dispatcher) runJob(q *queue, pID int, p Processor, j *Job) {
-	defer d.processorDone(pID)
-	err := p.Run(j)
+	defer d.processorDone(pID, j)
+	logger := d.opts.Logger.With("job_id", j.ID, "job_name", j.Name, "processor_id", pID, "attempt", j.Attempts)
+
+	ctx, span := d.opts.Tracing.startProcess(j, attribute.Int("blero.processor.id", pID))
+	j.ctx = ctx
+
+	logger.Debug("Job started")
+	stopHeartbeat := d.startHeartbeat(q, j, logger)
+	err := RunProcessor(p, j)
+	stopHeartbeat()
+	endSpan(span, err)
 	if err != nil {
-		fmt.Printf("Processor: %v. Job %v failed with err: %v\n", pID, j.ID, err)
-		err := q.markJobDone(j.ID, jobFailed)
+		res := q.failedAttempt(j.Attempts, err, Transition{ProcessorID: pID})
+		var panicErr *PanicError
+		if errors.As(err, &panicErr) {
+			logger.Error("Job panicked", "error", err, "stack", res.panicStack)
+		} else if res.snooze {
+			logger.Debug("Job snoozed", "run_at", res.runAt)
+		} else if res.status == JobPending {
+			logger.Warn("Job failed", "error", err, "retry_at", res.runAt)
+		} else {
+			logger.Warn("Job failed", "error", err)
+		}
+		err := q.finishLease(j.ID, j.Attempts, res)
 		if err != nil {
-			fmt.Printf("markJobDone -> %v jobFailed failed: %v\n", j.ID, err)
+			logger.Error("Cannot mark job failed", "error", err)
+		}
+		if panicErr != nil && d.opts.PanicHandler != nil {
+			d.opts.PanicHandler(j, panicErr)
 		}
 		return
 	}
 
-	err = q.markJobDone(j.ID, jobComplete)
+	logger.Debug("Job complete")
+	err = q.finishLease(j.ID, j.Attempts, attemptResult{status: JobComplete, t: Transition{ProcessorID: pID}})
 	if err != nil {
-		fmt.Printf("markJobDone -> %v jobComplete failed: %v\n", j.ID, err)
+		logger.Error("Cannot mark job complete", "error", err)
 	}
 }
 
-func (d *dispatcher) processorDone(pID int) {
-	d.unassignJob(pID)
+func (d *dispatcher) processorDone(pID int, j *Job) {
+	d.unassignJob(pID, j)
 
 	// signal that the processor might now be available
 	d.signalLoop()
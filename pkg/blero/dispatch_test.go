@@ -2,14 +2,17 @@ package blero
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"log/slog"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
-	"github.com/dgraph-io/badger/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -125,7 +128,7 @@ func TestBlero_assignJobs(t *testing.T) {
 	p2.AssertNumberOfCalls(t, "Run", 1)
 	p3.AssertNumberOfCalls(t, "Run", 1)
 
-	err = q.db.View(func(txn *badger.Txn) error {
+	err = q.backend.View(func(txn Tx) error {
 		// check that job 1 is in the complete queue
 		_, err := txn.Get([]byte("q:complete:" + jIDString(j1ID)))
 		assert.NoError(t, err)
@@ -259,12 +262,25 @@ func (b *safeBuffer) Write(p []byte) (n int, err error) {
 	return b.Buffer.Write(p)
 }
 
+// newTestLogger returns a logger writing JSON lines without timestamps to w
+func newTestLogger(w io.Writer) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+}
+
 func Test_dispatcherAssignFails(t *testing.T) {
-	stdErr = new(safeBuffer)
+	buf := new(safeBuffer)
 	pStore := newProcessorsStore()
 	// introduce error by registering nil processor
 	pStore.registerProcessor(nil)
-	d := newDispatcher(pStore)
+	d := newDispatcher(pStore, dispatcherOpts{BatchSize: 100, Logger: newTestLogger(buf)})
 
 	d.startLoop(nil)
 
@@ -272,8 +288,357 @@ func Test_dispatcherAssignFails(t *testing.T) {
 	d.signalLoop()
 
 	time.Sleep(50 * time.Millisecond)
-	errText, err := ioutil.ReadAll(stdErr)
+	errText, err := ioutil.ReadAll(buf)
+	assert.NoError(t, err)
+
+	assert.Equal(t, `{"level":"ERROR","msg":"Cannot assign jobs","error":"Processor 1 not found"}`+"\n", string(errText))
+}
+
+func Test_dispatcherSignalsCoalesced(t *testing.T) {
+	d := newDispatcher(newProcessorsStore(), dispatcherOpts{BatchSize: 100, Logger: newTestLogger(new(safeBuffer))})
+
+	// the loop isn't running, signals don't block or start goroutines
+	n := runtime.NumGoroutine()
+	for i := 0; i < 1000; i++ {
+		d.signalLoop()
+	}
+	assert.Equal(t, 1, len(d.ch))
+	assert.True(t, runtime.NumGoroutine() <= n)
+}
+
+func Test_processorsStoreFreeList(t *testing.T) {
+	pStore := newProcessorsStore()
+	p1 := pStore.registerProcessorSlots(&recordingProcessor{}, 3)
+	assert.Equal(t, 3, pStore.freeSlots())
+
+	// take 2 slots of p1
+	for _, jID := range []uint64{1, 2} {
+		pID, ok := pStore.popFree()
+		assert.True(t, ok)
+		assert.Equal(t, p1, pID)
+		pStore.setProcessing(pID, jID)
+	}
+
+	p2 := pStore.registerProcessor(&recordingProcessor{})
+	assert.Equal(t, []int{p1, p2}, pStore.free)
+	assert.Equal(t, map[int]int{p1: 1, p2: 1}, pStore.freeCount)
+
+	// scaling down doesn't interrupt the running jobs and removes the idle slot
+	assert.True(t, pStore.setSlots(p1, 1))
+	assert.Equal(t, []int{p2}, pStore.free)
+	assert.False(t, pStore.setSlots(100, 1))
+	pStore.unsetProcessing(p1, 1)
+	assert.Equal(t, []int{p2}, pStore.free)
+	pStore.unsetProcessing(p1, 2)
+	assert.Equal(t, []int{p2, p1}, pStore.free)
+
+	// scaling up adds idle slots
+	assert.True(t, pStore.setSlots(p1, 2))
+	assert.Equal(t, []int{p2, p1, p1}, pStore.free)
+
+	pStore.unregisterProcessor(p1)
+	assert.Equal(t, []int{p2}, pStore.free)
+	assert.Equal(t, map[int]int{p2: 1}, pStore.freeCount)
+
+	pID, ok := pStore.popFree()
+	assert.True(t, ok)
+	assert.Equal(t, p2, pID)
+	_, ok = pStore.popFree()
+	assert.False(t, ok)
+}
+
+func TestBlero_JobFailureLogged(t *testing.T) {
+	buf := new(safeBuffer)
+	opts := DefaultOptions("")
+	opts.Backend = NewMemoryBackend()
+	opts.Logger = newTestLogger(buf)
+	bl, err := NewWithOptions(opts)
 	assert.NoError(t, err)
 
-	assert.Equal(t, "Cannot assign jobs: Processor 1 not found", string(errText))
+	err = bl.Start()
+	assert.NoError(t, err)
+	defer bl.Stop()
+
+	pID := bl.RegisterProcessorFunc(func(j *Job) error {
+		return errors.New("boom")
+	})
+	jID, err := bl.EnqueueJob("MyJob", nil)
+	assert.NoError(t, err)
+
+	// wait for the job to be processed
+	time.Sleep(50 * time.Millisecond)
+
+	logs, err := ioutil.ReadAll(buf)
+	assert.NoError(t, err)
+	assert.Contains(t, string(logs), fmt.Sprintf(`{"level":"WARN","msg":"Job failed","job_id":%v,"job_name":"MyJob","processor_id":%v,"attempt":1,"error":"boom"}`, jID, pID))
+}
+
+// blockingProcessor blocks jobs until released and tracks how many run concurrently
+type blockingProcessor struct {
+	m       sync.Mutex
+	running int
+	done    int
+	byName  map[string]int
+	release chan struct{}
+}
+
+func newBlockingProcessor() *blockingProcessor {
+	return &blockingProcessor{release: make(chan struct{}), byName: make(map[string]int)}
+}
+
+func (p *blockingProcessor) Run(j *Job) error {
+	p.m.Lock()
+	p.running++
+	p.byName[j.Name]++
+	p.m.Unlock()
+
+	<-p.release
+
+	p.m.Lock()
+	p.running--
+	p.byName[j.Name]--
+	p.done++
+	p.m.Unlock()
+	return nil
+}
+
+func (p *blockingProcessor) runningByName(name string) int {
+	p.m.Lock()
+	defer p.m.Unlock()
+	return p.byName[name]
+}
+
+func (p *blockingProcessor) counts() (int, int) {
+	p.m.Lock()
+	defer p.m.Unlock()
+	return p.running, p.done
+}
+
+func TestBlero_ProcessorConcurrency(t *testing.T) {
+	bl := NewWithBackend(NewMemoryBackend())
+	err := bl.Start()
+	assert.NoError(t, err)
+	defer bl.Stop()
+
+	for i := 0; i < 8; i++ {
+		_, err := bl.EnqueueJob("MyJob", nil)
+		assert.NoError(t, err)
+	}
+
+	p := newBlockingProcessor()
+	pID, err := bl.RegisterProcessorConcurrency(p, 3)
+	assert.NoError(t, err)
+	withDispatchLock(bl, func(pStore *processorsStore) {
+		assert.Len(t, pStore.processors, 1)
+	})
+
+	time.Sleep(50 * time.Millisecond)
+	running, _ := p.counts()
+	assert.Equal(t, 3, running)
+
+	// scale up
+	err = bl.SetProcessorConcurrency(pID, 5)
+	assert.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	running, _ = p.counts()
+	assert.Equal(t, 5, running)
+
+	// scale down, running jobs are not interrupted
+	err = bl.SetProcessorConcurrency(pID, 1)
+	assert.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	running, _ = p.counts()
+	assert.Equal(t, 5, running)
+
+	// finish the running jobs, a single new job starts
+	for i := 0; i < 5; i++ {
+		p.release <- struct{}{}
+	}
+	time.Sleep(50 * time.Millisecond)
+	running, done := p.counts()
+	assert.Equal(t, 1, running)
+	assert.Equal(t, 5, done)
+
+	// unregistered as one unit, the running job completes
+	bl.UnregisterProcessor(pID)
+	withDispatchLock(bl, func(pStore *processorsStore) {
+		assert.Len(t, pStore.processors, 0)
+		assert.Len(t, pStore.slots, 0)
+	})
+	p.release <- struct{}{}
+	time.Sleep(50 * time.Millisecond)
+	running, done = p.counts()
+	assert.Equal(t, 0, running)
+	assert.Equal(t, 6, done)
+	withDispatchLock(bl, func(pStore *processorsStore) {
+		assert.Len(t, pStore.processing, 0)
+	})
+}
+
+// withDispatchLock inspects the processors store while holding the dispatcher lock
+func withDispatchLock(bl *Blero, fn func(pStore *processorsStore)) {
+	bl.dispatcher.dispatchL.Lock()
+	defer bl.dispatcher.dispatchL.Unlock()
+	fn(bl.dispatcher.pStore)
+}
+
+func TestBlero_ProcessorConcurrencyErrors(t *testing.T) {
+	bl := NewWithBackend(NewMemoryBackend())
+
+	_, err := bl.RegisterProcessorFuncConcurrency(func(j *Job) error { return nil }, 0)
+	assert.EqualError(t, err, "Concurrency must be at least 1, got 0")
+
+	pID, err := bl.RegisterProcessorFuncConcurrency(func(j *Job) error { return nil }, 2)
+	assert.NoError(t, err)
+
+	err = bl.SetProcessorConcurrency(pID, -1)
+	assert.EqualError(t, err, "Concurrency must be at least 1, got -1")
+
+	err = bl.SetProcessorConcurrency(pID+1, 1)
+	assert.EqualError(t, err, fmt.Sprintf("Processor %v not found", pID+1))
+}
+
+func TestBlero_ConcurrencyCaps(t *testing.T) {
+	opts := DefaultOptions("")
+	opts.Backend = NewMemoryBackend()
+	opts.ConcurrencyCaps = map[string]int{"Migrate": 1}
+	bl, err := NewWithOptions(opts)
+	assert.NoError(t, err)
+
+	err = bl.Start()
+	assert.NoError(t, err)
+	defer bl.Stop()
+
+	for _, name := range []string{"Migrate", "Migrate", "Migrate", "Resize", "Resize"} {
+		_, err := bl.EnqueueJob(name, nil)
+		assert.NoError(t, err)
+	}
+
+	p := newBlockingProcessor()
+	_, err = bl.RegisterProcessorConcurrency(p, 5)
+	assert.NoError(t, err)
+
+	// capped jobs don't block the other jobs
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 1, p.runningByName("Migrate"))
+	assert.Equal(t, 2, p.runningByName("Resize"))
+
+	// raise the cap at runtime
+	err = bl.SetConcurrencyCap("Migrate", 2)
+	assert.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 2, p.runningByName("Migrate"))
+
+	// a freed slot starts the next capped job
+	err = bl.SetConcurrencyCap("Migrate", 1)
+	assert.NoError(t, err)
+	for i := 0; i < 4; i++ {
+		p.release <- struct{}{}
+	}
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 1, p.runningByName("Migrate"))
+	_, done := p.counts()
+	assert.Equal(t, 4, done)
+
+	bl.RemoveConcurrencyCap("Migrate")
+	p.release <- struct{}{}
+	time.Sleep(50 * time.Millisecond)
+	_, done = p.counts()
+	assert.Equal(t, 5, done)
+	withDispatchLock(bl, func(pStore *processorsStore) {
+		assert.Len(t, bl.dispatcher.inFlight, 0)
+	})
+
+	err = bl.SetConcurrencyCap("Migrate", 0)
+	assert.EqualError(t, err, "Concurrency must be at least 1, got 0")
+
+	opts.ConcurrencyCaps = map[string]int{"Migrate": 0}
+	_, err = NewWithOptions(opts)
+	assert.EqualError(t, err, "ConcurrencyCaps[Migrate]: Concurrency must be at least 1, got 0")
+}
+
+// countingProcessor counts processed jobs and signals when all expected jobs are done
+type countingProcessor struct {
+	n    int64
+	want int64
+	done chan struct{}
+}
+
+func (p *countingProcessor) Run(j *Job) error {
+	if atomic.AddInt64(&p.n, 1) == p.want {
+		close(p.done)
+	}
+	return nil
+}
+
+func BenchmarkDispatch(b *testing.B) {
+	for _, processors := range []int{1, 16, 64} {
+		b.Run(fmt.Sprintf("processors-%v", processors), func(b *testing.B) {
+			bl := New(testDBPath)
+			err := bl.Start()
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			for n := 0; n < b.N; n++ {
+				_, err := bl.queue.enqueueJob(&Job{Name: "MyJob"})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			p := &countingProcessor{want: int64(b.N), done: make(chan struct{})}
+			b.ResetTimer()
+			for i := 0; i < processors; i++ {
+				bl.RegisterProcessor(p)
+			}
+			<-p.done
+			b.StopTimer()
+
+			bl.Stop()
+			deleteDBFolder(testDBPath)
+		})
+	}
+}
+
+func BenchmarkDispatchBlocked(b *testing.B) {
+	// a backlog of paused jobs and of jobs retried later, which the dispatcher doesn't read
+	const backlog = 10000
+	bl := New(testDBPath)
+	err := bl.Start()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer deleteDBFolder(testDBPath)
+	defer bl.Stop()
+
+	err = bl.PauseJob("PausedJob")
+	if err != nil {
+		b.Fatal(err)
+	}
+	for n := 0; n < backlog; n++ {
+		_, err := bl.queue.enqueueJob(&Job{Name: "PausedJob"})
+		if err != nil {
+			b.Fatal(err)
+		}
+		_, err = bl.queue.enqueueJob(&Job{Name: "RetriedJob", RunAt: timeNow().Add(time.Hour)})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	for n := 0; n < b.N; n++ {
+		_, err := bl.queue.enqueueJob(&Job{Name: "MyJob"})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	p := &countingProcessor{want: int64(b.N), done: make(chan struct{})}
+	b.ResetTimer()
+	for i := 0; i < 16; i++ {
+		bl.RegisterProcessor(p)
+	}
+	<-p.done
+	b.StopTimer()
 }
@@ -0,0 +1,182 @@
+package blero
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Transition is an entry of the history of a job, written each time the job changes status
+type Transition struct {
+	// At is the time of the status change
+	At time.Time `json:"at"`
+	// From is the previous status, empty when the job was enqueued or imported
+	From string `json:"from,omitempty"`
+	// To is the new status
+	To string `json:"to"`
+	// Attempt is the attempt of the job when it changed status
+	Attempt int `json:"attempt,omitempty"`
+	// ProcessorID is the registered processor which ran the attempt
+	ProcessorID int `json:"processor_id,omitempty"`
+	// LeaseOwner is the owner of the lease of the attempt
+	LeaseOwner string `json:"lease_owner,omitempty"`
+	// Error is the reason the attempt failed or was requeued
+	Error string `json:"error,omitempty"`
+}
+
+// historyPrefix is the prefix of the history entries
+const historyPrefix = "h:"
+
+// getHistoryKeyPrefix returns the prefix of the history entries of a job
+func getHistoryKeyPrefix(jID uint64) string {
+	return historyPrefix + jIDString(jID) + ":"
+}
+
+// getHistoryKey returns the key of the nth history entry of a job
+func getHistoryKey(jID uint64, n uint64) string {
+	return fmt.Sprintf("%v%020d", getHistoryKeyPrefix(jID), n)
+}
+
+// getHistoryCountKey returns the key of the number of history entries of a job
+func getHistoryCountKey(jID uint64) string {
+	return "hn:" + jIDString(jID)
+}
+
+// getHistoryCount returns the number of history entries of a job
+func getHistoryCount(tx Tx, jID uint64) (uint64, error) {
+	b, err := tx.Get([]byte(getHistoryCountKey(jID)))
+	if err == ErrKeyNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseUint(string(b), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid history count %q for job %v", b, jID)
+	}
+	return n, nil
+}
+
+// setHistoryCount stores the number of history entries of a job
+func setHistoryCount(tx Tx, jID uint64, n uint64) error {
+	return tx.Set([]byte(getHistoryCountKey(jID)), []byte(strconv.FormatUint(n, 10)))
+}
+
+// appendTransition appends a transition to the history of a job
+func appendTransition(tx Tx, jID uint64, t Transition) error {
+	n, err := getHistoryCount(tx, jID)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	err = tx.Set([]byte(getHistoryKey(jID, n)), b)
+	if err != nil {
+		return err
+	}
+	return setHistoryCount(tx, jID, n+1)
+}
+
+// readHistory reads the history of a job in order
+func readHistory(tx Tx, jID uint64) ([]Transition, error) {
+	history := []Transition{}
+	err := tx.Iterate([]byte(getHistoryKeyPrefix(jID)), nil, func(k, v []byte) (bool, error) {
+		var t Transition
+		err := json.Unmarshal(v, &t)
+		if err != nil {
+			return false, fmt.Errorf("Invalid history entry %s: %w", k, err)
+		}
+		history = append(history, t)
+		return true, nil
+	})
+	return history, err
+}
+
+// deleteHistory deletes the history of a job
+func deleteHistory(tx Tx, jID uint64) error {
+	err := tx.Iterate([]byte(getHistoryKeyPrefix(jID)), nil, func(k, v []byte) (bool, error) {
+		return true, tx.Delete(k)
+	})
+	if err != nil {
+		return err
+	}
+	err = tx.Delete([]byte(getHistoryCountKey(jID)))
+	if err != nil && err != ErrKeyNotFound {
+		return err
+	}
+	return nil
+}
+
+// migrateHistoryKeys renumbers up to batchSize history entries starting at cursor with 20 digits
+// and stores the number of entries of each job, the entries were numbered with 6 digits by counting them
+func migrateHistoryKeys(q *queue, tx Tx, cursor []byte, batchSize int) ([]byte, error) {
+	var next []byte
+	n := 0
+	err := tx.Iterate([]byte(historyPrefix), cursor, func(k, v []byte) (bool, error) {
+		if n == batchSize {
+			// resume from this key in the next batch
+			next = k
+			return false, nil
+		}
+
+		id, num, ok := strings.Cut(strings.TrimPrefix(string(k), historyPrefix), ":")
+		if !ok {
+			return false, fmt.Errorf("Invalid history key %q", k)
+		}
+		if len(num) != 6 {
+			// already renumbered
+			return true, nil
+		}
+		jID, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			return false, fmt.Errorf("Invalid history key %q", k)
+		}
+		i, err := strconv.ParseUint(num, 10, 64)
+		if err != nil {
+			return false, fmt.Errorf("Invalid history key %q", k)
+		}
+		n++
+
+		err = tx.Delete(k)
+		if err != nil {
+			return false, err
+		}
+		err = tx.Set([]byte(getHistoryKey(jID, i)), v)
+		if err != nil {
+			return false, err
+		}
+		// the entries are visited in order
+		return true, setHistoryCount(tx, jID, i+1)
+	})
+
+	return next, err
+}
+
+// getJobHistory returns the history of a job, the job must exist
+func (q *queue) getJobHistory(id uint64) ([]Transition, error) {
+	var history []Transition
+	err := q.backend.View(func(tx Tx) error {
+		_, _, err := findJobKey(tx, id)
+		if err != nil {
+			return err
+		}
+		history, err = readHistory(tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// JobHistory returns the status changes of a job in order, from its enqueue to its current status
+// The history is deleted along with the job, when it's deleted or swept after the retention
+func (bl *Blero) JobHistory(id uint64) ([]Transition, error) {
+	return bl.queue.getJobHistory(id)
+}
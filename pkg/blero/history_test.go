@@ -0,0 +1,151 @@
+package blero
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlero_JobHistory(t *testing.T) {
+	bl := NewWithBackend(NewMemoryBackend())
+	assert.NoError(t, bl.Start())
+	defer bl.Stop()
+
+	id, err := bl.EnqueueJob("TestJob", nil)
+	assert.NoError(t, err)
+
+	done := make(chan struct{}, 1)
+	pID := bl.RegisterProcessorFunc(func(j *Job) error {
+		defer func() { done <- struct{}{} }()
+		return errors.New("boom")
+	})
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("job not processed")
+	}
+	assert.Eventually(t, func() bool {
+		_, status, err := bl.GetJob(id)
+		return err == nil && status == JobFailed
+	}, time.Second, 10*time.Millisecond)
+	bl.UnregisterProcessor(pID)
+
+	assert.NoError(t, bl.RequeueJob(id))
+	leased, err := bl.LeaseJobs("worker-1", 1)
+	assert.NoError(t, err)
+	assert.NoError(t, bl.NackJobReason(id, leased[0].Attempts, "remote boom"))
+
+	history, err := bl.JobHistory(id)
+	assert.NoError(t, err)
+	if !assert.Len(t, history, 6) {
+		return
+	}
+	assert.Equal(t, Transition{At: history[0].At, To: "pending"}, history[0])
+	assert.Equal(t, Transition{At: history[1].At, From: "pending", To: "inprogress", Attempt: 1, ProcessorID: pID, LeaseOwner: localLeaseOwner}, history[1])
+	assert.Equal(t, Transition{At: history[2].At, From: "inprogress", To: "failed", Attempt: 1, ProcessorID: pID, LeaseOwner: localLeaseOwner, Error: "boom"}, history[2])
+	assert.Equal(t, Transition{At: history[3].At, From: "failed", To: "pending"}, history[3])
+	assert.Equal(t, Transition{At: history[4].At, From: "pending", To: "inprogress", Attempt: 1, LeaseOwner: "worker-1"}, history[4])
+	assert.Equal(t, Transition{At: history[5].At, From: "inprogress", To: "failed", Attempt: 1, LeaseOwner: "worker-1", Error: "remote boom"}, history[5])
+	for i := 1; i < len(history); i++ {
+		assert.False(t, history[i].At.Before(history[i-1].At))
+	}
+
+	// the history is deleted along with the job
+	assert.NoError(t, bl.DeleteJob(id))
+	_, err = bl.JobHistory(id)
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Equal(t, 0, countIndexEntries(t, bl.queue, "h:"))
+}
+
+func TestBlero_JobHistoryReapSweep(t *testing.T) {
+	bl := NewWithBackend(NewMemoryBackend())
+	assert.NoError(t, bl.Start())
+	defer bl.Stop()
+	q := bl.queue
+
+	id, err := bl.EnqueueJob("TestJob", nil)
+	assert.NoError(t, err)
+	_, err = q.dequeueJobs(1, "lost-worker", nil, nil)
+	assert.NoError(t, err)
+	_, err = q.reapLeases(timeNow().Add(time.Hour))
+	assert.NoError(t, err)
+
+	history, err := bl.JobHistory(id)
+	assert.NoError(t, err)
+	if assert.Len(t, history, 3) {
+		assert.Equal(t, "inprogress", history[2].From)
+		assert.Equal(t, "pending", history[2].To)
+		assert.Equal(t, "lost-worker", history[2].LeaseOwner)
+		assert.Equal(t, "Lease expired", history[2].Error)
+	}
+
+	// the history is bounded by the retention of the job
+	_, err = q.dequeueJob()
+	assert.NoError(t, err)
+	assert.NoError(t, q.markJobDone(id, JobComplete))
+	assert.Equal(t, 5, countIndexEntries(t, q, getHistoryKeyPrefix(id)))
+	n, err := q.sweepJobs(timeNow().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 0, countIndexEntries(t, q, getHistoryKeyPrefix(id)))
+}
+
+func TestBlero_JobHistoryMigration(t *testing.T) {
+	bl, err := NewWithOptions(newBadgerTestOptions(t))
+	assert.NoError(t, err)
+	assert.NoError(t, bl.Start())
+	defer bl.Stop()
+	q := bl.queue
+
+	id, err := bl.EnqueueJob("TestJob", nil)
+	assert.NoError(t, err)
+
+	// history entries written by version 4, numbered with 6 digits
+	err = q.backend.Update(func(tx Tx) error {
+		err := deleteHistory(tx, id)
+		if err != nil {
+			return err
+		}
+		for i, to := range []string{"pending", "inprogress", "pending"} {
+			b, err := json.Marshal(Transition{To: to})
+			if err != nil {
+				return err
+			}
+			err = tx.Set([]byte(fmt.Sprintf("%v%06d", getHistoryKeyPrefix(id), i)), b)
+			if err != nil {
+				return err
+			}
+		}
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, 4)
+		return tx.Set(formatVersionKey, b)
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, q.migrate())
+
+	_, err = q.dequeueJob()
+	assert.NoError(t, err)
+	history, err := bl.JobHistory(id)
+	assert.NoError(t, err)
+	var to []string
+	for _, t := range history {
+		to = append(to, t.To)
+	}
+	assert.Equal(t, []string{"pending", "inprogress", "pending", "inprogress"}, to)
+	assert.Equal(t, 4, countIndexEntries(t, q, getHistoryKeyPrefix(id)))
+
+	// the counter is deleted along with the history
+	assert.NoError(t, q.markJobDone(id, JobComplete))
+	assert.NoError(t, bl.DeleteJob(id))
+	assert.Equal(t, 0, countIndexEntries(t, q, "hn:"))
+}
+
+func TestGetHistoryKey(t *testing.T) {
+	// the entries sort in order past a million transitions
+	assert.Less(t, getHistoryKey(1, 999999), getHistoryKey(1, 1000000))
+}
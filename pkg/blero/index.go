@@ -0,0 +1,410 @@
+package blero
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Secondary index keys map a job property in a status to the job ID, their values are empty
+// The property is followed by a NUL byte so that a property can't be a prefix of another one,
+// the zero padded job ID comes last so that the entries of a property are in ID order
+// Times are zero padded unix nanoseconds so that the entries of a time index are in time order
+const (
+	indexPrefix         = "x:"
+	tagIndexPrefix      = "x:t:"
+	headerIndexPrefix   = "x:h:"
+	nameIndexPrefix     = "x:n:"
+	enqueuedIndexPrefix = "x:e:"
+	changedIndexPrefix  = "x:c:"
+)
+
+// Dispatch index keys list the pending jobs by the time they can start so that the dispatcher never reads the jobs scheduled for later
+// The ready index holds the jobs which can start by name in ID order, the scheduled index holds the jobs retried or snoozed in run time order
+// Scheduled entries are moved to the ready index by dequeueJobs once their run time is due
+const (
+	readyIndexPrefix     = "x:r:"
+	scheduledIndexPrefix = "x:s:"
+)
+
+// getTagIndexPrefix returns the prefix of the index entries of the jobs with a tag in a status
+func getTagIndexPrefix(status JobStatus, tag string) string {
+	return fmt.Sprintf("%v%v:%v\x00", tagIndexPrefix, status, tag)
+}
+
+// getHeaderIndexPrefix returns the prefix of the index entries of the jobs with a header in a status
+func getHeaderIndexPrefix(status JobStatus, name, value string) string {
+	return fmt.Sprintf("%v%v:%v\x00%v\x00", headerIndexPrefix, status, name, value)
+}
+
+// getNameIndexPrefix returns the prefix of the index entries of the jobs with a name in a status
+func getNameIndexPrefix(status JobStatus, name string) string {
+	return fmt.Sprintf("%v%v:%v\x00", nameIndexPrefix, status, name)
+}
+
+// getEnqueuedIndexPrefix returns the prefix of the enqueue time index entries of the jobs in a status
+func getEnqueuedIndexPrefix(status JobStatus) string {
+	return fmt.Sprintf("%v%v:", enqueuedIndexPrefix, status)
+}
+
+// getChangedIndexPrefix returns the prefix of the status change time index entries of the jobs in a status
+func getChangedIndexPrefix(status JobStatus) string {
+	return fmt.Sprintf("%v%v:", changedIndexPrefix, status)
+}
+
+// getReadyIndexPrefix returns the prefix of the ready index entries of the pending jobs with a name
+func getReadyIndexPrefix(name string) string {
+	return fmt.Sprintf("%v%v:%v\x00", readyIndexPrefix, JobPending, name)
+}
+
+// getScheduledIndexPrefix returns the prefix of the scheduled index entries
+func getScheduledIndexPrefix() string {
+	return fmt.Sprintf("%v%v:", scheduledIndexPrefix, JobPending)
+}
+
+// dispatchIndexKey returns the ready index key of a pending job which can start at now, or else its scheduled index key
+func dispatchIndexKey(j *Job, now time.Time) []byte {
+	if runnable(j, now) {
+		return []byte(getReadyIndexPrefix(j.Name) + jIDString(j.ID))
+	}
+	return []byte(getScheduledIndexPrefix() + indexTime(j.RunAt) + jIDString(j.ID))
+}
+
+// parseReadyIndexKey returns the job name and ID of a ready index key
+func parseReadyIndexKey(k []byte) (string, uint64, error) {
+	prefix := fmt.Sprintf("%v%v:", readyIndexPrefix, JobPending)
+	rest, ok := bytes.CutPrefix(k, []byte(prefix))
+	i := bytes.LastIndexByte(rest, 0)
+	if !ok || i < 0 {
+		return "", 0, fmt.Errorf("Invalid ready index key %q", k)
+	}
+	id, err := strconv.ParseUint(string(rest[i+1:]), 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("Invalid ready index key %q", k)
+	}
+	return string(rest[:i]), id, nil
+}
+
+// parseScheduledIndexKey returns the run time and job ID of a scheduled index key
+func parseScheduledIndexKey(k []byte) (time.Time, uint64, error) {
+	rest, ok := bytes.CutPrefix(k, []byte(getScheduledIndexPrefix()))
+	idLen := len(jIDString(0))
+	if !ok || len(rest) != 2*idLen+1 {
+		return time.Time{}, 0, fmt.Errorf("Invalid scheduled index key %q", k)
+	}
+	nanos, err := strconv.ParseInt(string(rest[:idLen]), 10, 64)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("Invalid scheduled index key %q", k)
+	}
+	id, err := strconv.ParseUint(string(rest[idLen+1:]), 10, 64)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("Invalid scheduled index key %q", k)
+	}
+	return time.Unix(0, nanos).UTC(), id, nil
+}
+
+// indexTime formats a time in a time index key, times before the epoch sort first
+func indexTime(t time.Time) string {
+	return fmt.Sprintf("%020d\x00", max(t.UnixNano(), 0))
+}
+
+// jobIndexKeys returns the index keys of a job in a status
+func jobIndexKeys(j *Job, status JobStatus) [][]byte {
+	id := jIDString(j.ID)
+	keys := make([][]byte, 0, len(j.Tags)+len(j.Headers)+4)
+	for _, tag := range j.Tags {
+		keys = append(keys, []byte(getTagIndexPrefix(status, tag)+id))
+	}
+	for name, value := range j.Headers {
+		keys = append(keys, []byte(getHeaderIndexPrefix(status, name, value)+id))
+	}
+	keys = append(keys, []byte(getNameIndexPrefix(status, j.Name)+id))
+	if !j.EnqueuedAt.IsZero() {
+		keys = append(keys, []byte(getEnqueuedIndexPrefix(status)+indexTime(j.EnqueuedAt)+id))
+	}
+	if !j.StatusChangedAt.IsZero() {
+		keys = append(keys, []byte(getChangedIndexPrefix(status)+indexTime(j.StatusChangedAt)+id))
+	}
+	if status == JobPending {
+		keys = append(keys, dispatchIndexKey(j, timeNow()))
+	}
+	return keys
+}
+
+// parseIndexKey returns the status and job ID of an index key
+func parseIndexKey(k []byte) (JobStatus, uint64, error) {
+	// x:<kind>:<status>:...<id>
+	parts := bytes.SplitN(k, []byte(":"), 4)
+	idLen := len(jIDString(0))
+	if len(parts) != 4 || len(k) < idLen {
+		return 0, 0, fmt.Errorf("Invalid index key %q", k)
+	}
+	status, err := ParseJobStatus(string(parts[2]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("Invalid index key %q: %w", k, err)
+	}
+	id, err := strconv.ParseUint(string(k[len(k)-idLen:]), 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Invalid index key %q", k)
+	}
+	return status, id, nil
+}
+
+// setJobIndexes writes the index entries of a job in a status
+func setJobIndexes(tx Tx, j *Job, status JobStatus) error {
+	for _, k := range jobIndexKeys(j, status) {
+		err := tx.Set(k, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteJobIndexes deletes the index entries of a job in a status
+// A pending job scheduled for later is in either dispatch index depending on whether its entry was moved yet, both are deleted
+func deleteJobIndexes(tx Tx, j *Job, status JobStatus) error {
+	keys := jobIndexKeys(j, status)
+	if status == JobPending && !j.RunAt.IsZero() {
+		keys = append(keys, dispatchIndexKey(j, time.Time{}), dispatchIndexKey(j, j.RunAt))
+	}
+	for _, k := range keys {
+		err := tx.Delete(k)
+		if err != nil && err != ErrKeyNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexPrefix returns the prefix of the index listing the jobs matching opts in ID order, or an empty prefix when no such index applies
+func (opts ListOptions) indexPrefix() string {
+	if len(opts.Tags) > 0 {
+		return getTagIndexPrefix(opts.Status, opts.Tags[0])
+	}
+	for _, name := range sortedKeys(opts.Headers) {
+		return getHeaderIndexPrefix(opts.Status, name, opts.Headers[name])
+	}
+	if opts.Name != "" {
+		return getNameIndexPrefix(opts.Status, opts.Name)
+	}
+	return ""
+}
+
+// timeIndexRange returns the time index range holding the jobs matching opts, end is empty when the range is open
+// prefix is empty when opts has no time range
+func (opts ListOptions) timeIndexRange() (prefix, start, end string) {
+	since, before := opts.EnqueuedSince, opts.EnqueuedBefore
+	prefix = getEnqueuedIndexPrefix(opts.Status)
+	if since.IsZero() && before.IsZero() {
+		since, before = opts.ChangedSince, opts.ChangedBefore
+		prefix = getChangedIndexPrefix(opts.Status)
+	}
+	if since.IsZero() && before.IsZero() {
+		return "", "", ""
+	}
+
+	start = prefix + indexTime(since)
+	if !before.IsZero() {
+		end = prefix + indexTime(before)
+	}
+	return prefix, start, end
+}
+
+// inTimeRange checks if t is in [since, before), zero bounds are open
+func inTimeRange(t, since, before time.Time) bool {
+	if !since.IsZero() && t.Before(since) {
+		return false
+	}
+	if !before.IsZero() && !t.Before(before) {
+		return false
+	}
+	return true
+}
+
+// matches checks if a job has the name, times, tags and headers of opts
+func (opts ListOptions) matches(j *Job) bool {
+	if opts.Name != "" && j.Name != opts.Name {
+		return false
+	}
+	if !inTimeRange(j.EnqueuedAt, opts.EnqueuedSince, opts.EnqueuedBefore) {
+		return false
+	}
+	if !inTimeRange(j.StatusChangedAt, opts.ChangedSince, opts.ChangedBefore) {
+		return false
+	}
+	for _, tag := range opts.Tags {
+		if !j.HasTag(tag) {
+			return false
+		}
+	}
+	for name, value := range opts.Headers {
+		v, ok := j.Headers[name]
+		if !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// HasTag checks if a job has a tag
+func (j *Job) HasTag(tag string) bool {
+	for _, t := range j.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// validateHeadersTags checks that headers and tags can be indexed
+func validateHeadersTags(headers map[string]string, tags []string) error {
+	var errs []error
+	for _, name := range sortedKeys(headers) {
+		if name == "" {
+			errs = append(errs, errors.New("Header name cannot be empty"))
+		} else if strings.ContainsRune(name, 0) || strings.ContainsRune(headers[name], 0) {
+			errs = append(errs, fmt.Errorf("Header %q cannot contain NUL bytes", name))
+		}
+	}
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		switch {
+		case tag == "":
+			errs = append(errs, errors.New("Tag cannot be empty"))
+		case strings.ContainsRune(tag, 0):
+			errs = append(errs, fmt.Errorf("Tag %q cannot contain NUL bytes", tag))
+		case seen[tag]:
+			errs = append(errs, fmt.Errorf("Duplicate tag %q", tag))
+		}
+		seen[tag] = true
+	}
+	return errors.Join(errs...)
+}
+
+// indexJobs writes the index entries of up to batchSize job records starting at cursor
+// Records written before status change times were stored get the time they finished or were enqueued
+func indexJobs(q *queue, tx Tx, cursor []byte, batchSize int) ([]byte, error) {
+	var next []byte
+	n := 0
+	err := tx.Iterate([]byte("q:"), cursor, func(k, v []byte) (bool, error) {
+		if n == batchSize {
+			// resume from this key in the next batch
+			next = k
+			return false, nil
+		}
+		n++
+
+		status, err := ParseJobStatus(string(bytes.Split(k, []byte(":"))[1]))
+		if err != nil {
+			return false, fmt.Errorf("Invalid job key %q: %w", k, err)
+		}
+		j, err := decodeJob(v)
+		if err != nil {
+			return false, err
+		}
+
+		if j.StatusChangedAt.IsZero() {
+			j.StatusChangedAt = j.FinishedAt
+			if j.StatusChangedAt.IsZero() {
+				j.StatusChangedAt = j.EnqueuedAt
+			}
+			b, err := encodeJob(q.opts.Codec, j)
+			if err != nil {
+				return false, err
+			}
+			err = tx.Set(k, b)
+			if err != nil {
+				return false, err
+			}
+		}
+		return true, setJobIndexes(tx, j, status)
+	})
+
+	return next, err
+}
+
+// indexPendingJobs writes the dispatch index entries of up to batchSize pending jobs starting at cursor
+func indexPendingJobs(q *queue, tx Tx, cursor []byte, batchSize int) ([]byte, error) {
+	var next []byte
+	n := 0
+	now := timeNow()
+	err := tx.Iterate([]byte(getQueueKeyPrefix(JobPending)), cursor, func(k, v []byte) (bool, error) {
+		if n == batchSize {
+			// resume from this key in the next batch
+			next = k
+			return false, nil
+		}
+		n++
+
+		j, err := decodeJob(v)
+		if err != nil {
+			return false, err
+		}
+		return true, tx.Set(dispatchIndexKey(j, now), nil)
+	})
+
+	return next, err
+}
+
+// deleteStaleIndexes deletes up to batchSize index entries starting at cursor which don't match a job record
+func deleteStaleIndexes(q *queue, tx Tx, cursor []byte, batchSize int) ([]byte, error) {
+	var next []byte
+	n := 0
+	err := tx.Iterate([]byte(indexPrefix), cursor, func(k, v []byte) (bool, error) {
+		if n == batchSize {
+			next = k
+			return false, nil
+		}
+		n++
+
+		status, id, err := parseIndexKey(k)
+		if err == nil {
+			var j *Job
+			j, err = getJobForKey(tx, []byte(getJobKey(status, id)))
+			if err == nil && slices.ContainsFunc(jobIndexKeys(j, status), func(key []byte) bool { return bytes.Equal(key, k) }) {
+				return true, nil
+			}
+			if err != nil && err != ErrKeyNotFound {
+				return false, err
+			}
+		}
+		return true, tx.Delete(k)
+	})
+
+	return next, err
+}
+
+// rebuildIndexes writes the index entries of all jobs then deletes the stale entries
+// Each batch runs in its own transaction so Blero keeps running during the rebuild
+func (q *queue) rebuildIndexes() error {
+	for _, batch := range []func(q *queue, tx Tx, cursor []byte, batchSize int) ([]byte, error){indexJobs, deleteStaleIndexes} {
+		var cursor []byte
+		for {
+			q.dbL.Lock()
+			err := q.backend.Update(func(tx Tx) error {
+				var err error
+				cursor, err = batch(q, tx, cursor, migrationBatchSize)
+				return err
+			})
+			q.dbL.Unlock()
+			if err != nil {
+				return err
+			}
+			if cursor == nil {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// RebuildIndexes rebuilds the secondary indexes used to list jobs by name, time, tag and header
+// Indexes are kept up to date by Blero, a rebuild is only needed to repair a db modified by other means
+func (bl *Blero) RebuildIndexes() error {
+	return bl.queue.rebuildIndexes()
+}
@@ -0,0 +1,356 @@
+package blero
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countIndexEntries counts the index entries with a prefix
+func countIndexEntries(t *testing.T, q *queue, prefix string) int {
+	n := 0
+	err := q.backend.View(func(tx Tx) error {
+		return tx.Iterate([]byte(prefix), nil, func(k, v []byte) (bool, error) {
+			n++
+			return true, nil
+		})
+	})
+	assert.NoError(t, err)
+	return n
+}
+
+func TestBlero_HeadersTags(t *testing.T) {
+	bl := NewWithBackend(NewMemoryBackend())
+	assert.NoError(t, bl.Start())
+	defer bl.Stop()
+	ctx := t.Context()
+
+	headers := map[string]string{"tenant": "acme", "correlation-id": "42"}
+	id, err := bl.EnqueueJobOptions(ctx, "TestJob", nil, EnqueueOptions{Headers: headers, Tags: []string{"billing", "eu"}})
+	assert.NoError(t, err)
+
+	// the headers are copied
+	headers["tenant"] = "other"
+
+	got := make(chan *Job, 1)
+	bl.RegisterProcessorFunc(func(j *Job) error {
+		got <- j
+		return nil
+	})
+	select {
+	case j := <-got:
+		assert.Equal(t, id, j.ID)
+		assert.Equal(t, map[string]string{"tenant": "acme", "correlation-id": "42"}, j.Headers)
+		assert.Equal(t, []string{"billing", "eu"}, j.Tags)
+		assert.True(t, j.HasTag("eu"))
+		assert.False(t, j.HasTag("us"))
+	case <-time.After(time.Second):
+		t.Fatal("job not processed")
+	}
+}
+
+func TestBlero_ListJobsByTagHeader(t *testing.T) {
+	bl := NewWithBackend(NewMemoryBackend())
+	assert.NoError(t, bl.Start())
+	defer bl.Stop()
+	ctx := t.Context()
+	q := bl.queue
+
+	enqueue := func(tenant string, tags ...string) uint64 {
+		id, err := bl.EnqueueJobOptions(ctx, "TestJob", nil, EnqueueOptions{Headers: map[string]string{"tenant": tenant}, Tags: tags})
+		assert.NoError(t, err)
+		return id
+	}
+	id1 := enqueue("acme", "billing", "eu")
+	id2 := enqueue("acme", "billing")
+	id3 := enqueue("other", "billing", "eu")
+	id4 := enqueue("acme")
+	id5, err := bl.EnqueueJob("NoTags", nil)
+	assert.NoError(t, err)
+
+	ids := func(opts ListOptions) []uint64 {
+		jobs, err := bl.ListJobs(opts)
+		assert.NoError(t, err)
+		ids := []uint64{}
+		for _, j := range jobs {
+			ids = append(ids, j.ID)
+		}
+		return ids
+	}
+	assert.Equal(t, []uint64{id1, id2, id3}, ids(ListOptions{Tags: []string{"billing"}}))
+	assert.Equal(t, []uint64{id1, id3}, ids(ListOptions{Tags: []string{"billing", "eu"}}))
+	assert.Equal(t, []uint64{id1, id2, id4}, ids(ListOptions{Headers: map[string]string{"tenant": "acme"}}))
+	assert.Equal(t, []uint64{id1}, ids(ListOptions{Tags: []string{"eu"}, Headers: map[string]string{"tenant": "acme"}}))
+	assert.Equal(t, []uint64{}, ids(ListOptions{Tags: []string{"unknown"}}))
+
+	// pagination
+	assert.Equal(t, []uint64{id2}, ids(ListOptions{Tags: []string{"billing"}, After: id1, Limit: 1}))
+
+	// the index entries move with the jobs
+	j, err := q.dequeueJob()
+	assert.NoError(t, err)
+	assert.Equal(t, id1, j.ID)
+	assert.Equal(t, []uint64{id2, id3}, ids(ListOptions{Tags: []string{"billing"}}))
+	assert.Equal(t, []uint64{id1}, ids(ListOptions{Status: JobInProgress, Tags: []string{"billing"}}))
+
+	assert.NoError(t, q.markJobDone(id1, JobFailed))
+	assert.Equal(t, []uint64{}, ids(ListOptions{Status: JobInProgress, Tags: []string{"billing"}}))
+	assert.Equal(t, []uint64{id1}, ids(ListOptions{Status: JobFailed, Tags: []string{"eu"}}))
+
+	assert.NoError(t, bl.RequeueJob(id1))
+	assert.Equal(t, []uint64{id1, id2, id3}, ids(ListOptions{Tags: []string{"billing"}}))
+
+	// deleted jobs leave no index entries
+	for _, id := range []uint64{id1, id2, id3, id4, id5} {
+		assert.NoError(t, bl.DeleteJob(id))
+	}
+	assert.Equal(t, 0, countIndexEntries(t, q, "x:"))
+}
+
+func TestBlero_SweepDeletesIndexes(t *testing.T) {
+	bl := NewWithBackend(NewMemoryBackend())
+	assert.NoError(t, bl.Start())
+	defer bl.Stop()
+	q := bl.queue
+
+	_, err := bl.EnqueueJobOptions(t.Context(), "TestJob", nil, EnqueueOptions{Headers: map[string]string{"a": "b"}, Tags: []string{"t"}})
+	assert.NoError(t, err)
+	j, err := q.dequeueJob()
+	assert.NoError(t, err)
+	assert.NoError(t, q.markJobDone(j.ID, JobComplete))
+	// tag, header, name, enqueue time and status change time
+	assert.Equal(t, 5, countIndexEntries(t, q, "x:"))
+
+	n, err := q.sweepJobs(timeNow().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 0, countIndexEntries(t, q, "x:"))
+}
+
+func TestEnqueueOptions_Validate(t *testing.T) {
+	opts := EnqueueOptions{
+		Headers: map[string]string{"": "x", "bad": "a\x00b", "ok": "ok"},
+		Tags:    []string{"a", "", "a", "b\x00"},
+	}
+	assert.EqualError(t, opts.validate(), "Invalid enqueue options: Header name cannot be empty\n"+
+		"Header \"bad\" cannot contain NUL bytes\n"+
+		"Tag cannot be empty\n"+
+		"Duplicate tag \"a\"\n"+
+		"Tag \"b\\x00\" cannot contain NUL bytes")
+
+	bl := NewWithBackend(NewMemoryBackend())
+	assert.NoError(t, bl.Start())
+	defer bl.Stop()
+	_, err := bl.EnqueueJobOptions(t.Context(), "TestJob", nil, EnqueueOptions{Tags: []string{""}})
+	assert.ErrorIs(t, err, ErrInvalidEnqueueOptions)
+	assert.EqualError(t, err, "Invalid enqueue options: Tag cannot be empty")
+}
+
+func TestBlero_ListJobsByNameTime(t *testing.T) {
+	bl := NewWithBackend(NewMemoryBackend())
+	assert.NoError(t, bl.Start())
+	defer bl.Stop()
+	q := bl.queue
+
+	defer func(f func() time.Time) { timeNow = f }(timeNow)
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+
+	enqueue := func(name string, minutes int) uint64 {
+		timeNow = func() time.Time { return at(minutes) }
+		id, err := bl.EnqueueJob(name, nil)
+		assert.NoError(t, err)
+		return id
+	}
+	// IDs and enqueue times in different orders
+	id1 := enqueue("A", 3)
+	id2 := enqueue("B", 1)
+	id3 := enqueue("A", 2)
+	id4 := enqueue("A", 5)
+
+	ids := func(opts ListOptions) []uint64 {
+		jobs, err := bl.ListJobs(opts)
+		assert.NoError(t, err)
+		ids := []uint64{}
+		for _, j := range jobs {
+			ids = append(ids, j.ID)
+		}
+		return ids
+	}
+	assert.Equal(t, []uint64{id1, id3, id4}, ids(ListOptions{Name: "A"}))
+	assert.Equal(t, []uint64{id3}, ids(ListOptions{Name: "A", After: id1, Limit: 1}))
+	assert.Equal(t, []uint64{}, ids(ListOptions{Name: "Unknown"}))
+
+	// since is inclusive and before exclusive, the jobs are listed in ID order
+	assert.Equal(t, []uint64{id1, id3}, ids(ListOptions{EnqueuedSince: at(2), EnqueuedBefore: at(5)}))
+	assert.Equal(t, []uint64{id1, id2, id3}, ids(ListOptions{EnqueuedBefore: at(4)}))
+	assert.Equal(t, []uint64{id4}, ids(ListOptions{EnqueuedSince: at(4)}))
+	assert.Equal(t, []uint64{id2, id3}, ids(ListOptions{EnqueuedBefore: at(4), After: id1, Limit: 2}))
+	assert.Equal(t, []uint64{id3}, ids(ListOptions{Name: "A", EnqueuedBefore: at(3)}))
+
+	// the status change time index moves with the jobs
+	timeNow = func() time.Time { return at(10) }
+	j, err := q.dequeueJob()
+	assert.NoError(t, err)
+	assert.Equal(t, at(10), j.StatusChangedAt)
+	timeNow = func() time.Time { return at(20) }
+	assert.NoError(t, q.markJobDone(j.ID, JobComplete))
+	assert.Equal(t, []uint64{}, ids(ListOptions{Status: JobComplete, ChangedBefore: at(20)}))
+	assert.Equal(t, []uint64{id1}, ids(ListOptions{Status: JobComplete, ChangedSince: at(20)}))
+	assert.Equal(t, []uint64{id2, id3, id4}, ids(ListOptions{ChangedBefore: at(10)}))
+	assert.Equal(t, 0, countIndexEntries(t, q, getChangedIndexPrefix(JobInProgress)))
+}
+
+func TestBlero_RebuildIndexes(t *testing.T) {
+	bl := NewWithBackend(NewMemoryBackend())
+	assert.NoError(t, bl.Start())
+	defer bl.Stop()
+	q := bl.queue
+
+	id, err := bl.EnqueueJobOptions(t.Context(), "TestJob", nil, EnqueueOptions{Tags: []string{"a"}})
+	assert.NoError(t, err)
+	_, err = bl.EnqueueJob("Other", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 9, countIndexEntries(t, q, "x:"))
+
+	// lose the entries of a job and leave stale entries behind
+	err = q.backend.Update(func(tx Tx) error {
+		j, err := getJobForKey(tx, []byte(getJobKey(JobPending, id)))
+		assert.NoError(t, err)
+		assert.NoError(t, deleteJobIndexes(tx, j, JobPending))
+		assert.NoError(t, setJobIndexes(tx, j, JobFailed))
+		return tx.Set([]byte(getNameIndexPrefix(JobPending, "Deleted")+jIDString(42)), nil)
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, bl.RebuildIndexes())
+	assert.Equal(t, 9, countIndexEntries(t, q, "x:"))
+	assert.Equal(t, 2, countIndexEntries(t, q, readyIndexPrefix))
+	assert.Equal(t, 0, countIndexEntries(t, q, "x:t:"+JobFailed.String()))
+	jobs, err := bl.ListJobs(ListOptions{Tags: []string{"a"}})
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+}
+
+func TestBlero_MigrateIndexes(t *testing.T) {
+	bl := NewWithBackend(NewMemoryBackend())
+	assert.NoError(t, bl.Start())
+	defer bl.Stop()
+	q := bl.queue
+
+	// version 1 records without status change times or name and time index entries
+	enqueuedAt := timeNow().Add(-time.Hour)
+	err := q.backend.Update(func(tx Tx) error {
+		b, err := encodeJob(q.opts.Codec, &Job{ID: 1, Name: "TestJob", EnqueuedAt: enqueuedAt})
+		assert.NoError(t, err)
+		assert.NoError(t, tx.Set([]byte(getJobKey(JobPending, 1)), b))
+		return setFormatVersion(tx, 1)
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, q.migrate())
+	version, err := q.getFormatVersion()
+	assert.NoError(t, err)
+	assert.Equal(t, formatVersion, version)
+
+	jobs, err := bl.ListJobs(ListOptions{Name: "TestJob", ChangedBefore: timeNow()})
+	assert.NoError(t, err)
+	if assert.Len(t, jobs, 1) {
+		assert.Equal(t, enqueuedAt, jobs[0].StatusChangedAt)
+	}
+}
+
+func TestBlero_DispatchIndexes(t *testing.T) {
+	bl := NewWithBackend(NewMemoryBackend())
+	assert.NoError(t, bl.Start())
+	defer bl.Stop()
+	q := bl.queue
+
+	defer func(f func() time.Time) { timeNow = f }(timeNow)
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return start }
+
+	var ids []uint64
+	for _, name := range []string{"A", "Paused", "B", "A", "Paused"} {
+		id, err := q.enqueueJob(&Job{Name: name})
+		assert.NoError(t, err)
+		ids = append(ids, id)
+	}
+	assert.Equal(t, 5, countIndexEntries(t, q, readyIndexPrefix))
+
+	// a retried job is scheduled until its run time
+	_, err := q.dequeueJobs(1, "worker-1", nil, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, q.finishLease(ids[0], 1, attemptResult{status: JobPending, runAt: start.Add(time.Minute)}))
+	assert.Equal(t, 4, countIndexEntries(t, q, readyIndexPrefix))
+	assert.Equal(t, 1, countIndexEntries(t, q, scheduledIndexPrefix))
+	runAt, err := q.nextRunAt()
+	assert.NoError(t, err)
+	assert.Equal(t, start.Add(time.Minute), runAt)
+
+	// the jobs of skipped names are not read, even when their record is corrupt
+	err = q.backend.Update(func(tx Tx) error {
+		return tx.Set([]byte(getJobKey(JobPending, ids[1])), []byte("corrupt"))
+	})
+	assert.NoError(t, err)
+	skipPaused := &dequeueFilter{skipName: func(name string) bool { return name == "Paused" }}
+	jobs, err := q.dequeueJobs(10, "worker-1", nil, skipPaused)
+	assert.NoError(t, err)
+	var leased []uint64
+	for _, j := range jobs {
+		leased = append(leased, j.ID)
+	}
+	assert.Equal(t, []uint64{ids[2], ids[3]}, leased)
+
+	// the due job is moved to the ready index
+	timeNow = func() time.Time { return start.Add(time.Minute) }
+	jobs, err = q.dequeueJobs(10, "worker-1", nil, skipPaused)
+	assert.NoError(t, err)
+	if assert.Len(t, jobs, 1) {
+		assert.Equal(t, ids[0], jobs[0].ID)
+	}
+	assert.Equal(t, 0, countIndexEntries(t, q, scheduledIndexPrefix))
+	runAt, err = q.nextRunAt()
+	assert.NoError(t, err)
+	assert.True(t, runAt.IsZero())
+
+	// a scheduled job deleted before its run time leaves no entry behind
+	assert.NoError(t, q.finishLease(ids[0], 2, attemptResult{status: JobFailed}))
+	assert.NoError(t, bl.RequeueJob(ids[0]))
+	jobs, err = q.dequeueJobs(1, "worker-1", nil, skipPaused)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+	assert.NoError(t, q.finishLease(ids[0], 1, attemptResult{status: JobPending, runAt: start.Add(time.Hour)}))
+	timeNow = func() time.Time { return start.Add(2 * time.Hour) }
+	assert.NoError(t, bl.DeleteJob(ids[0]))
+	assert.Equal(t, 0, countIndexEntries(t, q, scheduledIndexPrefix))
+	assert.Equal(t, 2, countIndexEntries(t, q, readyIndexPrefix))
+}
+
+func TestBlero_MigrateDispatchIndexes(t *testing.T) {
+	bl := NewWithBackend(NewMemoryBackend())
+	assert.NoError(t, bl.Start())
+	defer bl.Stop()
+	q := bl.queue
+
+	// version 5 pending records without dispatch index entries
+	err := q.backend.Update(func(tx Tx) error {
+		for _, j := range []*Job{{ID: 1, Name: "TestJob"}, {ID: 2, Name: "TestJob", RunAt: timeNow().Add(time.Hour)}} {
+			b, err := encodeJob(q.opts.Codec, j)
+			assert.NoError(t, err)
+			assert.NoError(t, tx.Set([]byte(getJobKey(JobPending, j.ID)), b))
+		}
+		return setFormatVersion(tx, 5)
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, q.migrate())
+	assert.Equal(t, 1, countIndexEntries(t, q, readyIndexPrefix))
+	assert.Equal(t, 1, countIndexEntries(t, q, scheduledIndexPrefix))
+	jobs, err := q.dequeueJobs(10, "worker-1", nil, nil)
+	assert.NoError(t, err)
+	if assert.Len(t, jobs, 1) {
+		assert.Equal(t, uint64(1), jobs[0].ID)
+	}
+}
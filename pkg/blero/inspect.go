@@ -0,0 +1,203 @@
+package blero
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// ErrJobStatus is returned when an operation isn't allowed in the current status of a job
+var ErrJobStatus = errors.New("Invalid job status")
+
+// ListOptions selects the jobs returned by ListJobs
+type ListOptions struct {
+	// Status of the listed jobs
+	Status JobStatus
+	// After lists the jobs with an ID greater than After, to get the next page
+	After uint64
+	// Limit is the max number of listed jobs, 0 is unlimited
+	Limit int
+	// Tags lists the jobs with all the tags
+	Tags []string
+	// Headers lists the jobs with all the headers
+	Headers map[string]string
+	// Name lists the jobs with a name
+	Name string
+	// EnqueuedSince and EnqueuedBefore list the jobs enqueued in [EnqueuedSince, EnqueuedBefore), zero times are open bounds
+	EnqueuedSince  time.Time
+	EnqueuedBefore time.Time
+	// ChangedSince and ChangedBefore list the jobs which moved to their status in [ChangedSince, ChangedBefore), zero times are open bounds
+	ChangedSince  time.Time
+	ChangedBefore time.Time
+}
+
+// listJobs lists the jobs in a status in ID order
+// Jobs are looked up through the index of the first tag, header or the name when set, else through the enqueue or status change time index
+func (q *queue) listJobs(opts ListOptions) ([]*Job, error) {
+	jobs := []*Job{}
+	err := q.backend.View(func(tx Tx) error {
+		add := func(j *Job) (bool, error) {
+			if !opts.matches(j) {
+				return true, nil
+			}
+			err := loadBlob(tx, j)
+			if err != nil {
+				return false, err
+			}
+			jobs = append(jobs, j)
+			return opts.Limit == 0 || len(jobs) < opts.Limit, nil
+		}
+
+		prefix := opts.indexPrefix()
+		if prefix == "" {
+			if prefix, start, end := opts.timeIndexRange(); prefix != "" {
+				return listTimeRange(tx, opts, prefix, start, end, add)
+			}
+
+			prefix = getQueueKeyPrefix(opts.Status)
+			return tx.Iterate([]byte(prefix), []byte(prefix+jIDString(opts.After+1)), func(k, v []byte) (bool, error) {
+				j, err := decodeJob(v)
+				if err != nil {
+					return false, err
+				}
+				return add(j)
+			})
+		}
+
+		return tx.Iterate([]byte(prefix), []byte(prefix+jIDString(opts.After+1)), func(k, v []byte) (bool, error) {
+			_, id, err := parseIndexKey(k)
+			if err != nil {
+				return false, err
+			}
+			j, err := getJobForKey(tx, []byte(getJobKey(opts.Status, id)))
+			if err != nil {
+				return false, err
+			}
+			return add(j)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// listTimeRange adds the jobs of a time index range in ID order
+// The IDs of the range are collected and sorted before loading the jobs since the index is in time order
+func listTimeRange(tx Tx, opts ListOptions, prefix, start, end string, add func(j *Job) (bool, error)) error {
+	var ids []uint64
+	err := tx.Iterate([]byte(prefix), []byte(start), func(k, v []byte) (bool, error) {
+		if end != "" && string(k) >= end {
+			return false, nil
+		}
+		_, id, err := parseIndexKey(k)
+		if err != nil {
+			return false, err
+		}
+		if id > opts.After {
+			ids = append(ids, id)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	slices.Sort(ids)
+
+	for _, id := range ids {
+		j, err := getJobForKey(tx, []byte(getJobKey(opts.Status, id)))
+		if err != nil {
+			return err
+		}
+		cont, err := add(j)
+		if err != nil || !cont {
+			return err
+		}
+	}
+	return nil
+}
+
+// countJobs counts the jobs per status
+func (q *queue) countJobs() (map[JobStatus]int, error) {
+	counts := make(map[JobStatus]int)
+	err := q.backend.View(func(tx Tx) error {
+		for _, s := range jobStatuses {
+			counts[s] = 0
+			err := tx.Iterate([]byte(getQueueKeyPrefix(s)), nil, func(k, v []byte) (bool, error) {
+				counts[s]++
+				return true, nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// findJobKey returns the key and status of a job
+func findJobKey(tx Tx, id uint64) ([]byte, JobStatus, error) {
+	for _, s := range jobStatuses {
+		key := []byte(getJobKey(s, id))
+		_, err := tx.Get(key)
+		if err == ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		return key, s, nil
+	}
+	return nil, 0, ErrKeyNotFound
+}
+
+// deleteJob deletes a job which isn't in progress
+func (q *queue) deleteJob(id uint64) error {
+	q.dbL.Lock()
+	defer q.dbL.Unlock()
+	return q.backend.Update(func(tx Tx) error {
+		key, status, err := findJobKey(tx, id)
+		if err != nil {
+			return err
+		}
+		if status == JobInProgress {
+			return fmt.Errorf("Cannot delete job %v with status %v: %w", id, status, ErrJobStatus)
+		}
+		j, err := getJobForKey(tx, key)
+		if err != nil {
+			return err
+		}
+		return deleteJobRecord(tx, j, status)
+	})
+}
+
+// requeueJob moves a complete or failed job back to pending
+func (q *queue) requeueJob(id uint64) error {
+	q.dbL.Lock()
+	defer q.dbL.Unlock()
+	return q.backend.Update(func(tx Tx) error {
+		key, status, err := findJobKey(tx, id)
+		if err != nil {
+			return err
+		}
+		if status != JobComplete && status != JobFailed {
+			return fmt.Errorf("Cannot requeue job %v with status %v: %w", id, status, ErrJobStatus)
+		}
+
+		j, err := getJobForKey(tx, key)
+		if err != nil {
+			return err
+		}
+		// the job starts over, with no attempts counted towards the retry policy
+		j.FinishedAt = time.Time{}
+		j.RunAt = time.Time{}
+		j.Attempts = 0
+		delete(j.Meta, panicMetaKey)
+		return q.moveJob(tx, j, status, JobPending, Transition{})
+	})
+}
@@ -0,0 +1,102 @@
+package blero
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlero_ListJobs(t *testing.T) {
+	bl := NewWithBackend(NewMemoryBackend())
+	err := bl.Start()
+	assert.NoError(t, err)
+	defer bl.Stop()
+
+	for i := 0; i < 5; i++ {
+		_, err := bl.EnqueueJob("TestJob", nil)
+		assert.NoError(t, err)
+	}
+	_, err = bl.LeaseJobs("worker-1", 1)
+	assert.NoError(t, err)
+
+	var ids []uint64
+	after := uint64(0)
+	for {
+		jobs, err := bl.ListJobs(ListOptions{Status: JobPending, After: after, Limit: 3})
+		assert.NoError(t, err)
+		if len(jobs) == 0 {
+			break
+		}
+		for _, j := range jobs {
+			ids = append(ids, j.ID)
+		}
+		after = jobs[len(jobs)-1].ID
+	}
+	assert.Equal(t, []uint64{2, 3, 4, 5}, ids)
+
+	jobs, err := bl.ListJobs(ListOptions{Status: JobInProgress})
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, uint64(1), jobs[0].ID)
+
+	jobs, err = bl.ListJobs(ListOptions{Status: JobComplete})
+	assert.NoError(t, err)
+	assert.NotNil(t, jobs)
+	assert.Len(t, jobs, 0)
+
+	counts, err := bl.CountJobs()
+	assert.NoError(t, err)
+	assert.Equal(t, map[JobStatus]int{JobPending: 4, JobInProgress: 1, JobComplete: 0, JobFailed: 0}, counts)
+}
+
+func TestBlero_DeleteRequeueJob(t *testing.T) {
+	bl := NewWithBackend(NewMemoryBackend())
+	err := bl.Start()
+	assert.NoError(t, err)
+	defer bl.Stop()
+
+	for i := 0; i < 2; i++ {
+		_, err := bl.EnqueueJob("TestJob", nil)
+		assert.NoError(t, err)
+	}
+	jobs, err := bl.LeaseJobs("worker-1", 1)
+	assert.NoError(t, err)
+
+	err = bl.DeleteJob(1)
+	assert.EqualError(t, err, "Cannot delete job 1 with status inprogress: Invalid job status")
+	assert.True(t, errors.Is(err, ErrJobStatus))
+	err = bl.RequeueJob(1)
+	assert.EqualError(t, err, "Cannot requeue job 1 with status inprogress: Invalid job status")
+
+	assert.NoError(t, bl.NackJobError(1, jobs[0].Attempts, &PanicError{Value: "boom", Stack: []byte("stack")}))
+	j, _, err := bl.GetJob(1)
+	assert.NoError(t, err)
+	assert.Equal(t, "stack", j.PanicStack())
+
+	// the requeued job starts over
+	assert.NoError(t, bl.RequeueJob(1))
+	j, status, err := bl.GetJob(1)
+	assert.NoError(t, err)
+	assert.Equal(t, JobPending, status)
+	assert.True(t, j.FinishedAt.IsZero())
+	assert.Equal(t, 0, j.Attempts)
+	assert.Equal(t, "", j.PanicStack())
+
+	assert.NoError(t, bl.DeleteJob(2))
+	_, _, err = bl.GetJob(2)
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Equal(t, ErrKeyNotFound, bl.DeleteJob(2))
+	assert.Equal(t, ErrKeyNotFound, bl.RequeueJob(2))
+}
+
+func TestParseJobStatus(t *testing.T) {
+	for _, s := range jobStatuses {
+		parsed, err := ParseJobStatus(s.String())
+		assert.NoError(t, err)
+		assert.Equal(t, s, parsed)
+	}
+
+	_, err := ParseJobStatus("done")
+	assert.EqualError(t, err, `Unknown job status "done"`)
+}
@@ -1,16 +1,16 @@
-// Code generated by "stringer -type jobStatus ."; DO NOT EDIT.
+// Code generated by "stringer -type JobStatus ."; DO NOT EDIT.
 
 package blero
 
 import "strconv"
 
-const _jobStatus_name = "pendinginprogresscompletefailed"
+const _JobStatus_name = "pendinginprogresscompletefailed"
 
-var _jobStatus_index = [...]uint8{0, 7, 17, 25, 31}
+var _JobStatus_index = [...]uint8{0, 7, 17, 25, 31}
 
-func (i jobStatus) String() string {
-	if i >= jobStatus(len(_jobStatus_index)-1) {
-		return "jobStatus(" + strconv.FormatInt(int64(i), 10) + ")"
+func (i JobStatus) String() string {
+	if i >= JobStatus(len(_JobStatus_index)-1) {
+		return "JobStatus(" + strconv.FormatInt(int64(i), 10) + ")"
 	}
-	return _jobStatus_name[_jobStatus_index[i]:_jobStatus_index[i+1]]
+	return _JobStatus_name[_JobStatus_index[i]:_JobStatus_index[i+1]]
 }
@@ -0,0 +1,101 @@
+package blero
+
+import (
+	"fmt"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxKeyLength is the max length in bytes of a job key
+const maxKeyLength = 255
+
+// keyPrefix is the prefix of the keys mapping a job key to the job ID
+const keyPrefix = "k:"
+
+// getKeyKey returns the key mapping a job key to the job ID
+func getKeyKey(key string) []byte {
+	return []byte(keyPrefix + key)
+}
+
+// validateKey checks a job key, keys can't be numbers so that a job can be looked up by either ID
+func validateKey(key string) error {
+	if len(key) > maxKeyLength {
+		return fmt.Errorf("Key cannot be longer than %v bytes, got %v", maxKeyLength, len(key))
+	}
+	if !utf8.ValidString(key) {
+		return fmt.Errorf("Key %q is not valid UTF-8", key)
+	}
+	for _, r := range key {
+		if !unicode.IsPrint(r) {
+			return fmt.Errorf("Key %q cannot contain non printable characters", key)
+		}
+	}
+	if _, err := strconv.ParseUint(key, 10, 64); err == nil {
+		return fmt.Errorf("Key %q cannot be a number, numbers are job IDs", key)
+	}
+	return nil
+}
+
+// getJobIDForKey returns the ID of the job with a key
+func getJobIDForKey(tx Tx, key string) (uint64, error) {
+	b, err := tx.Get(getKeyKey(key))
+	if err != nil {
+		return 0, err
+	}
+	id, err := strconv.ParseUint(string(b), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid job ID %q for key %q", b, key)
+	}
+	return id, nil
+}
+
+// setJobKey maps the key of a job to its ID, it returns the ID of the job which already has the key if any
+func setJobKey(tx Tx, j *Job) (uint64, error) {
+	id, err := getJobIDForKey(tx, j.Key)
+	if err == nil {
+		return id, nil
+	}
+	if err != ErrKeyNotFound {
+		return 0, err
+	}
+	return 0, tx.Set(getKeyKey(j.Key), []byte(jIDString(j.ID)))
+}
+
+// deleteJobKey deletes the mapping of the key of a job
+func deleteJobKey(tx Tx, j *Job) error {
+	if j.Key == "" {
+		return nil
+	}
+	err := tx.Delete(getKeyKey(j.Key))
+	if err != nil && err != ErrKeyNotFound {
+		return err
+	}
+	return nil
+}
+
+// getJobID returns the ID of the job with a key
+func (q *queue) getJobID(key string) (uint64, error) {
+	var id uint64
+	err := q.backend.View(func(tx Tx) error {
+		var err error
+		id, err = getJobIDForKey(tx, key)
+		return err
+	})
+	return id, err
+}
+
+// JobID returns the ID of the job enqueued with a key, see EnqueueOptions.Key
+// It returns ErrKeyNotFound when no job has the key
+func (bl *Blero) JobID(key string) (uint64, error) {
+	return bl.queue.getJobID(key)
+}
+
+// GetJobByKey fetches a job by its key from any status
+func (bl *Blero) GetJobByKey(key string) (*Job, JobStatus, error) {
+	id, err := bl.queue.getJobID(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	return bl.queue.getJob(id)
+}
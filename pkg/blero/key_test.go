@@ -0,0 +1,97 @@
+package blero
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlero_EnqueueJobKey(t *testing.T) {
+	bl := NewWithBackend(NewMemoryBackend())
+	assert.NoError(t, bl.Start())
+	defer bl.Stop()
+	ctx := t.Context()
+
+	id, err := bl.EnqueueJobOptions(ctx, "TestJob", []byte("data"), EnqueueOptions{Key: "order-42"})
+	assert.NoError(t, err)
+
+	// enqueuing with the same key returns the existing job
+	again, err := bl.EnqueueJobOptions(ctx, "TestJob", []byte("other"), EnqueueOptions{Key: "order-42"})
+	assert.NoError(t, err)
+	assert.Equal(t, id, again)
+	counts, err := bl.CountJobs()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, counts[JobPending])
+
+	// numeric IDs are still assigned
+	other, err := bl.EnqueueJob("TestJob", nil)
+	assert.NoError(t, err)
+	assert.Greater(t, other, id)
+
+	got, err := bl.JobID("order-42")
+	assert.NoError(t, err)
+	assert.Equal(t, id, got)
+	j, status, err := bl.GetJobByKey("order-42")
+	assert.NoError(t, err)
+	assert.Equal(t, JobPending, status)
+	assert.Equal(t, "order-42", j.Key)
+	assert.Equal(t, []byte("data"), j.Data)
+	_, err = bl.JobID("unknown")
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// the key is freed along with the job
+	assert.NoError(t, bl.DeleteJob(id))
+	_, _, err = bl.GetJobByKey("order-42")
+	assert.Equal(t, ErrKeyNotFound, err)
+	again, err = bl.EnqueueJobOptions(ctx, "TestJob", nil, EnqueueOptions{Key: "order-42"})
+	assert.NoError(t, err)
+	assert.NotEqual(t, id, again)
+}
+
+func TestBlero_EnqueueJobKeyConcurrent(t *testing.T) {
+	opts := DefaultOptions("")
+	opts.Backend = NewMemoryBackend()
+	opts.BlobThreshold = 16
+	bl, err := NewWithOptions(opts)
+	assert.NoError(t, err)
+	assert.NoError(t, bl.Start())
+	defer bl.Stop()
+
+	var wg sync.WaitGroup
+	ids := make([]uint64, 10)
+	for i := range ids {
+		wg.Go(func() {
+			var err error
+			ids[i], err = bl.EnqueueJobOptions(t.Context(), "TestJob", []byte(strings.Repeat("x", 64)), EnqueueOptions{Key: "retried", Compression: CompressionNone})
+			assert.NoError(t, err)
+		})
+	}
+	wg.Wait()
+
+	for _, id := range ids {
+		assert.Equal(t, ids[0], id)
+	}
+	counts, err := bl.CountJobs()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, counts[JobPending])
+	// only the blob of the stored job is left
+	assert.Equal(t, 1, countIndexEntries(t, bl.queue, "b:"))
+}
+
+func TestValidateKey(t *testing.T) {
+	assert.NoError(t, validateKey(""))
+	assert.NoError(t, validateKey("order-42"))
+	assert.NoError(t, validateKey("42a"))
+	assert.EqualError(t, validateKey("42"), `Key "42" cannot be a number, numbers are job IDs`)
+	assert.EqualError(t, validateKey("a\nb"), `Key "a\nb" cannot contain non printable characters`)
+	assert.EqualError(t, validateKey("\xff"), `Key "\xff" is not valid UTF-8`)
+	assert.EqualError(t, validateKey(strings.Repeat("a", 256)), "Key cannot be longer than 255 bytes, got 256")
+
+	bl := NewWithBackend(NewMemoryBackend())
+	assert.NoError(t, bl.Start())
+	defer bl.Stop()
+	_, err := bl.EnqueueJobOptions(t.Context(), "TestJob", nil, EnqueueOptions{Key: "42"})
+	assert.ErrorIs(t, err, ErrInvalidEnqueueOptions)
+}
@@ -0,0 +1,175 @@
+package blero
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// ErrLeaseLost is returned when the lease of a job attempt expired and the job was reaped
+var ErrLeaseLost = errors.New("Job lease lost")
+
+// localLeaseOwner is the lease owner of the jobs run by the registered processors
+const localLeaseOwner = "local"
+
+// reapBatchSize is the max number of in-progress jobs checked per reap transaction
+const reapBatchSize = 1000
+
+// leaseExpiry returns the expiry of a lease taken or extended now, zero when leases don't expire
+func (q *queue) leaseExpiry() time.Time {
+	if q.opts.LeaseTimeout <= 0 {
+		return time.Time{}
+	}
+	return timeNow().Add(q.opts.LeaseTimeout)
+}
+
+// extendLease extends the lease of an in-progress job attempt and returns the new expiry
+// It returns ErrLeaseLost if the attempt isn't in progress anymore
+func (q *queue) extendLease(id uint64, attempt int) (time.Time, error) {
+	key := []byte(getJobKey(JobInProgress, id))
+	var expiresAt time.Time
+
+	q.dbL.Lock()
+	defer q.dbL.Unlock()
+	err := q.backend.Update(func(tx Tx) error {
+		j, err := getJobForKey(tx, key)
+		if err == ErrKeyNotFound {
+			return ErrLeaseLost
+		}
+		if err != nil {
+			return err
+		}
+		if j.Attempts != attempt {
+			return ErrLeaseLost
+		}
+
+		j.LeaseExpiresAt = q.leaseExpiry()
+		b, err := encodeJob(q.opts.Codec, j)
+		if err != nil {
+			return err
+		}
+		expiresAt = j.LeaseExpiresAt
+		return tx.Set(key, b)
+	})
+
+	return expiresAt, err
+}
+
+// startReapLoop periodically returns the in-progress jobs with expired leases to pending
+func (q *queue) startReapLoop() {
+	go func() {
+		ticker := time.NewTicker(q.opts.ReapInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				n, err := q.reapLeases(timeNow())
+				if err != nil {
+					q.opts.Logger.Error("Cannot reap leases", "error", err)
+				} else if n > 0 {
+					q.opts.Logger.Warn("Reaped expired leases", "count", n)
+				}
+			case <-q.quitCh: // queue was stopped
+				return
+			}
+		}
+	}()
+}
+
+// reapLeases returns the in-progress jobs whose lease expired before t to pending and returns the number of reaped jobs
+// The expired attempt counts as failed, jobs are retried after the RetryPolicy backoff or moved to failed once they reached MaxAttempts
+// Jobs leased before leases were recorded have a zero LeaseExpiresAt and are always reaped
+func (q *queue) reapLeases(before time.Time) (int, error) {
+	total, requeued := 0, 0
+	prefix := []byte(getQueueKeyPrefix(JobInProgress))
+
+	var cursor []byte
+	done := false
+	for !done {
+		q.dbL.Lock()
+		err := q.backend.Update(func(tx Tx) error {
+			n := 0
+			done = true
+			return tx.Iterate(prefix, cursor, func(k, v []byte) (bool, error) {
+				if n == reapBatchSize {
+					// resume from this key in the next batch
+					cursor = k
+					done = false
+					return false, nil
+				}
+				n++
+
+				j, err := decodeJob(v)
+				if err != nil {
+					return false, err
+				}
+				if !j.LeaseExpiresAt.Before(before) {
+					return true, nil
+				}
+
+				res := q.opts.RetryPolicy.expiredAttempt(j.Attempts)
+				status := res.status
+				if status == JobFailed {
+					j.FinishedAt = timeNow()
+				} else {
+					j.RunAt = res.runAt
+				}
+				q.opts.Logger.Debug("Job lease expired", "job_id", j.ID, "job_name", j.Name,
+					"attempt", j.Attempts, "lease_owner", j.LeaseOwner, "status", status.String())
+
+				t := Transition{LeaseOwner: j.LeaseOwner, Error: "Lease expired"}
+				j.LeaseOwner = ""
+				j.LeaseExpiresAt = time.Time{}
+
+				total++
+				if status == JobPending {
+					requeued++
+				}
+				return true, q.moveJob(tx, j, JobInProgress, status, t)
+			})
+		})
+		q.dbL.Unlock()
+		if err != nil {
+			return total, err
+		}
+	}
+
+	// signal that jobs are pending again
+	if requeued > 0 && q.requeued != nil {
+		q.requeued()
+	}
+
+	return total, nil
+}
+
+// startHeartbeat extends the lease of a running job every HeartbeatInterval until the returned func is called
+func (d *dispatcher) startHeartbeat(q *queue, j *Job, logger *slog.Logger) func() {
+	if q.opts.LeaseTimeout <= 0 {
+		return func() {}
+	}
+
+	stopCh := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(d.opts.HeartbeatInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				_, err := q.extendLease(j.ID, j.Attempts)
+				if err == ErrLeaseLost {
+					logger.Warn("Job lease lost")
+					return
+				}
+				if err != nil {
+					logger.Error("Cannot extend job lease", "error", err)
+				}
+			case <-stopCh: // job is done
+				return
+			}
+		}
+	}()
+
+	return func() { close(stopCh) }
+}
@@ -0,0 +1,245 @@
+package blero
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlero_ExtendLease(t *testing.T) {
+	bl := NewWithBackend(NewMemoryBackend())
+	err := bl.Start()
+	assert.NoError(t, err)
+	defer bl.Stop()
+
+	q := bl.queue
+
+	defer func(f func() time.Time) { timeNow = f }(timeNow)
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return start }
+
+	jID, err := q.enqueueJob(&Job{Name: "TestJob"})
+	assert.NoError(t, err)
+	jobs, err := q.dequeueJobs(1, "worker-1", nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "worker-1", jobs[0].LeaseOwner)
+	assert.Equal(t, start.Add(30*time.Second), jobs[0].LeaseExpiresAt)
+
+	timeNow = func() time.Time { return start.Add(20 * time.Second) }
+	expiresAt, err := q.extendLease(jID, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, start.Add(50*time.Second), expiresAt)
+
+	j, _, err := q.getJob(jID)
+	assert.NoError(t, err)
+	assert.Equal(t, expiresAt, j.LeaseExpiresAt)
+
+	// another attempt holds the lease
+	_, err = q.extendLease(jID, 2)
+	assert.Equal(t, ErrLeaseLost, err)
+	assert.Equal(t, ErrLeaseLost, q.finishLease(jID, 2, attemptResult{status: JobComplete}))
+
+	// the lease is cleared when the job is done
+	assert.NoError(t, q.finishLease(jID, 1, attemptResult{status: JobComplete}))
+	j, status, err := q.getJob(jID)
+	assert.NoError(t, err)
+	assert.Equal(t, JobComplete, status)
+	assert.Equal(t, "", j.LeaseOwner)
+	assert.True(t, j.LeaseExpiresAt.IsZero())
+
+	_, err = q.extendLease(jID, 1)
+	assert.Equal(t, ErrLeaseLost, err)
+	assert.Equal(t, ErrLeaseLost, q.finishLease(jID, 1, attemptResult{status: JobComplete}))
+}
+
+func TestBlero_ReapLeases(t *testing.T) {
+	opts := DefaultOptions("")
+	opts.Backend = NewMemoryBackend()
+	opts.RetryPolicy = RetryPolicy{MaxAttempts: 2, Backoff: 10 * time.Second}
+	bl, err := NewWithOptions(opts)
+	assert.NoError(t, err)
+	err = bl.Start()
+	assert.NoError(t, err)
+	defer bl.Stop()
+
+	q := bl.queue
+	requeued := 0
+	q.requeued = func() { requeued++ }
+
+	defer func(f func() time.Time) { timeNow = f }(timeNow)
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return start }
+
+	for i := 0; i < 2; i++ {
+		_, err := q.enqueueJob(&Job{Name: "TestJob"})
+		assert.NoError(t, err)
+	}
+	_, err = q.dequeueJobs(2, "worker-1", nil, nil)
+	assert.NoError(t, err)
+
+	// job 2 keeps its lease with a heartbeat
+	timeNow = func() time.Time { return start.Add(20 * time.Second) }
+	_, err = q.extendLease(2, 1)
+	assert.NoError(t, err)
+
+	n, err := q.reapLeases(start.Add(40 * time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 1, requeued)
+
+	j, status, err := q.getJob(1)
+	assert.NoError(t, err)
+	assert.Equal(t, JobPending, status)
+	assert.Equal(t, 1, j.Attempts)
+	assert.Equal(t, "", j.LeaseOwner)
+	assert.True(t, j.LeaseExpiresAt.IsZero())
+	// the expired attempt is retried after the backoff
+	assert.Equal(t, start.Add(30*time.Second), j.RunAt)
+	_, status, err = q.getJob(2)
+	assert.NoError(t, err)
+	assert.Equal(t, JobInProgress, status)
+
+	// the reaped attempt cannot finish the job
+	assert.Equal(t, ErrLeaseLost, q.finishLease(1, 1, attemptResult{status: JobComplete}))
+
+	// the second expired attempt reaches MaxAttempts
+	timeNow = func() time.Time { return start.Add(30 * time.Second) }
+	jobs, err := q.dequeueJobs(1, "worker-2", nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, jobs[0].Attempts)
+	n, err = q.reapLeases(start.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 2, requeued)
+
+	j, status, err = q.getJob(1)
+	assert.NoError(t, err)
+	assert.Equal(t, JobFailed, status)
+	assert.Equal(t, start.Add(30*time.Second), j.FinishedAt)
+	j, status, err = q.getJob(2)
+	assert.NoError(t, err)
+	assert.Equal(t, JobPending, status)
+	assert.Equal(t, start.Add(40*time.Second), j.RunAt)
+}
+
+func TestBlero_LeaseHeartbeats(t *testing.T) {
+	// the clock is only moved by the test, the heartbeats run on their ticker
+	defer func(f func() time.Time) { timeNow = f }(timeNow)
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	var elapsed atomic.Int64
+	timeNow = func() time.Time { return start.Add(time.Duration(elapsed.Load())) }
+
+	opts := DefaultOptions("")
+	opts.Backend = NewMemoryBackend()
+	opts.LeaseTimeout = time.Minute
+	opts.HeartbeatInterval = 5 * time.Millisecond
+	// leases are reaped by the test
+	opts.ReapInterval = time.Hour
+	bl, err := NewWithOptions(opts)
+	assert.NoError(t, err)
+	err = bl.Start()
+	assert.NoError(t, err)
+	defer bl.Stop()
+	q := bl.queue
+
+	// a job leased by a lost worker is reaped and processed again
+	lostID, err := bl.EnqueueJob("LostJob", nil)
+	assert.NoError(t, err)
+	_, err = q.dequeueJobs(1, "lost-worker", nil, nil)
+	assert.NoError(t, err)
+
+	// a running job keeps its lease past the lease timeout
+	slowID, err := bl.EnqueueJob("SlowJob", nil)
+	assert.NoError(t, err)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	attempts := make(chan int, 10)
+	bl.RegisterProcessorConcurrency(ProcessorFunc(func(j *Job) error {
+		if j.Name == "SlowJob" {
+			close(started)
+			<-release
+		}
+		attempts <- j.Attempts
+		return nil
+	}), 2)
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("slow job not started")
+	}
+
+	// the heartbeats extend the lease from the current time
+	elapsed.Store(int64(50 * time.Second))
+	assert.Eventually(t, func() bool {
+		j, _, err := q.getJob(slowID)
+		return err == nil && j.LeaseExpiresAt.Equal(start.Add(110*time.Second))
+	}, time.Second, 5*time.Millisecond)
+
+	elapsed.Store(int64(90 * time.Second))
+	n, err := q.reapLeases(timeNow())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.NoError(t, bl.dispatcher.assignJobs(q))
+	select {
+	case attempt := <-attempts:
+		assert.Equal(t, 2, attempt)
+	case <-time.After(time.Second):
+		t.Fatal("lost job not processed again")
+	}
+
+	close(release)
+	select {
+	case attempt := <-attempts:
+		assert.Equal(t, 1, attempt)
+	case <-time.After(time.Second):
+		t.Fatal("slow job not done")
+	}
+
+	for _, jID := range []uint64{lostID, slowID} {
+		assert.Eventually(t, func() bool {
+			_, status, err := q.getJob(jID)
+			return err == nil && status == JobComplete
+		}, time.Second, 5*time.Millisecond)
+	}
+}
+
+func TestBlero_LeaseJobs(t *testing.T) {
+	bl := NewWithBackend(NewMemoryBackend())
+	err := bl.Start()
+	assert.NoError(t, err)
+	defer bl.Stop()
+
+	for i := 0; i < 3; i++ {
+		_, err := bl.EnqueueJob("TestJob", nil)
+		assert.NoError(t, err)
+	}
+
+	_, err = bl.LeaseJobs("", 1)
+	assert.EqualError(t, err, "Lease owner is required")
+	_, err = bl.LeaseJobs("worker-1", 0)
+	assert.EqualError(t, err, "Max must be at least 1, got 0")
+
+	jobs, err := bl.LeaseJobs("worker-1", 2)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 2)
+
+	expiresAt, err := bl.ExtendLease(jobs[0].ID, jobs[0].Attempts)
+	assert.NoError(t, err)
+	assert.False(t, expiresAt.IsZero())
+
+	assert.NoError(t, bl.AckJob(jobs[0].ID, jobs[0].Attempts))
+	assert.NoError(t, bl.NackJob(jobs[1].ID, jobs[1].Attempts))
+	assert.Equal(t, ErrLeaseLost, bl.AckJob(jobs[1].ID, jobs[1].Attempts))
+	assert.EqualError(t, bl.AckJob(jobs[1].ID, 0), "Attempt must be at least 1, got 0")
+	assert.EqualError(t, bl.NackJob(jobs[1].ID, 0), "Attempt must be at least 1, got 0")
+
+	_, status, err := bl.GetJob(jobs[0].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, JobComplete, status)
+	_, status, err = bl.GetJob(jobs[1].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, JobFailed, status)
+}
@@ -0,0 +1,181 @@
+package blero
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// formatVersion is the on-disk format version written by this version of Blero
+// 0: original layout, raw gob records
+// 1: records prefixed with a codec header
+// 2: secondary indexes by name, enqueue time and status change time
+// 3: records with compressed data
+// 4: records whose data is stored in blob chunks
+// 5: history entries numbered from a per job counter
+// 6: dispatch indexes of the pending jobs
+const formatVersion uint64 = 6
+
+// migrationBatchSize is the max number of records rewritten per migration transaction
+const migrationBatchSize = 1000
+
+// ErrNewerFormat is returned by Start when the database was written by a newer version of Blero
+var ErrNewerFormat = errors.New("Database format is newer than supported")
+
+// meta keys
+var formatVersionKey = []byte("m:version")
+
+func getMigrationCursorKey(version uint64) []byte {
+	return []byte(fmt.Sprintf("m:migration:%v", version))
+}
+
+// migration upgrades the database from version-1 to version
+type migration struct {
+	version uint64
+	name    string
+	// batch migrates up to batchSize records starting at cursor
+	// it returns the cursor to resume from, or nil when the migration is done
+	batch func(q *queue, tx Tx, cursor []byte, batchSize int) ([]byte, error)
+}
+
+// migrations in version order
+var migrations = []migration{
+	{version: 1, name: "codec headers", batch: migrateCodecHeaders},
+	{version: 2, name: "secondary indexes", batch: indexJobs},
+	{version: 3, name: "compressed records", batch: bumpFormatVersion},
+	{version: 4, name: "blob records", batch: bumpFormatVersion},
+	{version: 5, name: "history counters", batch: migrateHistoryKeys},
+	{version: 6, name: "dispatch indexes", batch: indexPendingJobs},
+}
+
+// bumpFormatVersion rewrites nothing, it marks a format change so that older versions refuse the records they can't read
+func bumpFormatVersion(q *queue, tx Tx, cursor []byte, batchSize int) ([]byte, error) {
+	return nil, nil
+}
+
+// migrate upgrades the database to formatVersion
+// Each batch is committed along with its cursor so an interrupted migration resumes where it stopped
+func (q *queue) migrate() error {
+	version, err := q.getFormatVersion()
+	if err != nil {
+		return err
+	}
+	if version > formatVersion {
+		return fmt.Errorf("%w: found version %v, this version of Blero supports up to %v", ErrNewerFormat, version, formatVersion)
+	}
+
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+
+		err := q.runMigration(m)
+		if err != nil {
+			return fmt.Errorf("Migration %v (%v) failed: %w", m.version, m.name, err)
+		}
+	}
+
+	return nil
+}
+
+// getFormatVersion reads the stored format version
+// A database without a version key is either new, and gets the current version, or written before versioning
+func (q *queue) getFormatVersion() (uint64, error) {
+	var version uint64
+	err := q.backend.Update(func(tx Tx) error {
+		b, err := tx.Get(formatVersionKey)
+		if err == nil {
+			version = binary.BigEndian.Uint64(b)
+			return nil
+		}
+		if err != ErrKeyNotFound {
+			return err
+		}
+
+		k, _, err := getFirstKVForPrefix(tx, []byte("q:"))
+		if err != nil {
+			return err
+		}
+		// jobs found, the database predates versioning
+		if k != nil {
+			version = 0
+			return nil
+		}
+
+		version = formatVersion
+		return setFormatVersion(tx, version)
+	})
+
+	return version, err
+}
+
+func setFormatVersion(tx Tx, version uint64) error {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, version)
+	return tx.Set(formatVersionKey, b)
+}
+
+// runMigration runs a migration batch by batch until done then stores the new version
+func (q *queue) runMigration(m migration) error {
+	cursorKey := getMigrationCursorKey(m.version)
+
+	done := false
+	for !done {
+		err := q.backend.Update(func(tx Tx) error {
+			cursor, err := tx.Get(cursorKey)
+			if err != nil && err != ErrKeyNotFound {
+				return err
+			}
+
+			next, err := m.batch(q, tx, cursor, migrationBatchSize)
+			if err != nil {
+				return err
+			}
+
+			if next != nil {
+				return tx.Set(cursorKey, next)
+			}
+
+			done = true
+			err = tx.Delete(cursorKey)
+			if err != nil {
+				return err
+			}
+			return setFormatVersion(tx, m.version)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateCodecHeaders re-encodes legacy gob records with the configured codec
+func migrateCodecHeaders(q *queue, tx Tx, cursor []byte, batchSize int) ([]byte, error) {
+	var next []byte
+	n := 0
+	err := tx.Iterate([]byte("q:"), cursor, func(k, v []byte) (bool, error) {
+		if n == batchSize {
+			// resume from this key in the next batch
+			next = k
+			return false, nil
+		}
+		if hasCodecHeader(v) {
+			return true, nil
+		}
+
+		j, err := decodeJob(v)
+		if err != nil {
+			return false, fmt.Errorf("Cannot decode legacy record %s: %v", k, err)
+		}
+		b, err := encodeJob(q.opts.Codec, j)
+		if err != nil {
+			return false, err
+		}
+		n++
+		return true, tx.Set(k, b)
+	})
+
+	return next, err
+}
@@ -0,0 +1,156 @@
+package blero
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// openTestBadger opens the test db directly, bypassing Blero
+func openTestBadger(t *testing.T) *badger.DB {
+	badgerOpts := badger.DefaultOptions(testDBPath)
+	badgerOpts.Logger = &badgerLogger{logger: slog.New(slog.DiscardHandler)}
+	db, err := badger.Open(badgerOpts)
+	assert.NoError(t, err)
+	return db
+}
+
+func TestBlero_FormatVersionNewDB(t *testing.T) {
+	bl := New(testDBPath)
+	err := bl.Start()
+	assert.NoError(t, err)
+
+	// stop gracefully
+	defer deleteDBFolder(testDBPath)
+	defer bl.Stop()
+
+	version, err := bl.queue.getFormatVersion()
+	assert.NoError(t, err)
+	assert.Equal(t, formatVersion, version)
+}
+
+func TestBlero_MigrateLegacyDB(t *testing.T) {
+	// write a pre versioning database with raw gob records
+	db := openTestBadger(t)
+	err := db.Update(func(txn *badger.Txn) error {
+		for id := uint64(1); id <= 5; id++ {
+			b, err := GobCodec{}.Marshal(&Job{ID: id, Name: "LegacyJob"})
+			assert.NoError(t, err)
+			err = txn.Set([]byte(getJobKey(JobPending, id)), b)
+			assert.NoError(t, err)
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, db.Close())
+
+	bl := New(testDBPath)
+	err = bl.Start()
+	assert.NoError(t, err)
+
+	// stop gracefully
+	defer deleteDBFolder(testDBPath)
+	defer bl.Stop()
+
+	q := bl.queue
+
+	version, err := q.getFormatVersion()
+	assert.NoError(t, err)
+	assert.Equal(t, formatVersion, version)
+
+	err = q.backend.View(func(tx Tx) error {
+		for id := uint64(1); id <= 5; id++ {
+			b, err := tx.Get([]byte(getJobKey(JobPending, id)))
+			assert.NoError(t, err)
+			assert.True(t, hasCodecHeader(b))
+			assert.Equal(t, binaryCodecID, b[1])
+
+			j, err := decodeJob(b)
+			assert.NoError(t, err)
+			assert.Equal(t, id, j.ID)
+			assert.Equal(t, "LegacyJob", j.Name)
+		}
+
+		// cursor was cleaned up
+		_, err := tx.Get(getMigrationCursorKey(1))
+		assert.Equal(t, ErrKeyNotFound, err)
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestBlero_MigrateResumes(t *testing.T) {
+	bl := New(testDBPath)
+	err := bl.Start()
+	assert.NoError(t, err)
+
+	// stop gracefully
+	defer deleteDBFolder(testDBPath)
+	defer bl.Stop()
+
+	q := bl.queue
+
+	// add a test migration which fails on its second batch
+	defer func(m []migration) { migrations = m }(migrations)
+	var cursors []string
+	fail := true
+	migrations = append(migrations, migration{
+		version: formatVersion + 1,
+		name:    "test",
+		batch: func(q *queue, tx Tx, cursor []byte, batchSize int) ([]byte, error) {
+			cursors = append(cursors, string(cursor))
+			switch string(cursor) {
+			case "":
+				return []byte("a"), nil
+			case "a":
+				if fail {
+					fail = false
+					return nil, errors.New("interrupted")
+				}
+				return []byte("b"), nil
+			}
+			return nil, nil
+		},
+	})
+
+	err = q.migrate()
+	assert.EqualError(t, err, fmt.Sprintf("Migration %v (test) failed: interrupted", formatVersion+1))
+
+	version, err := q.getFormatVersion()
+	assert.NoError(t, err)
+	assert.Equal(t, formatVersion, version)
+
+	err = q.migrate()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"", "a", "a", "b"}, cursors)
+
+	version, err = q.getFormatVersion()
+	assert.NoError(t, err)
+	assert.Equal(t, formatVersion+1, version)
+}
+
+func TestBlero_StartNewerFormat(t *testing.T) {
+	db := openTestBadger(t)
+	err := db.Update(func(txn *badger.Txn) error {
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, formatVersion+1)
+		return txn.Set(formatVersionKey, b)
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, db.Close())
+	defer deleteDBFolder(testDBPath)
+
+	bl := New(testDBPath)
+	err = bl.Start()
+	assert.True(t, errors.Is(err, ErrNewerFormat))
+	assert.EqualError(t, err, fmt.Sprintf("Database format is newer than supported: found version %v, this version of Blero supports up to %v", formatVersion+1, formatVersion))
+
+	// the db was released
+	db = openTestBadger(t)
+	assert.NoError(t, db.Close())
+}
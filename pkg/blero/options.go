@@ -0,0 +1,263 @@
+package blero
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Options configures Blero
+type Options struct {
+	// DBPath is the badger db directory, required unless Backend or BadgerDB is set
+	DBPath string
+	// Backend replaces the default badger db opened at DBPath
+	Backend Backend
+	// BadgerDB is an open badger db shared with the application, used instead of opening a db at DBPath
+	// Blero doesn't close it, see EnqueueJobTxn to enqueue jobs in the application transactions
+	BadgerDB *badger.DB
+	// Namespace prefixes the keys written by Blero, so that they don't clash with the other keys of a shared db
+	Namespace string
+	// SyncWrites syncs each badger write to disk before returning
+	SyncWrites bool
+	// SequenceBandwidth is the number of job IDs leased at once from the backend
+	SequenceBandwidth uint64
+	// EncryptionKey enables the badger encryption at rest with AES-128, AES-192 or AES-256 for a 16, 24 or 32 bytes key
+	// Opening a db with another key fails with ErrEncryptionKeyMismatch, see RotateEncryptionKey to change the key
+	EncryptionKey []byte
+	// EncryptionKeyRotation is how often badger rotates the data keys encrypted with EncryptionKey
+	EncryptionKeyRotation time.Duration
+	// IndexCacheSize is the badger index cache size in bytes, 0 disables the cache unless encryption is enabled,
+	// in which case 100MB are used since encrypted table indexes would be decrypted on each access otherwise
+	IndexCacheSize int64
+	// Logger receives the Blero and badger logs
+	// When nil, a text logger writing to stderr at LogLevel is used
+	Logger *slog.Logger
+	// LogLevel is the minimum level of the default logger
+	LogLevel slog.Leveler
+	// DispatchBatchSize is the max number of pending jobs leased per transaction when assigning jobs to processors
+	DispatchBatchSize int
+	// Codec encodes new job records, records written with other registered codecs remain readable
+	Codec Codec
+	// Compression is used for the data of jobs over CompressionThreshold unless another compression is set per job,
+	// CompressionDefault is zstd
+	Compression Compression
+	// CompressionThreshold is the min data size in bytes compressed by default, 0 only compresses jobs which ask for it
+	CompressionThreshold int
+	// BlobThreshold is the min size in bytes of the data, after compression, stored once in a separate blob key space
+	// instead of the job record so that status transitions don't rewrite it, 0 stores all data in the job records
+	BlobThreshold int
+	// BlobChunkSize is the max size in bytes of the blob chunks, each chunk is written in its own transaction
+	BlobChunkSize int
+	// Retention is how long complete and failed jobs are kept, 0 keeps them forever
+	Retention time.Duration
+	// SweepInterval is how often jobs past their retention are deleted
+	SweepInterval time.Duration
+	// TracerProvider creates the enqueue, queue wait and processing spans, defaults to the global provider
+	TracerProvider trace.TracerProvider
+	// Propagator stores span contexts in the job metadata, defaults to W3C trace context
+	Propagator propagation.TextMapPropagator
+	// RateLimits limits how often jobs are started per job name, see Blero.SetRateLimit to change them at runtime
+	RateLimits map[string]RateLimit
+	// ConcurrencyCaps is the max number of jobs running at once per job name, regardless of the number of processors
+	ConcurrencyCaps map[string]int
+	// LeaseTimeout is how long a job stays in progress without a heartbeat before it's returned to pending, 0 disables leases
+	LeaseTimeout time.Duration
+	// HeartbeatInterval is how often the leases of running jobs are extended, it must be lower than LeaseTimeout
+	HeartbeatInterval time.Duration
+	// ReapInterval is how often expired leases are returned to pending
+	ReapInterval time.Duration
+	// RetryPolicy retries the jobs whose processor returned an error or whose lease expired
+	// The zero value only retries the jobs returning RetryAfter or Snooze and requeues expired jobs without limit
+	// Processors can override it with the Permanent, RetryAfter and Snooze errors
+	RetryPolicy RetryPolicy
+	// PanicHandler is called after a processor panic failed a job, for example to report it, the stack trace is also kept in Job.PanicStack
+	PanicHandler func(j *Job, err *PanicError)
+}
+
+// badger encryption defaults
+const (
+	defaultEncryptionKeyRotation = 10 * 24 * time.Hour
+	defaultIndexCacheSize        = 100 << 20
+)
+
+// DefaultOptions returns the default options for a badger db at dbPath
+func DefaultOptions(dbPath string) Options {
+	return Options{
+		DBPath:                dbPath,
+		SyncWrites:            true,
+		SequenceBandwidth:     1000,
+		EncryptionKeyRotation: defaultEncryptionKeyRotation,
+		LogLevel:              slog.LevelInfo,
+		DispatchBatchSize:     100,
+		Codec:                 BinaryCodec{},
+		Compression:           CompressionZstd,
+		BlobThreshold:         64 << 10,
+		BlobChunkSize:         1 << 20,
+		SweepInterval:         time.Minute,
+		LeaseTimeout:          30 * time.Second,
+		HeartbeatInterval:     10 * time.Second,
+		ReapInterval:          10 * time.Second,
+	}
+}
+
+// validate checks the options and reports all invalid values
+func (opts Options) validate() error {
+	var errs []error
+
+	if opts.DBPath == "" && opts.Backend == nil && opts.BadgerDB == nil {
+		errs = append(errs, errors.New("DBPath is required"))
+	}
+	if opts.BadgerDB != nil && (opts.DBPath != "" || opts.Backend != nil) {
+		errs = append(errs, errors.New("BadgerDB cannot be set along with DBPath or Backend"))
+	}
+	if opts.SequenceBandwidth == 0 {
+		errs = append(errs, errors.New("SequenceBandwidth must be greater than 0"))
+	}
+	if opts.EncryptionKey != nil {
+		err := validateEncryptionKey(opts.EncryptionKey)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if opts.Backend != nil || opts.BadgerDB != nil {
+			errs = append(errs, errors.New("EncryptionKey is only supported by the default badger backend"))
+		}
+		if opts.EncryptionKeyRotation <= 0 {
+			errs = append(errs, fmt.Errorf("EncryptionKeyRotation must be greater than 0 when EncryptionKey is set, got %v", opts.EncryptionKeyRotation))
+		}
+	}
+	if opts.IndexCacheSize < 0 {
+		errs = append(errs, fmt.Errorf("IndexCacheSize cannot be negative, got %v", opts.IndexCacheSize))
+	}
+	if opts.DispatchBatchSize <= 0 {
+		errs = append(errs, fmt.Errorf("DispatchBatchSize must be greater than 0, got %v", opts.DispatchBatchSize))
+	}
+	if opts.Codec == nil {
+		errs = append(errs, errors.New("Codec is required"))
+	} else if _, err := getCodec(opts.Codec.ID()); err != nil {
+		errs = append(errs, fmt.Errorf("Codec %v is not registered, see RegisterCodec", opts.Codec.ID()))
+	}
+	if err := opts.Compression.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if opts.CompressionThreshold < 0 {
+		errs = append(errs, fmt.Errorf("CompressionThreshold cannot be negative, got %v", opts.CompressionThreshold))
+	}
+	if opts.BlobThreshold < 0 {
+		errs = append(errs, fmt.Errorf("BlobThreshold cannot be negative, got %v", opts.BlobThreshold))
+	}
+	if opts.BlobThreshold > 0 && opts.BlobChunkSize <= 0 {
+		errs = append(errs, fmt.Errorf("BlobChunkSize must be greater than 0 when BlobThreshold is set, got %v", opts.BlobChunkSize))
+	}
+	if opts.Retention < 0 {
+		errs = append(errs, fmt.Errorf("Retention cannot be negative, got %v", opts.Retention))
+	}
+	if opts.Retention > 0 && opts.SweepInterval <= 0 {
+		errs = append(errs, fmt.Errorf("SweepInterval must be greater than 0 when Retention is set, got %v", opts.SweepInterval))
+	}
+	if opts.LeaseTimeout < 0 {
+		errs = append(errs, fmt.Errorf("LeaseTimeout cannot be negative, got %v", opts.LeaseTimeout))
+	}
+	if opts.LeaseTimeout > 0 {
+		if opts.HeartbeatInterval <= 0 || opts.HeartbeatInterval >= opts.LeaseTimeout {
+			errs = append(errs, fmt.Errorf("HeartbeatInterval must be greater than 0 and lower than LeaseTimeout, got %v", opts.HeartbeatInterval))
+		}
+		if opts.ReapInterval <= 0 {
+			errs = append(errs, fmt.Errorf("ReapInterval must be greater than 0 when LeaseTimeout is set, got %v", opts.ReapInterval))
+		}
+	}
+	if err := opts.RetryPolicy.validate(); err != nil {
+		errs = append(errs, fmt.Errorf("RetryPolicy: %w", err))
+	}
+	for _, name := range sortedKeys(opts.RateLimits) {
+		err := opts.RateLimits[name].validate()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("RateLimits[%v]: %w", name, err))
+		}
+	}
+	for _, name := range sortedKeys(opts.ConcurrencyCaps) {
+		err := validateConcurrency(opts.ConcurrencyCaps[name])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ConcurrencyCaps[%v]: %w", name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// queueOpts converts the options to queue options
+func (opts Options) queueOpts() queueOpts {
+	return queueOpts{
+		DBPath:                opts.DBPath,
+		Logger:                opts.logger(),
+		Codec:                 opts.Codec,
+		Compression:           opts.Compression,
+		CompressionThreshold:  opts.CompressionThreshold,
+		BlobThreshold:         opts.BlobThreshold,
+		BlobChunkSize:         opts.BlobChunkSize,
+		Backend:               opts.Backend,
+		BadgerDB:              opts.BadgerDB,
+		Namespace:             opts.Namespace,
+		SyncWrites:            opts.SyncWrites,
+		SequenceBandwidth:     opts.SequenceBandwidth,
+		EncryptionKey:         opts.EncryptionKey,
+		EncryptionKeyRotation: opts.EncryptionKeyRotation,
+		IndexCacheSize:        opts.IndexCacheSize,
+		Retention:             opts.Retention,
+		SweepInterval:         opts.SweepInterval,
+		LeaseTimeout:          opts.LeaseTimeout,
+		ReapInterval:          opts.ReapInterval,
+		RetryPolicy:           opts.RetryPolicy,
+	}
+}
+
+// logger returns the configured logger or the default one
+func (opts Options) logger() *slog.Logger {
+	if opts.Logger != nil {
+		return opts.Logger
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: opts.LogLevel}))
+}
+
+// tracing returns the tracing set up with the configured or default provider and propagator
+func (opts Options) tracing() *tracing {
+	tp := opts.TracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	propagator := opts.Propagator
+	if propagator == nil {
+		propagator = propagation.TraceContext{}
+	}
+	return newTracing(tp, propagator)
+}
+
+// dispatcherOpts converts the options to dispatcher options
+func (opts Options) dispatcherOpts(t *tracing) dispatcherOpts {
+	return dispatcherOpts{
+		BatchSize:         opts.DispatchBatchSize,
+		HeartbeatInterval: opts.HeartbeatInterval,
+		Logger:            opts.logger(),
+		Tracing:           t,
+		RateLimits:        opts.RateLimits,
+		ConcurrencyCaps:   opts.ConcurrencyCaps,
+		PanicHandler:      opts.PanicHandler,
+	}
+}
+
+// sortedKeys returns the keys of a map in ascending order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,98 @@
+package blero
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptions_Validate(t *testing.T) {
+	assert.NoError(t, DefaultOptions(testDBPath).validate())
+
+	// a backend replaces DBPath
+	opts := DefaultOptions("")
+	opts.Backend = NewMemoryBackend()
+	assert.NoError(t, opts.validate())
+
+	opts = Options{Retention: -time.Second, Codec: testCodec{}}
+	err := opts.validate()
+	assert.EqualError(t, err, "DBPath is required\n"+
+		"SequenceBandwidth must be greater than 0\n"+
+		"DispatchBatchSize must be greater than 0, got 0\n"+
+		"Codec 100 is not registered, see RegisterCodec\n"+
+		"Retention cannot be negative, got -1s")
+
+	opts = DefaultOptions(testDBPath)
+	opts.Codec = nil
+	opts.Retention = time.Hour
+	opts.SweepInterval = 0
+	err = opts.validate()
+	assert.EqualError(t, err, "Codec is required\n"+
+		"SweepInterval must be greater than 0 when Retention is set, got 0s")
+
+	opts = DefaultOptions(testDBPath)
+	opts.HeartbeatInterval = opts.LeaseTimeout
+	opts.ReapInterval = 0
+	opts.RetryPolicy.MaxAttempts = -1
+	err = opts.validate()
+	assert.EqualError(t, err, "HeartbeatInterval must be greater than 0 and lower than LeaseTimeout, got 30s\n"+
+		"ReapInterval must be greater than 0 when LeaseTimeout is set, got 0s\n"+
+		"RetryPolicy: MaxAttempts cannot be negative, got -1")
+
+	opts = DefaultOptions(testDBPath)
+	opts.Backend = NewMemoryBackend()
+	opts.EncryptionKey = []byte("key")
+	opts.EncryptionKeyRotation = 0
+	opts.IndexCacheSize = -1
+	err = opts.validate()
+	assert.EqualError(t, err, "EncryptionKey must be 16, 24 or 32 bytes long, got 3\n"+
+		"EncryptionKey is only supported by the default badger backend\n"+
+		"EncryptionKeyRotation must be greater than 0 when EncryptionKey is set, got 0s\n"+
+		"IndexCacheSize cannot be negative, got -1")
+
+	// leases can be disabled
+	opts = DefaultOptions(testDBPath)
+	opts.LeaseTimeout = 0
+	opts.HeartbeatInterval = 0
+	opts.ReapInterval = 0
+	assert.NoError(t, opts.validate())
+}
+
+func TestBlero_NewWithOptions(t *testing.T) {
+	opts := DefaultOptions(testDBPath)
+	opts.SequenceBandwidth = 10
+	opts.DispatchBatchSize = 5
+	opts.Codec = JSONCodec{}
+	opts.SyncWrites = false
+
+	bl, err := NewWithOptions(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, bl.dispatcher.opts.BatchSize)
+	assert.Equal(t, uint64(10), bl.queue.opts.SequenceBandwidth)
+
+	err = bl.Start()
+	assert.NoError(t, err)
+
+	// stop gracefully
+	defer deleteDBFolder(testDBPath)
+	defer bl.Stop()
+
+	jID, err := bl.EnqueueJob("TestJob", nil)
+	assert.NoError(t, err)
+
+	err = bl.queue.backend.View(func(tx Tx) error {
+		b, err := tx.Get([]byte(getJobKey(JobPending, jID)))
+		assert.NoError(t, err)
+		assert.Equal(t, jsonCodecID, b[1])
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestBlero_NewWithOptionsInvalid(t *testing.T) {
+	opts := DefaultOptions("")
+	bl, err := NewWithOptions(opts)
+	assert.Nil(t, bl)
+	assert.EqualError(t, err, "DBPath is required")
+}
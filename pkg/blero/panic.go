@@ -0,0 +1,47 @@
+package blero
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+// panicMetaKey is the job metadata key holding the stack trace of the last attempt which panicked
+const panicMetaKey = "blero.panic"
+
+// PanicError is the error of a job attempt whose processor panicked
+type PanicError struct {
+	// Value is the value passed to panic
+	Value any
+	// Stack is the stack trace of the processor goroutine when it panicked
+	Stack []byte
+}
+
+// Error returns the panic value
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("Processor panicked: %v", e.Value)
+}
+
+// RunProcessor runs a job on a processor and converts a panic to a *PanicError, it's used by the workers running leased jobs
+func RunProcessor(p Processor, j *Job) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &PanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+	return p.Run(j)
+}
+
+// panicStack returns the stack trace of a *PanicError in err, or an empty string
+func panicStack(err error) string {
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		return string(panicErr.Stack)
+	}
+	return ""
+}
+
+// PanicStack returns the stack trace of the last attempt of the job which panicked, if any
+func (j *Job) PanicStack() string {
+	return j.Meta[panicMetaKey]
+}
@@ -0,0 +1,58 @@
+package blero
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlero_ProcessorPanic(t *testing.T) {
+	panics := make(chan *PanicError, 1)
+	opts := DefaultOptions("")
+	opts.Backend = NewMemoryBackend()
+	opts.PanicHandler = func(j *Job, err *PanicError) {
+		assert.Equal(t, "PanickingJob", j.Name)
+		panics <- err
+	}
+	bl, err := NewWithOptions(opts)
+	assert.NoError(t, err)
+	assert.NoError(t, bl.Start())
+	defer bl.Stop()
+
+	bl.RegisterProcessorFunc(func(j *Job) error {
+		if j.Name == "PanickingJob" {
+			panic("boom")
+		}
+		return nil
+	})
+
+	id, err := bl.EnqueueJob("PanickingJob", nil)
+	assert.NoError(t, err)
+	select {
+	case err := <-panics:
+		assert.Equal(t, "boom", err.Value)
+		assert.EqualError(t, err, "Processor panicked: boom")
+		assert.Contains(t, string(err.Stack), "panic_test.go")
+	case <-time.After(time.Second):
+		t.Fatal("panic not reported")
+	}
+
+	j, status, err := bl.GetJob(id)
+	assert.NoError(t, err)
+	assert.Equal(t, JobFailed, status)
+	assert.Contains(t, j.PanicStack(), "panic_test.go")
+	history, err := bl.JobHistory(id)
+	assert.NoError(t, err)
+	if assert.Len(t, history, 3) {
+		assert.Equal(t, "Processor panicked: boom", history[2].Error)
+	}
+
+	// the processor slot is released and keeps running jobs
+	id, err = bl.EnqueueJob("TestJob", nil)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		_, status, err := bl.GetJob(id)
+		return err == nil && status == JobComplete
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,154 @@
+package blero
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// pause keys, the pause state is persisted so it survives restarts
+var pauseAllKey = []byte("p:all")
+
+const pauseNamePrefix = "p:name:"
+
+func getPauseNameKey(name string) []byte {
+	return []byte(pauseNamePrefix + name)
+}
+
+// setPaused persists the pause state of a key
+func (q *queue) setPaused(key []byte, paused bool) error {
+	return q.backend.Update(func(tx Tx) error {
+		if !paused {
+			err := tx.Delete(key)
+			if err == ErrKeyNotFound {
+				return nil
+			}
+			return err
+		}
+		return tx.Set(key, nil)
+	})
+}
+
+// loadPaused loads the persisted pause state
+func (q *queue) loadPaused() (bool, map[string]bool, error) {
+	all := false
+	names := make(map[string]bool)
+	err := q.backend.View(func(tx Tx) error {
+		_, err := tx.Get(pauseAllKey)
+		if err == nil {
+			all = true
+		} else if err != ErrKeyNotFound {
+			return err
+		}
+
+		return tx.Iterate([]byte(pauseNamePrefix), nil, func(k, v []byte) (bool, error) {
+			names[strings.TrimPrefix(string(k), pauseNamePrefix)] = true
+			return true, nil
+		})
+	})
+	if err != nil {
+		return false, nil, err
+	}
+	return all, names, nil
+}
+
+// loadPaused restores the persisted pause state
+func (d *dispatcher) loadPaused(q *queue) error {
+	all, names, err := q.loadPaused()
+	if err != nil {
+		return err
+	}
+
+	d.dispatchL.Lock()
+	defer d.dispatchL.Unlock()
+	d.paused = all
+	d.pausedNames = names
+	return nil
+}
+
+// setPaused pauses or resumes the whole dispatch, or a job name when name isn't empty
+func (d *dispatcher) setPaused(q *queue, name string, paused bool) error {
+	d.dispatchL.Lock()
+	defer d.dispatchL.Unlock()
+
+	key := pauseAllKey
+	if name != "" {
+		key = getPauseNameKey(name)
+	}
+	err := q.setPaused(key, paused)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case name == "":
+		d.paused = paused
+	case paused:
+		d.pausedNames[name] = true
+	default:
+		delete(d.pausedNames, name)
+	}
+
+	// signal that jobs might be resumed
+	if !paused {
+		d.signalLoop()
+	}
+	return nil
+}
+
+// isPaused checks if the jobs with a name are paused
+// NOT THREAD SAFE !! only call with dispatchL held
+func (d *dispatcher) isPaused(name string) bool {
+	return d.paused || d.pausedNames[name]
+}
+
+// leaseJobs leases pending jobs which aren't paused or scheduled for later to an external worker
+func (d *dispatcher) leaseJobs(q *queue, owner string, max int) ([]*Job, error) {
+	d.dispatchL.Lock()
+	defer d.dispatchL.Unlock()
+
+	if d.paused {
+		return nil, nil
+	}
+	return q.dequeueJobs(max, owner, nil, &dequeueFilter{skipName: d.isPaused})
+}
+
+// Pause stops starting jobs until Resume is called, jobs can still be enqueued and running jobs are not interrupted
+// The pause state is persisted and applies to the registered processors and to the external workers leasing jobs
+func (bl *Blero) Pause() error {
+	return bl.dispatcher.setPaused(bl.queue, "", true)
+}
+
+// Resume starts jobs again after Pause, job names paused with PauseJob stay paused
+func (bl *Blero) Resume() error {
+	return bl.dispatcher.setPaused(bl.queue, "", false)
+}
+
+// PauseJob stops starting the jobs with a given name until ResumeJob is called
+func (bl *Blero) PauseJob(name string) error {
+	if name == "" {
+		return errors.New("Job name is required")
+	}
+	return bl.dispatcher.setPaused(bl.queue, name, true)
+}
+
+// ResumeJob starts the jobs with a given name again after PauseJob
+func (bl *Blero) ResumeJob(name string) error {
+	if name == "" {
+		return errors.New("Job name is required")
+	}
+	return bl.dispatcher.setPaused(bl.queue, name, false)
+}
+
+// Paused returns whether the whole dispatch is paused and the paused job names in ascending order
+func (bl *Blero) Paused() (bool, []string) {
+	bl.dispatcher.dispatchL.Lock()
+	defer bl.dispatcher.dispatchL.Unlock()
+
+	names := make([]string, 0, len(bl.dispatcher.pausedNames))
+	for name := range bl.dispatcher.pausedNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return bl.dispatcher.paused, names
+}
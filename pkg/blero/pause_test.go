@@ -0,0 +1,121 @@
+package blero
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlero_PauseResume(t *testing.T) {
+	bl := NewWithBackend(NewMemoryBackend())
+	err := bl.Start()
+	assert.NoError(t, err)
+	defer bl.Stop()
+
+	p := &recordingProcessor{}
+	bl.RegisterProcessor(p)
+
+	assert.NoError(t, bl.Pause())
+	paused, names := bl.Paused()
+	assert.True(t, paused)
+	assert.Len(t, names, 0)
+
+	// paused jobs are still enqueued
+	for _, name := range []string{"TestJob", "OtherJob"} {
+		_, err := bl.EnqueueJob(name, nil)
+		assert.NoError(t, err)
+	}
+	assertPending(t, bl, 2)
+
+	// remote workers cannot lease paused jobs either
+	jobs, err := bl.LeaseJobs("worker-1", 10)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 0)
+
+	assert.NoError(t, bl.Resume())
+	assert.Eventually(t, func() bool { return len(p.processed()) == 2 }, time.Second, 10*time.Millisecond)
+	paused, _ = bl.Paused()
+	assert.False(t, paused)
+
+	// resuming twice is fine
+	assert.NoError(t, bl.Resume())
+}
+
+func TestBlero_PauseJob(t *testing.T) {
+	bl := NewWithBackend(NewMemoryBackend())
+	err := bl.Start()
+	assert.NoError(t, err)
+	defer bl.Stop()
+
+	assert.NoError(t, bl.PauseJob("Migrate"))
+	assert.NoError(t, bl.PauseJob("Export"))
+	paused, names := bl.Paused()
+	assert.False(t, paused)
+	assert.Equal(t, []string{"Export", "Migrate"}, names)
+
+	for _, name := range []string{"Migrate", "Resize", "Migrate", "Resize"} {
+		_, err := bl.EnqueueJob(name, nil)
+		assert.NoError(t, err)
+	}
+
+	// paused jobs don't block the other jobs
+	jobs, err := bl.LeaseJobs("worker-1", 1)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, "Resize", jobs[0].Name)
+
+	p := &recordingProcessor{}
+	bl.RegisterProcessor(p)
+	assertPending(t, bl, 2)
+	assert.Eventually(t, func() bool { return len(p.processed()) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"Resize"}, p.processed())
+
+	assert.NoError(t, bl.ResumeJob("Migrate"))
+	assert.Eventually(t, func() bool { return len(p.processed()) == 3 }, time.Second, 10*time.Millisecond)
+	_, names = bl.Paused()
+	assert.Equal(t, []string{"Export"}, names)
+
+	assert.EqualError(t, bl.PauseJob(""), "Job name is required")
+	assert.EqualError(t, bl.ResumeJob(""), "Job name is required")
+}
+
+func TestBlero_PausePersisted(t *testing.T) {
+	bl := New(testDBPath)
+	err := bl.Start()
+	assert.NoError(t, err)
+	defer deleteDBFolder(testDBPath)
+
+	assert.NoError(t, bl.Pause())
+	assert.NoError(t, bl.PauseJob("Migrate"))
+	_, err = bl.EnqueueJob("Migrate", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, bl.Stop())
+
+	// the pause state survives a restart
+	bl = New(testDBPath)
+	err = bl.Start()
+	assert.NoError(t, err)
+	defer bl.Stop()
+
+	paused, names := bl.Paused()
+	assert.True(t, paused)
+	assert.Equal(t, []string{"Migrate"}, names)
+
+	p := &recordingProcessor{}
+	bl.RegisterProcessor(p)
+	assert.NoError(t, bl.Resume())
+	assertPending(t, bl, 1)
+
+	assert.NoError(t, bl.ResumeJob("Migrate"))
+	assert.Eventually(t, func() bool { return len(p.processed()) == 1 }, time.Second, 10*time.Millisecond)
+}
+
+// assertPending runs a dispatch pass and checks the number of jobs left pending, jobs are leased before assignJobs returns
+func assertPending(t *testing.T, bl *Blero, n int) {
+	t.Helper()
+	assert.NoError(t, bl.dispatcher.assignJobs(bl.queue))
+	counts, err := bl.CountJobs()
+	assert.NoError(t, err)
+	assert.Equal(t, n, counts[JobPending])
+}
@@ -1,10 +1,52 @@
 package blero
 
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
 // Job represents a Goblero job definition
 type Job struct {
-	ID   uint64
+	ID uint64
+	// Key is a unique ID chosen by the caller at enqueue, jobs can be looked up by key
+	Key  string
 	Name string
 	Data []byte
+	// EnqueuedAt is the time the job was enqueued
+	EnqueuedAt time.Time
+	// FinishedAt is the time the job moved to the complete or failed status
+	FinishedAt time.Time
+	// StatusChangedAt is the time the job moved to its current status
+	StatusChangedAt time.Time
+	// Attempts is the number of times the job was started
+	Attempts int
+	// Meta is the metadata set by Blero, such as the trace context of the enqueuing span
+	Meta map[string]string
+	// Headers are key/value pairs set at enqueue, such as tenant or correlation IDs
+	Headers map[string]string
+	// Tags are labels set at enqueue, jobs can be listed by tag
+	Tags []string
+	// LeaseOwner identifies who is processing an in-progress job
+	LeaseOwner string
+	// LeaseExpiresAt is when the lease of an in-progress job expires unless extended by a heartbeat
+	LeaseExpiresAt time.Time
+	// RunAt is the earliest time a pending job can be started, set when a failed attempt is retried or snoozed
+	RunAt time.Time
+
+	// ctx carries the processing span
+	ctx context.Context
+	// compression of the stored data and the compressed data, reused when the record is written again
+	compression Compression
+	compressed  []byte
+}
+
+// Context returns the context of the job processing, which carries the processing span
+func (j *Job) Context() context.Context {
+	if j.ctx == nil {
+		return context.Background()
+	}
+	return j.ctx
 }
 
 // Processor interface
@@ -20,43 +62,130 @@ func (pf ProcessorFunc) Run(j *Job) error {
 	return pf(j)
 }
 
+// validateConcurrency checks a processor concurrency
+func validateConcurrency(concurrency int) error {
+	if concurrency < 1 {
+		return fmt.Errorf("Concurrency must be at least 1, got %v", concurrency)
+	}
+	return nil
+}
+
 // processorsStore struct
+// Each registered processor has a number of slots, each slot runs one job at a time
+// Idle slots are kept in a free list so the dispatcher doesn't scan all processors
 type processorsStore struct {
 	maxProcessorID int
 	processors     map[int]Processor
-	processing     map[int]uint64
+	slots          map[int]int
+	processing     map[int]map[uint64]struct{}
+	// free holds a processor ID once per idle slot, freeCount is the number of entries per processor
+	free      []int
+	freeCount map[int]int
 }
 
 // newProcessorsStore creates a new ProcessorsStore
 func newProcessorsStore() *processorsStore {
 	pStore := &processorsStore{}
 	pStore.processors = make(map[int]Processor)
-	pStore.processing = make(map[int]uint64)
+	pStore.slots = make(map[int]int)
+	pStore.processing = make(map[int]map[uint64]struct{})
+	pStore.freeCount = make(map[int]int)
 	return pStore
 }
 
-// registerProcessor registers a new processor
+// registerProcessor registers a new processor with a single slot
 func (pStore *processorsStore) registerProcessor(p Processor) int {
+	return pStore.registerProcessorSlots(p, 1)
+}
+
+// registerProcessorSlots registers a new processor running up to slots jobs concurrently
+func (pStore *processorsStore) registerProcessorSlots(p Processor, slots int) int {
 	pStore.maxProcessorID++
-	pStore.processors[pStore.maxProcessorID] = p
+	pID := pStore.maxProcessorID
+	pStore.processors[pID] = p
+	pStore.slots[pID] = slots
+	pStore.refillFree(pID)
+
+	return pID
+}
 
-	return pStore.maxProcessorID
+// setSlots changes the number of slots of a processor
+// Jobs already running on removed slots are not interrupted
+func (pStore *processorsStore) setSlots(pID int, slots int) bool {
+	if _, ok := pStore.processors[pID]; !ok {
+		return false
+	}
+	pStore.slots[pID] = slots
+	pStore.trimFree(pID)
+	pStore.refillFree(pID)
+	return true
 }
 
-// unregisterProcessor unregisters a processor
+// unregisterProcessor unregisters a processor and all its slots
 func (pStore *processorsStore) unregisterProcessor(pID int) {
 	delete(pStore.processors, pID)
+	delete(pStore.slots, pID)
+	pStore.trimFree(pID)
+}
+
+// idleSlots returns the number of slots of a processor that should be in the free list
+func (pStore *processorsStore) idleSlots(pID int) int {
+	return max(0, pStore.slots[pID]-len(pStore.processing[pID]))
+}
+
+// refillFree adds the idle slots of a processor missing from the free list
+func (pStore *processorsStore) refillFree(pID int) {
+	for i := pStore.freeCount[pID]; i < pStore.idleSlots(pID); i++ {
+		pStore.pushFree(pID)
+	}
 }
 
-// getAvailableProcessorsIDs returns the currently free processors
-func (pStore *processorsStore) getAvailableProcessorsIDs() []int {
-	var pIDs []int
-	for pID := range pStore.processors {
-		if _, ok := pStore.processing[pID]; !ok {
-			pIDs = append(pIDs, pID)
+// trimFree removes the free list entries of a processor above its idle slots
+// It scans the free list, which is fine since it only runs when slots are removed
+func (pStore *processorsStore) trimFree(pID int) {
+	excess := pStore.freeCount[pID] - pStore.idleSlots(pID)
+	if excess <= 0 {
+		return
+	}
+
+	free := pStore.free[:0]
+	for _, id := range pStore.free {
+		if id == pID && excess > 0 {
+			excess--
+			continue
 		}
+		free = append(free, id)
+	}
+	pStore.free = free
+	pStore.freeCount[pID] = pStore.idleSlots(pID)
+	if pStore.freeCount[pID] == 0 {
+		delete(pStore.freeCount, pID)
 	}
-	return pIDs
+}
+
+// freeSlots returns the number of idle slots over all processors
+func (pStore *processorsStore) freeSlots() int {
+	return len(pStore.free)
+}
+
+// popFree takes an idle slot from the free list and returns its processor ID
+func (pStore *processorsStore) popFree() (int, bool) {
+	if len(pStore.free) == 0 {
+		return 0, false
+	}
+	pID := pStore.free[len(pStore.free)-1]
+	pStore.free = pStore.free[:len(pStore.free)-1]
+	pStore.freeCount[pID]--
+	if pStore.freeCount[pID] == 0 {
+		delete(pStore.freeCount, pID)
+	}
+	return pID, true
+}
+
+// pushFree puts an idle slot back in the free list
+func (pStore *processorsStore) pushFree(pID int) {
+	pStore.free = append(pStore.free, pID)
+	pStore.freeCount[pID]++
 }
 
 // getProcessor fetches processors by ID
@@ -64,18 +193,21 @@ func (pStore *processorsStore) getProcessor(pID int) Processor {
 	return pStore.processors[pID]
 }
 
-// isProcessorBusy checks if a processor is already working on a job
-func (pStore *processorsStore) isProcessorBusy(pID int) bool {
-	_, ok := pStore.processing[pID]
-	return ok
-}
-
-// setProcessing sets a processor as working on a job
+// setProcessing sets a processor slot taken from the free list as working on a job
 func (pStore *processorsStore) setProcessing(pID int, jID uint64) {
-	pStore.processing[pID] = jID
+	if pStore.processing[pID] == nil {
+		pStore.processing[pID] = make(map[uint64]struct{})
+	}
+	pStore.processing[pID][jID] = struct{}{}
 }
 
-// unsetProcessing unsets a processor as working on a job
-func (pStore *processorsStore) unsetProcessing(pID int) {
-	delete(pStore.processing, pID)
+// unsetProcessing unsets a processor slot as working on a job and puts it back in the free list
+func (pStore *processorsStore) unsetProcessing(pID int, jID uint64) {
+	delete(pStore.processing[pID], jID)
+	if len(pStore.processing[pID]) == 0 {
+		delete(pStore.processing, pID)
+	}
+	if _, ok := pStore.processors[pID]; ok {
+		pStore.refillFree(pID)
+	}
 }
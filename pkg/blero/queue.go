@@ -1,12 +1,13 @@
 package blero
 
 import (
-	"bytes"
-	"encoding/gob"
+	"cmp"
 	"errors"
 	"fmt"
-	"os"
+	"log/slog"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/dgraph-io/badger/v4"
 )
@@ -14,69 +15,113 @@ import (
 // queueOpts struct
 type queueOpts struct {
 	DBPath string
-	Logger badger.Logger
+	Logger *slog.Logger
+	// Codec used to encode new records
+	Codec Codec
+	// Compression of the jobs whose data is at least CompressionThreshold bytes, 0 disables it
+	Compression          Compression
+	CompressionThreshold int
+	// BlobThreshold is the min stored data size of the jobs whose data is stored as a blob, 0 disables blobs
+	BlobThreshold int
+	BlobChunkSize int
+	// Backend used to store jobs, a badger db is opened at DBPath when nil
+	Backend Backend
+	// BadgerDB is a shared badger db used instead of opening one at DBPath
+	BadgerDB *badger.DB
+	// Namespace prefixes the keys of the backend
+	Namespace         string
+	SyncWrites        bool
+	SequenceBandwidth uint64
+	// EncryptionKey enables badger encryption at rest
+	EncryptionKey         []byte
+	EncryptionKeyRotation time.Duration
+	IndexCacheSize        int64
+	// Retention of complete and failed jobs, 0 keeps them forever
+	Retention     time.Duration
+	SweepInterval time.Duration
+	// LeaseTimeout of in-progress jobs, 0 disables lease expiry
+	LeaseTimeout time.Duration
+	ReapInterval time.Duration
+	// RetryPolicy decides if the failed and expired attempts are retried
+	RetryPolicy RetryPolicy
 }
 
 // queue struct
 type queue struct {
-	opts queueOpts
-	db   *badger.DB
-	seq  *badger.Sequence
-	dbL  sync.Mutex
+	opts    queueOpts
+	backend Backend
+	seq     Sequence
+	dbL     sync.Mutex
+	quitCh  chan struct{}
+	// requeued is called when reaped or retried jobs are returned to pending
+	requeued func()
+	// committed is called when a transaction writing to the dispatch indexes of a badger db commits
+	committed func()
 }
 
 // newQueue creates new ueue
 func newQueue(opts queueOpts) *queue {
 	q := &queue{opts: opts}
+	q.quitCh = make(chan struct{})
 	return q
 }
 
-type badgerLogger struct{}
-
-func (l *badgerLogger) Infof(format string, a ...interface{}) {
-	// ignore badger info logs
-}
-func (l *badgerLogger) Errorf(format string, a ...interface{}) {
-	fmt.Fprintf(os.Stderr, format, a...)
-}
-func (l *badgerLogger) Warningf(format string, a ...interface{}) {
-	fmt.Fprintf(os.Stderr, format, a...)
-}
-
-func (l *badgerLogger) Debugf(format string, a ...interface{}) {
-	// Leave blank for the time being,
-	// track it in the future.
-}
-
 // start Queue
 func (q *queue) start() error {
-	// validate opts
-	if q.opts.DBPath == "" {
-		return errors.New("DBPath is required")
+	backend := q.opts.Backend
+	if backend == nil && q.opts.BadgerDB != nil {
+		backend = &badgerBackend{db: q.opts.BadgerDB, shared: true}
 	}
+	if backend == nil {
+		// open db
+		var err error
+		backend, err = openBadgerBackend(q.opts.badgerOptions())
+		if err != nil {
+			return err
+		}
+	}
+	backend = newNamespacedBackend(backend, q.opts.Namespace)
+	q.backend = backend
 
-	x := badger.Options{}
-
-	x.Dir = "ds"
-
-	// open db
-	badgerOpts := badger.DefaultOptions(q.opts.DBPath)
-	badgerOpts.Logger = &badgerLogger{}
-	badgerOpts.SyncWrites = true
+	// upgrade older on-disk formats
+	err := q.migrate()
+	if err != nil {
+		backend.Close()
+		return err
+	}
 
-	db, err := badger.Open(badgerOpts)
+	// delete the blobs of new jobs whose record wasn't written before a crash
+	n, err := q.deleteOrphanBlobs()
 	if err != nil {
+		backend.Close()
 		return err
 	}
-	q.db = db
+	if n > 0 {
+		q.opts.Logger.Warn("Deleted orphan blob chunks", "count", n)
+	}
 
 	// init sequence
-	q.seq, err = db.GetSequence([]byte("standard"), 1000)
-	return err
+	q.seq, err = backend.GetSequence("standard", q.opts.SequenceBandwidth)
+	if err != nil {
+		backend.Close()
+		return err
+	}
+
+	if q.opts.Retention > 0 {
+		q.startSweepLoop()
+	}
+	if q.opts.LeaseTimeout > 0 {
+		q.startReapLoop()
+	}
+	q.startCommitWatch()
+
+	return nil
 }
 
 // stop Queue and Release resources
 func (q *queue) stop() error {
+	close(q.quitCh)
+
 	// release sequence
 	err := q.seq.Release()
 	if err != nil {
@@ -84,7 +129,7 @@ func (q *queue) stop() error {
 	}
 
 	// close db
-	err = q.db.Close()
+	err = q.backend.Close()
 	if err != nil {
 		return err
 	}
@@ -92,70 +137,129 @@ func (q *queue) stop() error {
 	return nil
 }
 
-func getNextSeq(seq *badger.Sequence) (num uint64, err error) {
-	defer func() {
-		r := recover()
-		if r != nil {
-			// recover from panic and send err instead
-			err = r.(error)
-		}
-	}()
-
-	num, err = seq.Next()
-	return num, err
+// enqueueJob enqueues a new Job to the Pending queue, its ID and enqueue time are set by the queue
+func (q *queue) enqueueJob(j *Job) (uint64, error) {
+	j.EnqueuedAt = timeNow()
+	j.StatusChangedAt = j.EnqueuedAt
+	return q.insertJob(j, JobPending)
 }
 
-// enqueueJob enqueues a new Job to the Pending queue
-func (q *queue) enqueueJob(name string, data []byte) (uint64, error) {
-	num, err := getNextSeq(q.seq)
+// insertJob stores a new Job in a given status, its ID is set by the queue
+// When another job has the key of j, j isn't stored and the ID of the other job is returned
+func (q *queue) insertJob(j *Job, status JobStatus) (uint64, error) {
+	if j.Key != "" {
+		// skip storing the blob of a duplicate
+		id, err := q.getJobID(j.Key)
+		if err == nil {
+			return id, nil
+		}
+		if err != ErrKeyNotFound {
+			return 0, err
+		}
+	}
+
+	num, err := q.seq.Next()
 	if err != nil {
 		return 0, err
 	}
-	j := &Job{ID: num + 1, Name: name, Data: data}
-	jKey := getJobKey(jobPending, j.ID)
+	j.ID = num + 1
 
-	err = q.db.Update(func(txn *badger.Txn) error {
-		b, err := encodeJob(j)
+	// a blob of a single chunk is written along with the record
+	blob := false
+	if !q.blobFitsRecordTx(j) {
+		blob, err = q.storeBlob(j)
 		if err != nil {
-			return err
+			return 0, err
 		}
+	}
 
-		err = txn.Set([]byte(jKey), b)
+	if j.Key != "" {
+		// checking and setting the key can't race with another job with the same key
+		q.dbL.Lock()
+		defer q.dbL.Unlock()
+	}
 
+	var existing uint64
+	err = q.backend.Update(func(tx Tx) error {
+		if !blob {
+			_, err := q.writeBlob(j, tx.Set)
+			if err != nil {
+				return err
+			}
+		}
+		var err error
+		existing, err = q.writeJob(tx, j, status)
+		if err == nil && existing != 0 {
+			// the job isn't stored, neither is its blob
+			return deleteBlob(tx, j)
+		}
 		return err
 	})
+	if err != nil || existing != 0 {
+		if blob {
+			// don't leave an orphan blob behind, or it's deleted on the next start
+			cleanupErr := q.backend.Update(func(tx Tx) error { return deleteBlob(tx, j) })
+			if cleanupErr != nil {
+				q.opts.Logger.Error("Cannot delete orphan blob", "job_id", j.ID, "error", cleanupErr)
+			}
+		}
+		return existing, err
+	}
+
+	return j.ID, nil
+}
+
+// writeJob writes the record of a new job with its key, index entries and first history entry
+// When another job has the key of j, nothing is written and the ID of the other job is returned
+func (q *queue) writeJob(tx Tx, j *Job, status JobStatus) (uint64, error) {
+	if j.Key != "" {
+		existing, err := setJobKey(tx, j)
+		if err != nil || existing != 0 {
+			return existing, err
+		}
+	}
+
+	b, err := encodeJob(q.opts.Codec, j)
 	if err != nil {
 		return 0, err
 	}
 
-	return j.ID, nil
+	err = tx.Set([]byte(getJobKey(status, j.ID)), b)
+	if err != nil {
+		return 0, err
+	}
+
+	err = setJobIndexes(tx, j, status)
+	if err != nil {
+		return 0, err
+	}
+	return 0, appendTransition(tx, j.ID, Transition{At: j.StatusChangedAt, To: status.String()})
 }
 
-func encodeJob(j *Job) ([]byte, error) {
-	var b bytes.Buffer
-	err := gob.NewEncoder(&b).Encode(j)
-	return b.Bytes(), err
+// timeNow returns the current time in UTC, without the monotonic clock reading so it survives encoding
+var timeNow = func() time.Time {
+	return time.Now().UTC()
 }
 
-// jobStatus Enum Type
-type jobStatus uint8
+// JobStatus Enum Type
+type JobStatus uint8
 
 const (
-	// jobPending : waiting to be processed
-	jobPending jobStatus = iota
-	// jobInProgress : processing in progress
-	jobInProgress
-	// jobComplete : processing complete
-	jobComplete
-	// jobFailed : processing errored out
-	jobFailed
+	// JobPending : waiting to be processed
+	JobPending JobStatus = iota
+	// JobInProgress : processing in progress
+	JobInProgress
+	// JobComplete : processing complete
+	JobComplete
+	// JobFailed : processing errored out
+	JobFailed
 )
 
-func getQueueKeyPrefix(status jobStatus) string {
+func getQueueKeyPrefix(status JobStatus) string {
 	return fmt.Sprintf("q:%v:", status)
 }
 
-func getJobKey(status jobStatus, jID uint64) string {
+func getJobKey(status JobStatus, jID uint64) string {
 	return getQueueKeyPrefix(status) + jIDString(jID)
 }
 
@@ -165,93 +269,317 @@ func jIDString(jID uint64) string {
 
 // dequeueJob moves the next pending job from the pending status to inprogress
 func (q *queue) dequeueJob() (*Job, error) {
-	var j *Job
+	return q.dequeueJobFunc(nil)
+}
+
+// dequeueJobFunc moves the first pending job accepted by allow from the pending status to inprogress
+// Jobs rejected by allow stay pending, see dequeueJobs
+func (q *queue) dequeueJobFunc(allow func(j *Job) bool) (*Job, error) {
+	jobs, err := q.dequeueJobs(1, localLeaseOwner, nil, &dequeueFilter{allow: allow})
+	if err != nil || len(jobs) == 0 {
+		return nil, err
+	}
+	return jobs[0], nil
+}
+
+// dequeueFilter selects the pending jobs leased by dequeueJobs, a nil filter leases any job which can start
+type dequeueFilter struct {
+	// skipName reports if the jobs of a name can't start, they are not read
+	skipName func(name string) bool
+	// allow checks a job before it's leased, rejecting it skips the other jobs with the same name
+	allow func(j *Job) bool
+}
+
+// promoteBatchSize is the max number of due scheduled jobs moved to the ready index per dequeue transaction
+const promoteBatchSize = 1000
+
+// dequeueJobs moves up to n pending jobs accepted by f from the pending status to inprogress in a single transaction
+// The jobs are leased by owner until their lease expires, jobs rejected by f stay pending
+// Only the ready index is read, the jobs scheduled for later and the jobs of skipped names are not visited
+// pIDs are the processors the jobs are assigned to in order, they are recorded in the job histories
+func (q *queue) dequeueJobs(n int, owner string, pIDs []int, f *dequeueFilter) ([]*Job, error) {
+	var jobs []*Job
+	if f == nil {
+		f = &dequeueFilter{}
+	}
 
 	q.dbL.Lock()
 	defer q.dbL.Unlock()
-	err := q.db.Update(func(txn *badger.Txn) error {
-		prefix := []byte(getQueueKeyPrefix(jobPending))
-		k, v, err := getFirstKVForPrefix(txn, prefix)
+	err := q.backend.Update(func(tx Tx) error {
+		jobs = nil
+		err := promoteScheduledJobs(tx, timeNow(), promoteBatchSize)
 		if err != nil {
 			return err
 		}
-		// iteration is done, no job was found
-		if k == nil {
-			return nil
-		}
-
-		j, err = decodeJob(v)
+		entries, err := readyEntries(tx, n, f.skipName)
 		if err != nil {
 			return err
 		}
 
-		// Move from from Pending queue to InProgress queue
-		err = moveItem(txn, k, []byte(getJobKey(jobInProgress, j.ID)), v)
-
-		return err
+		// names whose job was rejected in this transaction
+		rejected := make(map[string]bool)
+		for _, e := range entries {
+			if len(jobs) == n {
+				break
+			}
+			if rejected[e.name] {
+				continue
+			}
+
+			j, err := getJobForKey(tx, []byte(getJobKey(JobPending, e.id)))
+			if err == ErrKeyNotFound {
+				// stale entry of a db modified by other means
+				err = tx.Delete([]byte(getReadyIndexPrefix(e.name) + jIDString(e.id)))
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if f.allow != nil && !f.allow(j) {
+				rejected[e.name] = true
+				continue
+			}
+
+			j.Attempts++
+			j.LeaseOwner = owner
+			j.LeaseExpiresAt = q.leaseExpiry()
+
+			t := Transition{LeaseOwner: owner}
+			if len(jobs) < len(pIDs) {
+				t.ProcessorID = pIDs[len(jobs)]
+			}
+
+			// Move from from Pending queue to InProgress queue
+			err = q.moveJob(tx, j, JobPending, JobInProgress, t)
+			if err != nil {
+				return err
+			}
+
+			err = loadBlob(tx, j)
+			if err != nil {
+				return err
+			}
+
+			jobs = append(jobs, j)
+		}
+		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
 
-	return j, err
+	return jobs, nil
 }
 
-func getFirstKVForPrefix(txn *badger.Txn, prefix []byte) ([]byte, []byte, error) {
-	itOpts := badger.DefaultIteratorOptions
-	itOpts.PrefetchValues = true
-	itOpts.PrefetchSize = 1
-	it := txn.NewIterator(itOpts)
+// readyEntry is a ready index entry
+type readyEntry struct {
+	name string
+	id   uint64
+}
 
-	// go to smallest key after prefix
-	it.Seek(prefix)
-	defer it.Close()
-	// iteration done, no item found
-	if !it.ValidForPrefix(prefix) {
-		return nil, nil, nil
+// readyEntries returns the first n ready index entries of each job name which isn't skipped, in ID order
+// The names are found by seeking past the entries of the previous name, the entries of skipped names are not read
+func readyEntries(tx Tx, n int, skipName func(name string) bool) ([]readyEntry, error) {
+	prefix := []byte(fmt.Sprintf("%v%v:", readyIndexPrefix, JobPending))
+	var entries []readyEntry
+	var seek []byte
+	for {
+		// the first entry of the next name
+		var name string
+		found := false
+		err := tx.Iterate(prefix, seek, func(k, v []byte) (bool, error) {
+			var err error
+			name, _, err = parseReadyIndexKey(k)
+			found = true
+			return false, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			break
+		}
+
+		namePrefix := getReadyIndexPrefix(name)
+		if skipName == nil || !skipName(name) {
+			count := 0
+			err = tx.Iterate([]byte(namePrefix), nil, func(k, v []byte) (bool, error) {
+				_, id, err := parseReadyIndexKey(k)
+				if err != nil {
+					return false, err
+				}
+				entries = append(entries, readyEntry{name: name, id: id})
+				count++
+				return count < n, nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		// names can't hold NUL bytes, the entries of the next name sort after the NUL separator + 1
+		seek = []byte(namePrefix[:len(namePrefix)-1] + "\x01")
 	}
 
-	item := it.Item()
+	slices.SortFunc(entries, func(a, b readyEntry) int { return cmp.Compare(a.id, b.id) })
+	return entries, nil
+}
 
-	k := item.KeyCopy(nil)
+// promoteScheduledJobs moves up to max scheduled index entries whose run time is due at now to the ready index
+func promoteScheduledJobs(tx Tx, now time.Time, max int) error {
+	var due [][]byte
+	err := tx.Iterate([]byte(getScheduledIndexPrefix()), nil, func(k, v []byte) (bool, error) {
+		runAt, _, err := parseScheduledIndexKey(k)
+		if err != nil {
+			return false, err
+		}
+		if runAt.After(now) || len(due) == max {
+			return false, nil
+		}
+		due = append(due, slices.Clone(k))
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, k := range due {
+		_, id, err := parseScheduledIndexKey(k)
+		if err != nil {
+			return err
+		}
+		j, err := getJobForKey(tx, []byte(getJobKey(JobPending, id)))
+		if err != nil && err != ErrKeyNotFound {
+			return err
+		}
+		err = tx.Delete(k)
+		if err != nil {
+			return err
+		}
+		if j == nil {
+			// stale entry of a db modified by other means
+			continue
+		}
+		err = tx.Set(dispatchIndexKey(j, now), nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	v, err := item.ValueCopy(nil)
+// nextRunAt returns the earliest run time of the jobs scheduled for later, or a zero time when there are none
+// It can be in the past when more due jobs are waiting to be moved to the ready index
+func (q *queue) nextRunAt() (time.Time, error) {
+	var runAt time.Time
+	err := q.backend.View(func(tx Tx) error {
+		k, _, err := getFirstKVForPrefix(tx, []byte(getScheduledIndexPrefix()))
+		if err != nil || k == nil {
+			return err
+		}
+		runAt, _, err = parseScheduledIndexKey(k)
+		return err
+	})
+	return runAt, err
+}
+
+// runnable checks if a pending job can be started at now, jobs retried or snoozed wait until their run time
+func runnable(j *Job, now time.Time) bool {
+	return !j.RunAt.After(now)
+}
+
+func getFirstKVForPrefix(tx Tx, prefix []byte) ([]byte, []byte, error) {
+	var k, v []byte
+	err := tx.Iterate(prefix, nil, func(key, value []byte) (bool, error) {
+		k, v = key, value
+		// stop at the first item
+		return false, nil
+	})
 	return k, v, err
 }
 
 // markJobDone moves a job from the inprogress status to complete/failed
-func (q *queue) markJobDone(id uint64, status jobStatus) error {
-	if status != jobComplete && status != jobFailed {
+func (q *queue) markJobDone(id uint64, status JobStatus) error {
+	if status != JobComplete && status != JobFailed {
 		return errors.New("Can only move to Complete or Failed Status")
 	}
+	return q.finishLease(id, 0, attemptResult{status: status})
+}
 
-	key := []byte(getJobKey(jobInProgress, id))
+// attemptResult is the outcome of a job attempt
+type attemptResult struct {
+	// status is the status the job moves to
+	status JobStatus
+	// t holds the processor and the failure reason recorded in the job history
+	t Transition
+	// panicStack is the stack trace of the processor if it panicked
+	panicStack string
+	// runAt is when a job returned to pending can be started again
+	runAt time.Time
+	// snooze returns the job to pending without counting the attempt
+	snooze bool
+}
+
+// finishLease moves a job attempt from the inprogress status to complete/failed, or back to pending to be retried
+// It returns ErrLeaseLost if the attempt isn't in progress anymore, attempt 0 finishes any attempt
+func (q *queue) finishLease(id uint64, attempt int, res attemptResult) error {
+	if res.status == JobInProgress {
+		return errors.New("Can only move to Pending, Complete or Failed Status")
+	}
+
+	key := []byte(getJobKey(JobInProgress, id))
 
 	q.dbL.Lock()
 	defer q.dbL.Unlock()
-	err := q.db.Update(func(txn *badger.Txn) error {
-		b, err := getBytesForKey(txn, key)
+	err := q.backend.Update(func(tx Tx) error {
+		j, err := getJobForKey(tx, key)
+		if err == ErrKeyNotFound && attempt > 0 {
+			return ErrLeaseLost
+		}
 		if err != nil {
 			return err
 		}
+		if attempt > 0 && j.Attempts != attempt {
+			return ErrLeaseLost
+		}
+
+		if res.status == JobPending {
+			j.RunAt = res.runAt
+			if res.snooze {
+				j.Attempts--
+			}
+		} else {
+			j.FinishedAt = timeNow()
+		}
+		t := res.t
+		t.LeaseOwner = j.LeaseOwner
+		j.LeaseOwner = ""
+		j.LeaseExpiresAt = time.Time{}
+		if res.panicStack != "" {
+			if j.Meta == nil {
+				j.Meta = make(map[string]string)
+			}
+			j.Meta[panicMetaKey] = res.panicStack
+		}
 
 		// Move from from InProgress queue to dest queue
-		err = moveItem(txn, key, []byte(getJobKey(status, id)), b)
+		err = q.moveJob(tx, j, JobInProgress, res.status, t)
 
 		return err
 	})
 
-	return err
-}
-
-func decodeJob(b []byte) (*Job, error) {
-	var j *Job
-	err := gob.NewDecoder(bytes.NewBuffer(b)).Decode(&j)
-	if err != nil {
-		return nil, err
+	// signal that a job is pending again, such as a job nacked by a remote worker
+	if err == nil && res.status == JobPending && q.requeued != nil {
+		q.requeued()
 	}
-	return j, nil
+
+	return err
 }
 
-func getJobForKey(txn *badger.Txn, key []byte) (*Job, error) {
-	b, err := getBytesForKey(txn, key)
+func getJobForKey(tx Tx, key []byte) (*Job, error) {
+	b, err := tx.Get(key)
 	if err != nil {
 		return nil, err
 	}
@@ -262,28 +590,120 @@ func getJobForKey(txn *badger.Txn, key []byte) (*Job, error) {
 	return j, nil
 }
 
-func getBytesForKey(txn *badger.Txn, key []byte) ([]byte, error) {
-	item, err := txn.Get(key)
+// moveJob writes a job to another status along with its index entries, sets its status change time and appends t to its history
+func (q *queue) moveJob(tx Tx, j *Job, from JobStatus, to JobStatus, t Transition) error {
+	// the old entries are keyed by the previous status change time
+	err := deleteJobIndexes(tx, j, from)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	b, err := item.ValueCopy(nil)
+	j.StatusChangedAt = timeNow()
+	b, err := encodeJob(q.opts.Codec, j)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	err = moveItem(tx, []byte(getJobKey(from, j.ID)), []byte(getJobKey(to, j.ID)), b)
+	if err != nil {
+		return err
+	}
+	err = setJobIndexes(tx, j, to)
+	if err != nil {
+		return err
+	}
+
+	t.At = j.StatusChangedAt
+	t.From = from.String()
+	t.To = to.String()
+	t.Attempt = j.Attempts
+	return appendTransition(tx, j.ID, t)
+}
 
-	return b, nil
+// deleteJobRecord deletes the record of a job in a status along with its index entries, blob, history and key
+func deleteJobRecord(tx Tx, j *Job, status JobStatus) error {
+	err := deleteBlob(tx, j)
+	if err != nil {
+		return err
+	}
+	err = deleteHistory(tx, j.ID)
+	if err != nil {
+		return err
+	}
+	err = deleteJobKey(tx, j)
+	if err != nil {
+		return err
+	}
+	err = deleteJobIndexes(tx, j, status)
+	if err != nil {
+		return err
+	}
+	return tx.Delete([]byte(getJobKey(status, j.ID)))
 }
 
-func moveItem(txn *badger.Txn, oldKey []byte, newKey []byte, b []byte) error {
+func moveItem(tx Tx, oldKey []byte, newKey []byte, b []byte) error {
 	// remove from Source queue
-	err := txn.Delete(oldKey)
+	err := tx.Delete(oldKey)
 	if err != nil {
 		return err
 	}
 
 	// create in Dest queue
-	err = txn.Set(newKey, b)
+	err = tx.Set(newKey, b)
 	return err
 }
+
+// jobStatuses lists all statuses
+var jobStatuses = []JobStatus{JobPending, JobInProgress, JobComplete, JobFailed}
+
+// ParseJobStatus parses the name of a job status, as returned by JobStatus.String
+func ParseJobStatus(name string) (JobStatus, error) {
+	for _, s := range jobStatuses {
+		if s.String() == name {
+			return s, nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown job status %q", name)
+}
+
+// getJob fetches a job by ID from any status
+func (q *queue) getJob(id uint64) (*Job, JobStatus, error) {
+	var j *Job
+	var status JobStatus
+	err := q.backend.View(func(tx Tx) error {
+		for _, s := range jobStatuses {
+			var err error
+			j, err = getJobForKey(tx, []byte(getJobKey(s, id)))
+			if err == ErrKeyNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			status = s
+			return loadBlob(tx, j)
+		}
+		return ErrKeyNotFound
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return j, status, nil
+}
+
+// iterateJobs calls fn for the jobs in a given status in ID order until fn returns false or an error
+func (q *queue) iterateJobs(status JobStatus, fn func(j *Job) (bool, error)) error {
+	return q.backend.View(func(tx Tx) error {
+		return tx.Iterate([]byte(getQueueKeyPrefix(status)), nil, func(k, v []byte) (bool, error) {
+			j, err := decodeJob(v)
+			if err != nil {
+				return false, err
+			}
+			err = loadBlob(tx, j)
+			if err != nil {
+				return false, err
+			}
+			return fn(j)
+		})
+	})
+}
@@ -1,6 +1,7 @@
 package blero
 
 import (
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
@@ -39,11 +40,21 @@ func TestBlero_StopQueueAlreadyStopped(t *testing.T) {
 }*/
 
 func TestBlero_BadgerLogger(t *testing.T) {
-	logger := &badgerLogger{}
+	buf := new(safeBuffer)
+	logger := &badgerLogger{logger: newTestLogger(buf)}
 	// test logger
-	logger.Infof("[badgerLogger]TEST Infof")
-	logger.Warningf("[badgerLogger]TEST Warningf")
+	logger.Infof("[badgerLogger]TEST Infof\n")
+	logger.Warningf("[badgerLogger]TEST %v", "Warningf")
 	logger.Errorf("[badgerLogger]TEST Errorf")
+	logger.Debugf("[badgerLogger]TEST Debugf")
+
+	logs, err := ioutil.ReadAll(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"level":"DEBUG","msg":"[badgerLogger]TEST Infof","component":"badger"}
+{"level":"WARN","msg":"[badgerLogger]TEST Warningf","component":"badger"}
+{"level":"ERROR","msg":"[badgerLogger]TEST Errorf","component":"badger"}
+{"level":"DEBUG","msg":"[badgerLogger]TEST Debugf","component":"badger"}
+`, string(logs))
 }
 
 func TestBlero_EnqueueJob(t *testing.T) {
@@ -66,7 +77,7 @@ func TestBlero_EnqueueJob(t *testing.T) {
 	assert.Equal(t, uint64(1), jID)
 
 	var j *Job
-	err = q.db.View(func(txn *badger.Txn) error {
+	err = q.backend.View(func(txn Tx) error {
 		j, err = getJobForKey(txn, []byte("q:pending:"+jIDString(jID)))
 		assert.NoError(t, err)
 
@@ -147,10 +158,10 @@ func TestBlero_DequeueJob(t *testing.T) {
 	assert.Equal(t, j1ID, j.ID)
 	assert.Equal(t, j1Name, j.Name)
 
-	err = q.db.View(func(txn *badger.Txn) error {
+	err = q.backend.View(func(txn Tx) error {
 		// check that job 1 is not in the pending queue anymore
 		_, err := txn.Get([]byte("q:pending:" + jIDString(j1ID)))
-		assert.EqualError(t, err, badger.ErrKeyNotFound.Error())
+		assert.EqualError(t, err, ErrKeyNotFound.Error())
 
 		// check that job 2 is still in the pending queue
 		_, err = txn.Get([]byte("q:pending:" + jIDString(j2ID)))
@@ -215,6 +226,49 @@ func TestBlero_DequeueJob_Concurrent(t *testing.T) {
 	assert.Equal(t, jobs[1].Name, j2Name)
 }
 
+func TestBlero_DequeueJobs(t *testing.T) {
+	bl := NewWithBackend(NewMemoryBackend())
+	err := bl.Start()
+	assert.NoError(t, err)
+	defer bl.Stop()
+
+	q := bl.queue
+
+	for _, name := range []string{"TestJob", "OtherJob", "TestJob", "TestJob", "TestJob"} {
+		_, err := bl.EnqueueJob(name, nil)
+		assert.NoError(t, err)
+	}
+
+	// leased in order, skipping the rejected jobs
+	jobs, err := q.dequeueJobs(3, localLeaseOwner, nil, &dequeueFilter{allow: func(j *Job) bool {
+		return j.Name == "TestJob"
+	}})
+	assert.NoError(t, err)
+	var ids []uint64
+	for _, j := range jobs {
+		ids = append(ids, j.ID)
+		assert.Equal(t, 1, j.Attempts)
+	}
+	assert.Equal(t, []uint64{1, 3, 4}, ids)
+
+	var pending []uint64
+	err = q.iterateJobs(JobPending, func(j *Job) (bool, error) {
+		pending = append(pending, j.ID)
+		return true, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{2, 5}, pending)
+
+	// fewer jobs than requested
+	jobs, err = q.dequeueJobs(10, localLeaseOwner, nil, nil)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 2)
+
+	jobs, err = q.dequeueJobs(10, localLeaseOwner, nil, nil)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 0)
+}
+
 func TestBlero_MarkJobDone(t *testing.T) {
 	bl := New(testDBPath)
 	err := bl.Start()
@@ -241,20 +295,20 @@ func TestBlero_MarkJobDone(t *testing.T) {
 	_, err = q.dequeueJob()
 	assert.NoError(t, err)
 
-	err = q.markJobDone(j1ID, jobComplete)
+	err = q.markJobDone(j1ID, JobComplete)
 	assert.NoError(t, err)
 
-	err = q.markJobDone(j2ID, jobFailed)
+	err = q.markJobDone(j2ID, JobFailed)
 	assert.NoError(t, err)
 
-	err = q.db.View(func(txn *badger.Txn) error {
+	err = q.backend.View(func(txn Tx) error {
 		// check that job 1 is not in the inprogress queue anymore
 		_, err := txn.Get([]byte("q:inprogress:" + jIDString(j1ID)))
-		assert.EqualError(t, err, badger.ErrKeyNotFound.Error())
+		assert.EqualError(t, err, ErrKeyNotFound.Error())
 
 		// check that job 2 is not in the inprogress queue anymore
 		_, err = txn.Get([]byte("q:inprogress:" + jIDString(j2ID)))
-		assert.EqualError(t, err, badger.ErrKeyNotFound.Error())
+		assert.EqualError(t, err, ErrKeyNotFound.Error())
 
 		// check that job 1 is now in the complete queue
 		completeJob, err := getJobForKey(txn, []byte("q:complete:"+jIDString(j1ID)))
@@ -274,17 +328,17 @@ func TestBlero_MarkJobDone(t *testing.T) {
 	assert.NoError(t, err)
 
 	// check random job id is not in queue error
-	err = q.markJobDone(uint64(4151231), jobComplete)
+	err = q.markJobDone(uint64(4151231), JobComplete)
 	assert.EqualError(t, err, "Key not found")
 
 	// check moving job to pending error
-	err = q.markJobDone(j2ID, jobPending)
+	err = q.markJobDone(j2ID, JobPending)
 	assert.EqualError(t, err, "Can only move to Complete or Failed Status")
 }
 
 func TestBlero_moveItemErr(t *testing.T) {
 	txn := &badger.Txn{}
-	err := moveItem(txn, nil, nil, nil)
+	err := moveItem(&badgerTx{txn: txn}, nil, nil, nil)
 	assert.EqualError(t, err, "No sets or deletes are allowed in a read-only transaction")
 }
 
@@ -0,0 +1,125 @@
+package blero
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimit limits how often jobs with a given name are started using a token bucket
+// The bucket holds up to Burst tokens and is refilled at Rate tokens per second, each job start takes a token
+type RateLimit struct {
+	// Rate is the number of jobs started per second
+	Rate float64
+	// Burst is the max number of jobs started at once
+	Burst int
+}
+
+// validate checks the rate limit values
+func (l RateLimit) validate() error {
+	if l.Rate <= 0 || math.IsInf(l.Rate, 0) || math.IsNaN(l.Rate) {
+		return fmt.Errorf("Rate must be greater than 0, got %v", l.Rate)
+	}
+	if l.Burst < 1 {
+		return fmt.Errorf("Burst must be at least 1, got %v", l.Burst)
+	}
+	return nil
+}
+
+// tokenBucket struct
+type tokenBucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket creates a full token bucket
+func newTokenBucket(limit RateLimit, now time.Time) *tokenBucket {
+	return &tokenBucket{limit: limit, tokens: float64(limit.Burst), last: now}
+}
+
+// take takes a token if available, otherwise it returns how long to wait until the next token
+func (b *tokenBucket) take(now time.Time) (bool, time.Duration) {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(float64(b.limit.Burst), b.tokens+elapsed*b.limit.Rate)
+		b.last = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - b.tokens) / b.limit.Rate * float64(time.Second))
+	return false, wait
+}
+
+// giveBack returns n tokens taken for jobs which were not started, capped to burst
+func (b *tokenBucket) giveBack(n int) {
+	b.tokens = math.Min(float64(b.limit.Burst), b.tokens+float64(n))
+}
+
+// rateLimiter holds the token buckets per job name
+type rateLimiter struct {
+	l       sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// newRateLimiter creates a rate limiter with initial limits per job name
+func newRateLimiter(limits map[string]RateLimit) *rateLimiter {
+	rl := &rateLimiter{buckets: make(map[string]*tokenBucket)}
+	now := timeNow()
+	for name, limit := range limits {
+		rl.buckets[name] = newTokenBucket(limit, now)
+	}
+	return rl
+}
+
+// setLimit sets or replaces the rate limit of a job name
+// The bucket keeps its tokens, capped to the new burst
+func (rl *rateLimiter) setLimit(name string, limit RateLimit) {
+	rl.l.Lock()
+	defer rl.l.Unlock()
+
+	b, ok := rl.buckets[name]
+	if !ok {
+		rl.buckets[name] = newTokenBucket(limit, timeNow())
+		return
+	}
+	b.limit = limit
+	b.tokens = math.Min(b.tokens, float64(limit.Burst))
+}
+
+// removeLimit removes the rate limit of a job name
+func (rl *rateLimiter) removeLimit(name string) {
+	rl.l.Lock()
+	defer rl.l.Unlock()
+
+	delete(rl.buckets, name)
+}
+
+// take takes a token for a job name, names without limits are always allowed
+func (rl *rateLimiter) take(name string) (bool, time.Duration) {
+	rl.l.Lock()
+	defer rl.l.Unlock()
+
+	b, ok := rl.buckets[name]
+	if !ok {
+		return true, 0
+	}
+	return b.take(timeNow())
+}
+
+// giveBack returns n tokens taken for a job name whose jobs were not started
+func (rl *rateLimiter) giveBack(name string, n int) {
+	rl.l.Lock()
+	defer rl.l.Unlock()
+
+	b, ok := rl.buckets[name]
+	if !ok {
+		return
+	}
+	b.giveBack(n)
+}
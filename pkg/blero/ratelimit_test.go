@@ -0,0 +1,189 @@
+package blero
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucket_Take(t *testing.T) {
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := newTokenBucket(RateLimit{Rate: 10, Burst: 2}, now)
+
+	ok, _ := b.take(now)
+	assert.True(t, ok)
+	ok, _ = b.take(now)
+	assert.True(t, ok)
+
+	ok, wait := b.take(now)
+	assert.False(t, ok)
+	assert.Equal(t, 100*time.Millisecond, wait)
+
+	ok, wait = b.take(now.Add(50 * time.Millisecond))
+	assert.False(t, ok)
+	assert.Equal(t, 50*time.Millisecond, wait)
+
+	ok, _ = b.take(now.Add(100 * time.Millisecond))
+	assert.True(t, ok)
+
+	// tokens are capped to burst
+	ok, _ = b.take(now.Add(time.Hour))
+	assert.True(t, ok)
+	ok, _ = b.take(now.Add(time.Hour))
+	assert.True(t, ok)
+	ok, _ = b.take(now.Add(time.Hour))
+	assert.False(t, ok)
+
+	// tokens given back are capped to burst too
+	b.giveBack(5)
+	ok, _ = b.take(now.Add(time.Hour))
+	assert.True(t, ok)
+	ok, _ = b.take(now.Add(time.Hour))
+	assert.True(t, ok)
+	ok, _ = b.take(now.Add(time.Hour))
+	assert.False(t, ok)
+}
+
+func TestRateLimit_Validate(t *testing.T) {
+	assert.NoError(t, RateLimit{Rate: 0.5, Burst: 1}.validate())
+	assert.EqualError(t, RateLimit{Rate: 0, Burst: 1}.validate(), "Rate must be greater than 0, got 0")
+	assert.EqualError(t, RateLimit{Rate: 1, Burst: 0}.validate(), "Burst must be at least 1, got 0")
+
+	opts := DefaultOptions(testDBPath)
+	opts.RateLimits = map[string]RateLimit{"b": {Rate: 1}, "a": {Rate: -1, Burst: 1}}
+	assert.EqualError(t, opts.validate(), "RateLimits[a]: Rate must be greater than 0, got -1\n"+
+		"RateLimits[b]: Burst must be at least 1, got 0")
+
+	bl := NewWithBackend(NewMemoryBackend())
+	assert.EqualError(t, bl.SetRateLimit("MyJob", RateLimit{Rate: 1}), "Burst must be at least 1, got 0")
+}
+
+// recordingProcessor records the names of the processed jobs
+type recordingProcessor struct {
+	m     sync.Mutex
+	names []string
+}
+
+func (p *recordingProcessor) Run(j *Job) error {
+	p.m.Lock()
+	defer p.m.Unlock()
+	p.names = append(p.names, j.Name)
+	return nil
+}
+
+func (p *recordingProcessor) processed() []string {
+	p.m.Lock()
+	defer p.m.Unlock()
+	return append([]string(nil), p.names...)
+}
+
+func TestBlero_RateLimitSkipsLimitedJobs(t *testing.T) {
+	opts := DefaultOptions("")
+	opts.Backend = NewMemoryBackend()
+	opts.RateLimits = map[string]RateLimit{"Limited": {Rate: 0.001, Burst: 1}}
+	bl, err := NewWithOptions(opts)
+	assert.NoError(t, err)
+
+	err = bl.Start()
+	assert.NoError(t, err)
+	defer bl.Stop()
+
+	for _, name := range []string{"Limited", "Limited", "Limited", "Other", "Other"} {
+		_, err := bl.EnqueueJob(name, nil)
+		assert.NoError(t, err)
+	}
+
+	p := &recordingProcessor{}
+	bl.RegisterProcessor(p)
+
+	// limited jobs don't block the other jobs
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, []string{"Limited", "Other", "Other"}, p.processed())
+
+	// raise the limit at runtime
+	err = bl.SetRateLimit("Limited", RateLimit{Rate: 1000, Burst: 1})
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return len(p.processed()) == 5 }, time.Second, 10*time.Millisecond)
+}
+
+func TestBlero_RateLimitWakesUp(t *testing.T) {
+	opts := DefaultOptions("")
+	opts.Backend = NewMemoryBackend()
+	opts.RateLimits = map[string]RateLimit{"Limited": {Rate: 20, Burst: 1}}
+	bl, err := NewWithOptions(opts)
+	assert.NoError(t, err)
+
+	err = bl.Start()
+	assert.NoError(t, err)
+	defer bl.Stop()
+
+	p := &recordingProcessor{}
+	bl.RegisterProcessor(p)
+
+	for i := 0; i < 3; i++ {
+		_, err := bl.EnqueueJob("Limited", nil)
+		assert.NoError(t, err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Len(t, p.processed(), 1)
+
+	// the dispatcher wakes up when tokens are available
+	assert.Eventually(t, func() bool { return len(p.processed()) == 3 }, time.Second, 10*time.Millisecond)
+
+	bl.RemoveRateLimit("Limited")
+	ok, _ := bl.dispatcher.limiter.take("Limited")
+	assert.True(t, ok)
+	for i := 0; i < 3; i++ {
+		_, err := bl.EnqueueJob("Limited", nil)
+		assert.NoError(t, err)
+	}
+	assert.Eventually(t, func() bool { return len(p.processed()) == 6 }, time.Second, 10*time.Millisecond)
+}
+
+// failingBackend fails to commit the read-write transactions while fail is set
+type failingBackend struct {
+	Backend
+	fail atomic.Bool
+}
+
+func (b *failingBackend) Update(fn func(tx Tx) error) error {
+	return b.Backend.Update(func(tx Tx) error {
+		err := fn(tx)
+		if err == nil && b.fail.Load() {
+			return errors.New("disk full")
+		}
+		return err
+	})
+}
+
+func TestBlero_RateLimitFailedLease(t *testing.T) {
+	backend := &failingBackend{Backend: NewMemoryBackend()}
+	opts := DefaultOptions("")
+	opts.Backend = backend
+	opts.Logger = slog.New(slog.DiscardHandler)
+	opts.RateLimits = map[string]RateLimit{"Limited": {Rate: 0.001, Burst: 1}}
+	bl, err := NewWithOptions(opts)
+	assert.NoError(t, err)
+	assert.NoError(t, bl.Start())
+	defer bl.Stop()
+
+	_, err = bl.EnqueueJob("Limited", nil)
+	assert.NoError(t, err)
+
+	// the lease fails after the token was taken
+	backend.fail.Store(true)
+	p := &recordingProcessor{}
+	bl.RegisterProcessor(p)
+	assert.Error(t, bl.dispatcher.assignJobs(bl.queue))
+
+	// the token was given back
+	backend.fail.Store(false)
+	assert.NoError(t, bl.dispatcher.assignJobs(bl.queue))
+	assert.Eventually(t, func() bool { return len(p.processed()) == 1 }, time.Second, 10*time.Millisecond)
+}
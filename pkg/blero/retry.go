@@ -0,0 +1,161 @@
+package blero
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// RetryPolicy decides if and when the failed attempts of a job are retried
+// Retried jobs are returned to pending and started again once their backoff elapsed, see Job.RunAt
+// The zero RetryPolicy doesn't retry the jobs whose processor returned an error, unless it asked for it with RetryAfter or Snooze
+type RetryPolicy struct {
+	// MaxAttempts is the max number of attempts of a job, failed or whose lease expired, before it's moved to failed, 0 is unlimited
+	MaxAttempts int
+	// Backoff is the delay before the first retry, it doubles on each retry
+	Backoff time.Duration
+	// MaxBackoff caps the delay between retries, 0 is uncapped
+	MaxBackoff time.Duration
+}
+
+// validate checks the retry policy values
+func (p RetryPolicy) validate() error {
+	if p.MaxAttempts < 0 {
+		return fmt.Errorf("MaxAttempts cannot be negative, got %v", p.MaxAttempts)
+	}
+	if p.Backoff < 0 {
+		return fmt.Errorf("Backoff cannot be negative, got %v", p.Backoff)
+	}
+	if p.MaxBackoff < 0 {
+		return fmt.Errorf("MaxBackoff cannot be negative, got %v", p.MaxBackoff)
+	}
+	return nil
+}
+
+// backoff returns the delay before retrying a job whose attempt failed
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.Backoff
+	for i := 1; i < attempt && delay < math.MaxInt64/2; i++ {
+		if p.MaxBackoff > 0 && delay >= p.MaxBackoff {
+			break
+		}
+		delay *= 2
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return delay
+}
+
+// exhausted checks if a job reached MaxAttempts
+func (p RetryPolicy) exhausted(attempt int) bool {
+	return p.MaxAttempts > 0 && attempt >= p.MaxAttempts
+}
+
+// failedAttempt returns the outcome of an attempt which failed with err
+// Permanent errors move the job to failed, snoozed jobs and retried jobs are returned to pending until their run time
+func (p RetryPolicy) failedAttempt(attempt int, err error) attemptResult {
+	var snoozeErr *SnoozeError
+	if errors.As(err, &snoozeErr) {
+		return attemptResult{status: JobPending, runAt: timeNow().Add(snoozeErr.Delay), snooze: true}
+	}
+	var permanentErr *PermanentError
+	if errors.As(err, &permanentErr) || p.exhausted(attempt) {
+		return attemptResult{status: JobFailed}
+	}
+	var retryErr *RetryAfterError
+	if errors.As(err, &retryErr) {
+		return attemptResult{status: JobPending, runAt: timeNow().Add(retryErr.Delay)}
+	}
+	if p == (RetryPolicy{}) {
+		return attemptResult{status: JobFailed}
+	}
+	return attemptResult{status: JobPending, runAt: timeNow().Add(p.backoff(attempt))}
+}
+
+// expiredAttempt returns the outcome of an attempt whose lease expired
+// The job is retried after the backoff, jobs which reached MaxAttempts are moved to failed
+func (p RetryPolicy) expiredAttempt(attempt int) attemptResult {
+	if p.exhausted(attempt) {
+		return attemptResult{status: JobFailed}
+	}
+	return attemptResult{status: JobPending, runAt: timeNow().Add(p.backoff(attempt))}
+}
+
+// failedAttempt returns the outcome of a job attempt which failed with err under the retry policy
+// t identifies who ran the attempt, the error and the stack trace of a panic are recorded
+func (q *queue) failedAttempt(attempt int, err error, t Transition) attemptResult {
+	res := q.opts.RetryPolicy.failedAttempt(attempt, err)
+	res.t = t
+	if err != nil {
+		res.t.Error = err.Error()
+	}
+	res.panicStack = panicStack(err)
+	return res
+}
+
+// PermanentError fails a job without retrying it, see Permanent
+type PermanentError struct {
+	Err error
+}
+
+// Permanent wraps an error returned by a processor so that the job is moved to failed without being retried
+// It returns nil if err is nil
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// Error returns the wrapped error message
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// RetryAfterError retries a job after a delay instead of the backoff of the retry policy, see RetryAfter
+type RetryAfterError struct {
+	Err   error
+	Delay time.Duration
+}
+
+// RetryAfter wraps an error returned by a processor so that the job is retried after delay, such as the Retry-After of a rate limited API
+// The attempt counts towards RetryPolicy.MaxAttempts, it's retried even by the zero RetryPolicy, it returns nil if err is nil
+func RetryAfter(err error, delay time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &RetryAfterError{Err: err, Delay: delay}
+}
+
+// Error returns the wrapped error message
+func (e *RetryAfterError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+// SnoozeError returns a job to pending for a delay without counting the attempt, see Snooze
+type SnoozeError struct {
+	Delay time.Duration
+}
+
+// Snooze returns an error which puts the job back to pending for delay, for example when a resource it waits for isn't ready
+// The attempt isn't counted and snoozed jobs are not limited by RetryPolicy.MaxAttempts
+func Snooze(delay time.Duration) error {
+	return &SnoozeError{Delay: delay}
+}
+
+// Error returns the snooze delay
+func (e *SnoozeError) Error() string {
+	return fmt.Sprintf("Snoozed for %v", e.Delay)
+}
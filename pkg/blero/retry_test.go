@@ -0,0 +1,244 @@
+package blero
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newRetryTestBlero starts a Blero retrying failed jobs with policy
+func newRetryTestBlero(t *testing.T, policy RetryPolicy) *Blero {
+	opts := DefaultOptions("")
+	opts.Backend = NewMemoryBackend()
+	opts.RetryPolicy = policy
+	bl, err := NewWithOptions(opts)
+	assert.NoError(t, err)
+	assert.NoError(t, bl.Start())
+	t.Cleanup(func() { bl.Stop() })
+	return bl
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{Backoff: time.Second, MaxBackoff: 10 * time.Second}
+	assert.Equal(t, time.Second, p.backoff(1))
+	assert.Equal(t, 2*time.Second, p.backoff(2))
+	assert.Equal(t, 8*time.Second, p.backoff(4))
+	assert.Equal(t, 10*time.Second, p.backoff(5))
+	assert.Equal(t, 10*time.Second, p.backoff(1000))
+
+	// uncapped backoffs don't overflow
+	p.MaxBackoff = 0
+	assert.Greater(t, p.backoff(1000), time.Duration(0))
+}
+
+func TestBlero_RetryPolicy(t *testing.T) {
+	bl := newRetryTestBlero(t, RetryPolicy{MaxAttempts: 3, Backoff: 20 * time.Millisecond})
+
+	var l sync.Mutex
+	var started []time.Time
+	bl.RegisterProcessorFunc(func(j *Job) error {
+		l.Lock()
+		defer l.Unlock()
+		started = append(started, time.Now())
+		return errors.New("boom")
+	})
+
+	id, err := bl.EnqueueJob("TestJob", nil)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		_, status, err := bl.GetJob(id)
+		return err == nil && status == JobFailed
+	}, time.Second, 10*time.Millisecond)
+
+	j, _, err := bl.GetJob(id)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, j.Attempts)
+	l.Lock()
+	defer l.Unlock()
+	if assert.Len(t, started, 3) {
+		// the backoff doubles between retries
+		assert.GreaterOrEqual(t, started[1].Sub(started[0]), 20*time.Millisecond)
+		assert.GreaterOrEqual(t, started[2].Sub(started[1]), 40*time.Millisecond)
+	}
+
+	history, err := bl.JobHistory(id)
+	assert.NoError(t, err)
+	var to []string
+	for _, t := range history {
+		to = append(to, t.To)
+	}
+	assert.Equal(t, []string{"pending", "inprogress", "pending", "inprogress", "pending", "inprogress", "failed"}, to)
+	assert.Equal(t, "boom", history[2].Error)
+}
+
+func TestBlero_ErrorClassification(t *testing.T) {
+	bl := newRetryTestBlero(t, RetryPolicy{MaxAttempts: 5, Backoff: time.Hour})
+
+	var l sync.Mutex
+	runs := make(map[string]int)
+	bl.RegisterProcessorFunc(func(j *Job) error {
+		l.Lock()
+		runs[j.Name]++
+		n := runs[j.Name]
+		l.Unlock()
+
+		switch {
+		case j.Name == "Permanent":
+			return Permanent(errors.New("invalid card"))
+		case j.Name == "RetryAfter" && n == 1:
+			// retried sooner than the policy backoff
+			return RetryAfter(errors.New("rate limited"), 10*time.Millisecond)
+		case j.Name == "Snooze" && n < 3:
+			return Snooze(10 * time.Millisecond)
+		}
+		return nil
+	})
+
+	ids := make(map[string]uint64)
+	for _, name := range []string{"Permanent", "RetryAfter", "Snooze"} {
+		id, err := bl.EnqueueJob(name, nil)
+		assert.NoError(t, err)
+		ids[name] = id
+	}
+
+	assert.Eventually(t, func() bool {
+		counts, err := bl.CountJobs()
+		return err == nil && counts[JobFailed] == 1 && counts[JobComplete] == 2
+	}, time.Second, 10*time.Millisecond)
+
+	j, status, err := bl.GetJob(ids["Permanent"])
+	assert.NoError(t, err)
+	assert.Equal(t, JobFailed, status)
+	assert.Equal(t, 1, j.Attempts)
+
+	j, _, err = bl.GetJob(ids["RetryAfter"])
+	assert.NoError(t, err)
+	assert.Equal(t, 2, j.Attempts)
+
+	// snoozed attempts are not counted
+	j, _, err = bl.GetJob(ids["Snooze"])
+	assert.NoError(t, err)
+	assert.Equal(t, 1, j.Attempts)
+	history, err := bl.JobHistory(ids["Snooze"])
+	assert.NoError(t, err)
+	if assert.Len(t, history, 7) {
+		assert.Equal(t, "Snoozed for 10ms", history[2].Error)
+	}
+}
+
+func TestBlero_NackRetryPolicy(t *testing.T) {
+	bl := newRetryTestBlero(t, RetryPolicy{MaxAttempts: 2, Backoff: time.Hour})
+
+	id, err := bl.EnqueueJob("TestJob", nil)
+	assert.NoError(t, err)
+	jobs, err := bl.LeaseJobs("worker-1", 1)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+
+	// the nacked job is retried after the backoff
+	assert.NoError(t, bl.NackJobReason(id, 1, "boom"))
+	j, status, err := bl.GetJob(id)
+	assert.NoError(t, err)
+	assert.Equal(t, JobPending, status)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), j.RunAt, time.Minute)
+	jobs, err = bl.LeaseJobs("worker-1", 1)
+	assert.NoError(t, err)
+	assert.Empty(t, jobs)
+
+	// permanent errors are not retried
+	id, err = bl.EnqueueJob("TestJob", nil)
+	assert.NoError(t, err)
+	jobs, err = bl.LeaseJobs("worker-1", 1)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+	assert.NoError(t, bl.NackJobError(id, 1, Permanent(errors.New("invalid card"))))
+	_, status, err = bl.GetJob(id)
+	assert.NoError(t, err)
+	assert.Equal(t, JobFailed, status)
+}
+
+func TestBlero_LeaseJobsSkipsScheduledJobs(t *testing.T) {
+	bl := NewWithBackend(NewMemoryBackend())
+	assert.NoError(t, bl.Start())
+	defer bl.Stop()
+	q := bl.queue
+
+	defer func(f func() time.Time) { timeNow = f }(timeNow)
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return start }
+
+	id, err := q.enqueueJob(&Job{Name: "TestJob"})
+	assert.NoError(t, err)
+	_, err = q.dequeueJobs(1, "worker-1", nil, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, q.finishLease(id, 1, attemptResult{status: JobPending, runAt: start.Add(time.Minute)}))
+
+	jobs, err := bl.LeaseJobs("worker-2", 1)
+	assert.NoError(t, err)
+	assert.Empty(t, jobs)
+
+	timeNow = func() time.Time { return start.Add(time.Minute) }
+	jobs, err = bl.LeaseJobs("worker-2", 1)
+	assert.NoError(t, err)
+	if assert.Len(t, jobs, 1) {
+		assert.Equal(t, 2, jobs[0].Attempts)
+	}
+
+	// requeued jobs run at once
+	assert.NoError(t, bl.NackJob(id, 2))
+	assert.NoError(t, bl.RequeueJob(id))
+	j, _, err := bl.GetJob(id)
+	assert.NoError(t, err)
+	assert.True(t, j.RunAt.IsZero())
+}
+
+func TestErrorWrappers(t *testing.T) {
+	err := errors.New("boom")
+	assert.Nil(t, Permanent(nil))
+	assert.Nil(t, RetryAfter(nil, time.Second))
+	assert.ErrorIs(t, Permanent(err), err)
+	assert.EqualError(t, Permanent(err), "boom")
+	assert.ErrorIs(t, RetryAfter(err, time.Second), err)
+	assert.EqualError(t, RetryAfter(err, time.Second), "boom")
+	assert.EqualError(t, Snooze(time.Minute), "Snoozed for 1m0s")
+
+	// wrapped errors are classified
+	p := RetryPolicy{MaxAttempts: 3, Backoff: time.Second}
+	res := p.failedAttempt(1, fmt.Errorf("charge: %w", Permanent(err)))
+	assert.Equal(t, JobFailed, res.status)
+	res = p.failedAttempt(1, err)
+	assert.Equal(t, JobPending, res.status)
+	assert.False(t, res.snooze)
+
+	// the last attempt fails the job, even when asking for a retry
+	res = p.failedAttempt(3, RetryAfter(err, time.Second))
+	assert.Equal(t, JobFailed, res.status)
+	res = p.failedAttempt(3, Snooze(time.Second))
+	assert.Equal(t, JobPending, res.status)
+	assert.True(t, res.snooze)
+
+	// the zero policy only retries the jobs asking for it, without limit
+	p = RetryPolicy{}
+	res = p.failedAttempt(1, err)
+	assert.Equal(t, JobFailed, res.status)
+	res = p.failedAttempt(10, RetryAfter(err, time.Second))
+	assert.Equal(t, JobPending, res.status)
+	assert.WithinDuration(t, timeNow().Add(time.Second), res.runAt, time.Second)
+	res = p.expiredAttempt(10)
+	assert.Equal(t, JobPending, res.status)
+
+	// without MaxAttempts the jobs are retried without limit
+	p = RetryPolicy{Backoff: time.Second}
+	res = p.failedAttempt(100, err)
+	assert.Equal(t, JobPending, res.status)
+}
+
+func TestOptions_ValidateRetryPolicy(t *testing.T) {
+	opts := DefaultOptions(testDBPath)
+	opts.RetryPolicy = RetryPolicy{MaxAttempts: -1}
+	assert.EqualError(t, opts.validate(), "RetryPolicy: MaxAttempts cannot be negative, got -1")
+}
@@ -0,0 +1,46 @@
+package blero
+
+import "errors"
+
+// Backend is the storage engine behind the job store
+// It is an ordered key/value store with serializable transactions, the job operations
+// (enqueue, dequeue, status moves, lookups, iteration) are implemented once on top of it
+type Backend interface {
+	// View runs fn in a read-only transaction
+	View(fn func(tx Tx) error) error
+	// Update runs fn in a read-write transaction, which is committed if fn returns nil and discarded otherwise
+	Update(fn func(tx Tx) error) error
+	// GetSequence returns a monotonically increasing sequence persisted under name
+	// bandwidth is a hint of how many numbers can be leased at once
+	GetSequence(name string, bandwidth uint64) (Sequence, error)
+	// Close releases the backend resources
+	Close() error
+}
+
+// Tx is a backend transaction
+type Tx interface {
+	// Get returns the value for key or ErrKeyNotFound
+	Get(key []byte) ([]byte, error)
+	// Set stores value under key
+	Set(key []byte, value []byte) error
+	// Delete removes key
+	Delete(key []byte) error
+	// Iterate calls fn for the keys starting with prefix in ascending order, beginning at seek (or prefix when seek is nil)
+	// Iteration stops when fn returns false or an error, keys and values passed to fn may be retained
+	// The transaction can be modified from fn
+	Iterate(prefix []byte, seek []byte, fn func(k, v []byte) (bool, error)) error
+}
+
+// Sequence generates job IDs
+type Sequence interface {
+	// Next returns the next number of the sequence
+	Next() (uint64, error)
+	// Release releases leased numbers that were not used
+	Release() error
+}
+
+// ErrKeyNotFound is returned by Tx.Get when a key doesn't exist
+var ErrKeyNotFound = errors.New("Key not found")
+
+// ErrReadOnlyTx is returned when writing in a read-only transaction
+var ErrReadOnlyTx = errors.New("No sets or deletes are allowed in a read-only transaction")
@@ -0,0 +1,243 @@
+package blero
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// badgerBackend is the default Backend, backed by BadgerDB
+type badgerBackend struct {
+	db *badger.DB
+	// shared dbs are opened and closed by the application
+	shared bool
+}
+
+// badgerBackend returns the badger backend of the queue, if any
+func (q *queue) badgerBackend() (*badgerBackend, bool) {
+	backend := q.backend
+	if nb, ok := backend.(*namespacedBackend); ok {
+		backend = nb.Backend
+	}
+	b, ok := backend.(*badgerBackend)
+	return b, ok
+}
+
+// badgerLogger adapts a slog.Logger to badger.Logger
+// badger info logs are very verbose so they are logged at the debug level
+type badgerLogger struct {
+	logger *slog.Logger
+}
+
+func (l *badgerLogger) Infof(format string, a ...interface{}) {
+	l.log(slog.LevelDebug, format, a...)
+}
+func (l *badgerLogger) Errorf(format string, a ...interface{}) {
+	l.log(slog.LevelError, format, a...)
+}
+func (l *badgerLogger) Warningf(format string, a ...interface{}) {
+	l.log(slog.LevelWarn, format, a...)
+}
+
+func (l *badgerLogger) Debugf(format string, a ...interface{}) {
+	l.log(slog.LevelDebug, format, a...)
+}
+
+func (l *badgerLogger) log(level slog.Level, format string, a ...interface{}) {
+	// badger messages end with a newline
+	msg := strings.TrimSuffix(fmt.Sprintf(format, a...), "\n")
+	l.logger.Log(context.Background(), level, msg, "component", "badger")
+}
+
+// ErrEncryptionKeyMismatch is returned when the badger db was encrypted with another key, or when encryption was enabled or disabled since it was created
+var ErrEncryptionKeyMismatch = errors.New("Encryption key mismatch, the db was created with another EncryptionKey or with encryption disabled/enabled")
+
+// badgerOptions returns the badger options of the db at opts.DBPath
+func (opts queueOpts) badgerOptions() badger.Options {
+	badgerOpts := badger.DefaultOptions(opts.DBPath)
+	badgerOpts.Logger = &badgerLogger{logger: opts.Logger}
+	badgerOpts.SyncWrites = opts.SyncWrites
+	badgerOpts.IndexCacheSize = opts.IndexCacheSize
+	if len(opts.EncryptionKey) > 0 {
+		badgerOpts.EncryptionKey = opts.EncryptionKey
+		badgerOpts.EncryptionKeyRotationDuration = opts.EncryptionKeyRotation
+		if badgerOpts.IndexCacheSize == 0 {
+			badgerOpts.IndexCacheSize = defaultIndexCacheSize
+		}
+	}
+	return badgerOpts
+}
+
+// openBadgerBackend opens a badger db
+func openBadgerBackend(badgerOpts badger.Options) (*badgerBackend, error) {
+	db, err := badger.Open(badgerOpts)
+	if errors.Is(err, badger.ErrEncryptionKeyMismatch) {
+		return nil, fmt.Errorf("Cannot open %v: %w", badgerOpts.Dir, ErrEncryptionKeyMismatch)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &badgerBackend{db: db}, nil
+}
+
+// RotateEncryptionKey re-encrypts the data keys of a closed badger db at dbPath with newKey
+// Badger encrypts the data with data keys, which are encrypted with the EncryptionKey, so the data is not rewritten
+// The db must not be open, use newKey as EncryptionKey when opening it afterwards
+func RotateEncryptionKey(dbPath string, oldKey []byte, newKey []byte) error {
+	for _, key := range [][]byte{oldKey, newKey} {
+		err := validateEncryptionKey(key)
+		if err != nil {
+			return err
+		}
+	}
+
+	opts := badger.KeyRegistryOptions{
+		Dir:                           dbPath,
+		ReadOnly:                      true,
+		EncryptionKey:                 oldKey,
+		EncryptionKeyRotationDuration: defaultEncryptionKeyRotation,
+	}
+	kr, err := badger.OpenKeyRegistry(opts)
+	if errors.Is(err, badger.ErrEncryptionKeyMismatch) {
+		return fmt.Errorf("Cannot open %v: %w", dbPath, ErrEncryptionKeyMismatch)
+	}
+	if err != nil {
+		return err
+	}
+	defer kr.Close()
+
+	opts.EncryptionKey = newKey
+	return badger.WriteKeyRegistry(kr, opts)
+}
+
+// validateEncryptionKey checks that a key can be used for AES-128, AES-192 or AES-256
+func validateEncryptionKey(key []byte) error {
+	switch len(key) {
+	case 16, 24, 32:
+		return nil
+	}
+	return fmt.Errorf("EncryptionKey must be 16, 24 or 32 bytes long, got %v", len(key))
+}
+
+// View runs fn in a read-only badger transaction
+func (b *badgerBackend) View(fn func(tx Tx) error) error {
+	return b.db.View(func(txn *badger.Txn) error {
+		return fn(&badgerTx{txn: txn})
+	})
+}
+
+// Update runs fn in a read-write badger transaction
+func (b *badgerBackend) Update(fn func(tx Tx) error) error {
+	return b.db.Update(func(txn *badger.Txn) error {
+		return fn(&badgerTx{txn: txn})
+	})
+}
+
+// GetSequence returns a badger sequence
+func (b *badgerBackend) GetSequence(name string, bandwidth uint64) (Sequence, error) {
+	seq, err := b.db.GetSequence([]byte(name), bandwidth)
+	if err != nil {
+		return nil, err
+	}
+	return &badgerSequence{seq: seq}, nil
+}
+
+// Close closes the badger db
+func (b *badgerBackend) Close() error {
+	if b.shared {
+		return nil
+	}
+	return b.db.Close()
+}
+
+// badgerTx wraps a badger transaction
+type badgerTx struct {
+	txn *badger.Txn
+}
+
+// Get returns the value for key
+func (tx *badgerTx) Get(key []byte) ([]byte, error) {
+	item, err := tx.txn.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return item.ValueCopy(nil)
+}
+
+// Set stores value under key
+func (tx *badgerTx) Set(key []byte, value []byte) error {
+	return badgerTxErr(tx.txn.Set(key, value))
+}
+
+// Delete removes key
+func (tx *badgerTx) Delete(key []byte) error {
+	return badgerTxErr(tx.txn.Delete(key))
+}
+
+// badgerTxErr maps badger write errors to backend errors
+func badgerTxErr(err error) error {
+	if err == badger.ErrReadOnlyTxn {
+		return ErrReadOnlyTx
+	}
+	return err
+}
+
+// Iterate iterates over the keys starting with prefix
+func (tx *badgerTx) Iterate(prefix []byte, seek []byte, fn func(k, v []byte) (bool, error)) error {
+	itOpts := badger.DefaultIteratorOptions
+	itOpts.Prefix = prefix
+	it := tx.txn.NewIterator(itOpts)
+	defer it.Close()
+
+	if seek == nil {
+		seek = prefix
+	}
+
+	for it.Seek(seek); it.ValidForPrefix(prefix); it.Next() {
+		item := it.Item()
+		v, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+
+		cont, err := fn(item.KeyCopy(nil), v)
+		if err != nil || !cont {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// badgerSequence wraps a badger sequence
+type badgerSequence struct {
+	seq *badger.Sequence
+}
+
+// Next returns the next number of the sequence
+func (s *badgerSequence) Next() (num uint64, err error) {
+	defer func() {
+		r := recover()
+		if r != nil {
+			// recover from panic and send err instead
+			err = r.(error)
+		}
+	}()
+
+	num, err = s.seq.Next()
+	return num, err
+}
+
+// Release releases the leased numbers
+func (s *badgerSequence) Release() error {
+	return s.seq.Release()
+}
@@ -0,0 +1,192 @@
+package blero
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// bolt buckets
+var (
+	boltDataBucket = []byte("blero")
+	boltSeqBucket  = []byte("blero-sequences")
+)
+
+// boltBackend is a Backend storing all keys in a single bbolt file
+type boltBackend struct {
+	db *bolt.DB
+}
+
+// NewBoltBackend opens or creates a bbolt backed Backend at path
+func NewBoltBackend(path string) (Backend, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(btx *bolt.Tx) error {
+		_, err := btx.CreateBucketIfNotExists(boltDataBucket)
+		if err != nil {
+			return err
+		}
+		_, err = btx.CreateBucketIfNotExists(boltSeqBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &boltBackend{db: db}, nil
+}
+
+// View runs fn in a read-only bolt transaction
+func (b *boltBackend) View(fn func(tx Tx) error) error {
+	return b.db.View(func(btx *bolt.Tx) error {
+		return fn(&boltTx{bucket: btx.Bucket(boltDataBucket)})
+	})
+}
+
+// Update runs fn in a read-write bolt transaction
+func (b *boltBackend) Update(fn func(tx Tx) error) error {
+	return b.db.Update(func(btx *bolt.Tx) error {
+		return fn(&boltTx{bucket: btx.Bucket(boltDataBucket), writable: true})
+	})
+}
+
+// GetSequence returns a sequence stored in its own bolt bucket
+func (b *boltBackend) GetSequence(name string, bandwidth uint64) (Sequence, error) {
+	if bandwidth == 0 {
+		return nil, errors.New("Sequence bandwidth must be greater than 0")
+	}
+	err := b.db.Update(func(btx *bolt.Tx) error {
+		_, err := btx.Bucket(boltSeqBucket).CreateBucketIfNotExists([]byte(name))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &boltSequence{db: b.db, name: []byte(name), bandwidth: bandwidth}, nil
+}
+
+// Close closes the bolt db
+func (b *boltBackend) Close() error {
+	return b.db.Close()
+}
+
+// boltTx wraps a bolt transaction
+type boltTx struct {
+	bucket   *bolt.Bucket
+	writable bool
+}
+
+// Get returns the value for key
+func (tx *boltTx) Get(key []byte) ([]byte, error) {
+	v := tx.bucket.Get(key)
+	if v == nil {
+		return nil, ErrKeyNotFound
+	}
+	return append([]byte{}, v...), nil
+}
+
+// Set stores value under key
+func (tx *boltTx) Set(key []byte, value []byte) error {
+	if !tx.writable {
+		return ErrReadOnlyTx
+	}
+	// bolt reads nil values as missing keys
+	if value == nil {
+		value = []byte{}
+	}
+	return tx.bucket.Put(key, value)
+}
+
+// Delete removes key
+func (tx *boltTx) Delete(key []byte) error {
+	if !tx.writable {
+		return ErrReadOnlyTx
+	}
+	return tx.bucket.Delete(key)
+}
+
+// Iterate iterates over the keys starting with prefix
+func (tx *boltTx) Iterate(prefix []byte, seek []byte, fn func(k, v []byte) (bool, error)) error {
+	if seek == nil || bytes.Compare(seek, prefix) < 0 {
+		seek = prefix
+	}
+
+	c := tx.bucket.Cursor()
+	for k, v := c.Seek(seek); k != nil && bytes.HasPrefix(k, prefix); {
+		k = append([]byte(nil), k...)
+		cont, err := fn(k, append([]byte{}, v...))
+		if err != nil || !cont {
+			return err
+		}
+
+		// fn might have modified the bucket which invalidates the cursor, seek past k again
+		var next []byte
+		next, v = c.Seek(k)
+		if bytes.Equal(next, k) {
+			next, v = c.Next()
+		}
+		k = next
+	}
+
+	return nil
+}
+
+// boltSequence is a sequence backed by a bolt bucket sequence
+// Like badger sequences, numbers are leased bandwidth at a time to avoid a write transaction per number
+type boltSequence struct {
+	l         sync.Mutex
+	db        *bolt.DB
+	name      []byte
+	bandwidth uint64
+	// next is the next number, numbers up to leased are leased
+	next   uint64
+	leased uint64
+}
+
+// Next returns the next number of the sequence, starting at 0
+func (s *boltSequence) Next() (uint64, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if s.next >= s.leased {
+		err := s.db.Update(func(btx *bolt.Tx) error {
+			// the bucket sequence holds the end of the last lease
+			b := btx.Bucket(boltSeqBucket).Bucket(s.name)
+			s.next = b.Sequence()
+			return b.SetSequence(s.next + s.bandwidth)
+		})
+		if err != nil {
+			return 0, err
+		}
+		s.leased = s.next + s.bandwidth
+	}
+
+	num := s.next
+	s.next++
+	return num, nil
+}
+
+// Release returns the unused leased numbers so that the sequence continues from the next number
+func (s *boltSequence) Release() error {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if s.next >= s.leased {
+		return nil
+	}
+	err := s.db.Update(func(btx *bolt.Tx) error {
+		return btx.Bucket(boltSeqBucket).Bucket(s.name).SetSequence(s.next)
+	})
+	if err != nil {
+		return err
+	}
+	s.leased = s.next
+	return nil
+}
@@ -0,0 +1,209 @@
+package blero
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// ErrBackendClosed is returned when using a closed backend
+var ErrBackendClosed = errors.New("DB Closed")
+
+// memoryBackend is a non persistent Backend keeping all keys in memory, useful for fast unit tests
+type memoryBackend struct {
+	l      sync.RWMutex
+	closed bool
+	// keys sorted in ascending order
+	keys   []string
+	values map[string][]byte
+	seqs   map[string]*memorySequence
+}
+
+// NewMemoryBackend creates a new in-memory Backend
+func NewMemoryBackend() Backend {
+	return &memoryBackend{
+		values: make(map[string][]byte),
+		seqs:   make(map[string]*memorySequence),
+	}
+}
+
+// View runs fn in a read-only transaction
+func (b *memoryBackend) View(fn func(tx Tx) error) error {
+	b.l.RLock()
+	defer b.l.RUnlock()
+	if b.closed {
+		return ErrBackendClosed
+	}
+
+	return fn(&memoryTx{b: b})
+}
+
+// Update runs fn in a read-write transaction, writes are rolled back if fn fails
+func (b *memoryBackend) Update(fn func(tx Tx) error) error {
+	b.l.Lock()
+	defer b.l.Unlock()
+	if b.closed {
+		return ErrBackendClosed
+	}
+
+	tx := &memoryTx{b: b, writable: true, undo: make(map[string]memoryUndo)}
+	err := fn(tx)
+	if err != nil {
+		tx.rollback()
+	}
+	return err
+}
+
+// GetSequence returns an in-memory sequence
+func (b *memoryBackend) GetSequence(name string, bandwidth uint64) (Sequence, error) {
+	b.l.Lock()
+	defer b.l.Unlock()
+	if b.closed {
+		return nil, ErrBackendClosed
+	}
+
+	seq, ok := b.seqs[name]
+	if !ok {
+		seq = &memorySequence{}
+		b.seqs[name] = seq
+	}
+	return seq, nil
+}
+
+// Close marks the backend closed
+func (b *memoryBackend) Close() error {
+	b.l.Lock()
+	defer b.l.Unlock()
+	b.closed = true
+	return nil
+}
+
+// set stores a value and keeps the keys sorted, must hold the write lock
+func (b *memoryBackend) set(k string, v []byte) {
+	if _, ok := b.values[k]; !ok {
+		i := sort.SearchStrings(b.keys, k)
+		b.keys = append(b.keys, "")
+		copy(b.keys[i+1:], b.keys[i:])
+		b.keys[i] = k
+	}
+	b.values[k] = v
+}
+
+// delete removes a value, must hold the write lock
+func (b *memoryBackend) delete(k string) {
+	if _, ok := b.values[k]; !ok {
+		return
+	}
+	i := sort.SearchStrings(b.keys, k)
+	b.keys = append(b.keys[:i], b.keys[i+1:]...)
+	delete(b.values, k)
+}
+
+// memoryTx is an in-memory transaction
+// writes are applied directly and the previous values kept to roll back
+type memoryTx struct {
+	b        *memoryBackend
+	writable bool
+	// previous values of modified keys
+	undo map[string]memoryUndo
+}
+
+// memoryUndo holds the value of a key before a transaction modified it
+type memoryUndo struct {
+	v       []byte
+	existed bool
+}
+
+// Get returns the value for key
+func (tx *memoryTx) Get(key []byte) ([]byte, error) {
+	v, ok := tx.b.values[string(key)]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return append([]byte(nil), v...), nil
+}
+
+// Set stores value under key
+func (tx *memoryTx) Set(key []byte, value []byte) error {
+	if !tx.writable {
+		return ErrReadOnlyTx
+	}
+	tx.saveUndo(string(key))
+	tx.b.set(string(key), append([]byte(nil), value...))
+	return nil
+}
+
+// Delete removes key
+func (tx *memoryTx) Delete(key []byte) error {
+	if !tx.writable {
+		return ErrReadOnlyTx
+	}
+	tx.saveUndo(string(key))
+	tx.b.delete(string(key))
+	return nil
+}
+
+// Iterate iterates over the keys starting with prefix
+func (tx *memoryTx) Iterate(prefix []byte, seek []byte, fn func(k, v []byte) (bool, error)) error {
+	if seek == nil || bytes.Compare(seek, prefix) < 0 {
+		seek = prefix
+	}
+
+	i := sort.SearchStrings(tx.b.keys, string(seek))
+	for i < len(tx.b.keys) {
+		k := tx.b.keys[i]
+		if !bytes.HasPrefix([]byte(k), prefix) {
+			return nil
+		}
+
+		cont, err := fn([]byte(k), append([]byte(nil), tx.b.values[k]...))
+		if err != nil || !cont {
+			return err
+		}
+
+		// fn might have modified the keys, find the next key after k
+		i = sort.Search(len(tx.b.keys), func(i int) bool { return tx.b.keys[i] > k })
+	}
+
+	return nil
+}
+
+func (tx *memoryTx) saveUndo(k string) {
+	if _, ok := tx.undo[k]; ok {
+		return
+	}
+	v, ok := tx.b.values[k]
+	tx.undo[k] = memoryUndo{v: v, existed: ok}
+}
+
+// rollback restores the previous values
+func (tx *memoryTx) rollback() {
+	for k, u := range tx.undo {
+		if u.existed {
+			tx.b.set(k, u.v)
+		} else {
+			tx.b.delete(k)
+		}
+	}
+}
+
+// memorySequence is an in-memory sequence
+type memorySequence struct {
+	l   sync.Mutex
+	num uint64
+}
+
+// Next returns the next number of the sequence, starting at 0
+func (s *memorySequence) Next() (uint64, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	num := s.num
+	s.num++
+	return num, nil
+}
+
+// Release is a no-op for in-memory sequences
+func (s *memorySequence) Release() error {
+	return nil
+}
@@ -0,0 +1,78 @@
+package blero
+
+// namespacedBackend prefixes the keys and sequence names of a Backend with a namespace
+// so that Blero can share a db with other key spaces
+type namespacedBackend struct {
+	Backend
+	ns string
+}
+
+// newNamespacedBackend returns backend with its keys prefixed by ns, or backend itself when ns is empty
+func newNamespacedBackend(backend Backend, ns string) Backend {
+	if ns == "" {
+		return backend
+	}
+	return &namespacedBackend{Backend: backend, ns: ns}
+}
+
+// View runs fn in a read-only namespaced transaction
+func (b *namespacedBackend) View(fn func(tx Tx) error) error {
+	return b.Backend.View(func(tx Tx) error {
+		return fn(newNamespacedTx(tx, b.ns))
+	})
+}
+
+// Update runs fn in a read-write namespaced transaction
+func (b *namespacedBackend) Update(fn func(tx Tx) error) error {
+	return b.Backend.Update(func(tx Tx) error {
+		return fn(newNamespacedTx(tx, b.ns))
+	})
+}
+
+// GetSequence returns a sequence persisted under the namespaced name
+func (b *namespacedBackend) GetSequence(name string, bandwidth uint64) (Sequence, error) {
+	return b.Backend.GetSequence(b.ns+name, bandwidth)
+}
+
+// namespacedTx prefixes the keys of a transaction with a namespace
+type namespacedTx struct {
+	tx Tx
+	ns string
+}
+
+// newNamespacedTx returns tx with its keys prefixed by ns, or tx itself when ns is empty
+func newNamespacedTx(tx Tx, ns string) Tx {
+	if ns == "" {
+		return tx
+	}
+	return &namespacedTx{tx: tx, ns: ns}
+}
+
+func (tx *namespacedTx) key(k []byte) []byte {
+	return append([]byte(tx.ns), k...)
+}
+
+// Get returns the value for key
+func (tx *namespacedTx) Get(key []byte) ([]byte, error) {
+	return tx.tx.Get(tx.key(key))
+}
+
+// Set stores value under key
+func (tx *namespacedTx) Set(key []byte, value []byte) error {
+	return tx.tx.Set(tx.key(key), value)
+}
+
+// Delete removes key
+func (tx *namespacedTx) Delete(key []byte) error {
+	return tx.tx.Delete(tx.key(key))
+}
+
+// Iterate iterates over the keys starting with prefix, fn gets the keys without the namespace
+func (tx *namespacedTx) Iterate(prefix []byte, seek []byte, fn func(k, v []byte) (bool, error)) error {
+	if seek != nil {
+		seek = tx.key(seek)
+	}
+	return tx.tx.Iterate(tx.key(prefix), seek, func(k, v []byte) (bool, error) {
+		return fn(k[len(tx.ns):], v)
+	})
+}
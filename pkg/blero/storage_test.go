@@ -0,0 +1,390 @@
+package blero
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// backendFactories opens a fresh instance of each Backend implementation
+var backendFactories = map[string]func(t *testing.T) Backend{
+	"badger": func(t *testing.T) Backend {
+		b, err := openBadgerBackend(queueOpts{DBPath: t.TempDir(), Logger: slog.New(slog.DiscardHandler), SyncWrites: true}.badgerOptions())
+		assert.NoError(t, err)
+		return b
+	},
+	"memory": func(t *testing.T) Backend {
+		return NewMemoryBackend()
+	},
+	"bolt": func(t *testing.T) Backend {
+		b, err := NewBoltBackend(filepath.Join(t.TempDir(), "blero.db"))
+		assert.NoError(t, err)
+		return b
+	},
+}
+
+// TestBackends_Conformance runs the shared conformance suite against all Backend implementations
+func TestBackends_Conformance(t *testing.T) {
+	for name, newBackend := range backendFactories {
+		t.Run(name, func(t *testing.T) {
+			testBackendKV(t, newBackend(t))
+			testBackendRollback(t, newBackend(t))
+			testBackendSequence(t, newBackend(t))
+			testBackendJobs(t, newBackend(t))
+		})
+	}
+}
+
+func testBackendKV(t *testing.T, b Backend) {
+	defer b.Close()
+
+	err := b.Update(func(tx Tx) error {
+		_, err := tx.Get([]byte("a:1"))
+		assert.Equal(t, ErrKeyNotFound, err)
+
+		for _, k := range []string{"a:3", "a:1", "b:1", "a:2", "0:1"} {
+			assert.NoError(t, tx.Set([]byte(k), []byte("v"+k)))
+		}
+		assert.NoError(t, tx.Set([]byte("a:4"), nil))
+
+		return tx.Delete([]byte("a:3"))
+	})
+	assert.NoError(t, err)
+
+	err = b.View(func(tx Tx) error {
+		v, err := tx.Get([]byte("a:2"))
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("va:2"), v)
+
+		// empty values are valid
+		v, err = tx.Get([]byte("a:4"))
+		assert.NoError(t, err)
+		assert.Len(t, v, 0)
+
+		var keys []string
+		err = tx.Iterate([]byte("a:"), nil, func(k, v []byte) (bool, error) {
+			keys = append(keys, string(k))
+			return true, nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a:1", "a:2", "a:4"}, keys)
+
+		// seek and stop early
+		keys = nil
+		err = tx.Iterate([]byte("a:"), []byte("a:2"), func(k, v []byte) (bool, error) {
+			keys = append(keys, string(k))
+			return false, nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a:2"}, keys)
+
+		// errors are returned
+		err = tx.Iterate([]byte("a:"), nil, func(k, v []byte) (bool, error) {
+			return true, errors.New("iterate failed")
+		})
+		assert.EqualError(t, err, "iterate failed")
+
+		return tx.Set([]byte("a:5"), nil)
+	})
+	assert.Equal(t, ErrReadOnlyTx, err)
+
+	// the transaction can be modified while iterating
+	err = b.Update(func(tx Tx) error {
+		return tx.Iterate([]byte("a:"), nil, func(k, v []byte) (bool, error) {
+			err := tx.Delete(k)
+			if err != nil {
+				return false, err
+			}
+			return true, tx.Set(append([]byte("c"), k[1:]...), v)
+		})
+	})
+	assert.NoError(t, err)
+
+	err = b.View(func(tx Tx) error {
+		var keys []string
+		err := tx.Iterate([]byte(""), nil, func(k, v []byte) (bool, error) {
+			keys = append(keys, string(k))
+			return true, nil
+		})
+		assert.Equal(t, []string{"0:1", "b:1", "c:1", "c:2", "c:4"}, keys)
+		return err
+	})
+	assert.NoError(t, err)
+}
+
+func testBackendRollback(t *testing.T, b Backend) {
+	defer b.Close()
+
+	err := b.Update(func(tx Tx) error {
+		return tx.Set([]byte("k1"), []byte("v1"))
+	})
+	assert.NoError(t, err)
+
+	err = b.Update(func(tx Tx) error {
+		assert.NoError(t, tx.Set([]byte("k1"), []byte("v2")))
+		assert.NoError(t, tx.Set([]byte("k2"), []byte("v2")))
+		return errors.New("rollback")
+	})
+	assert.EqualError(t, err, "rollback")
+
+	err = b.View(func(tx Tx) error {
+		v, err := tx.Get([]byte("k1"))
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("v1"), v)
+
+		_, err = tx.Get([]byte("k2"))
+		assert.Equal(t, ErrKeyNotFound, err)
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func testBackendSequence(t *testing.T, b Backend) {
+	defer b.Close()
+
+	seq, err := b.GetSequence("test", 10)
+	assert.NoError(t, err)
+
+	var last uint64
+	for i := 0; i < 25; i++ {
+		num, err := seq.Next()
+		assert.NoError(t, err)
+		if i == 0 {
+			assert.Equal(t, uint64(0), num)
+		} else {
+			assert.True(t, num > last)
+		}
+		last = num
+	}
+	assert.NoError(t, seq.Release())
+
+	// sequences continue after being released
+	seq, err = b.GetSequence("test", 10)
+	assert.NoError(t, err)
+	num, err := seq.Next()
+	assert.NoError(t, err)
+	assert.True(t, num > last)
+	assert.NoError(t, seq.Release())
+}
+
+func TestBoltBackend_SequenceLease(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blero.db")
+	b, err := NewBoltBackend(path)
+	assert.NoError(t, err)
+
+	_, err = b.GetSequence("test", 0)
+	assert.EqualError(t, err, "Sequence bandwidth must be greater than 0")
+
+	seq, err := b.GetSequence("test", 10)
+	assert.NoError(t, err)
+	for i := 0; i < 15; i++ {
+		num, err := seq.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(i), num)
+	}
+	// numbers are leased 10 at a time
+	leased := seq.(*boltSequence).leased
+	assert.Equal(t, uint64(20), leased)
+
+	// released numbers are reused
+	assert.NoError(t, seq.Release())
+	seq, err = b.GetSequence("test", 10)
+	assert.NoError(t, err)
+	num, err := seq.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(15), num)
+
+	// leased numbers aren't reused when the sequence isn't released, the write fails on a closed db
+	assert.NoError(t, b.Close())
+	b, err = NewBoltBackend(path)
+	assert.NoError(t, err)
+	defer b.Close()
+	seq2, err := b.GetSequence("test", 10)
+	assert.NoError(t, err)
+	num, err = seq2.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(25), num)
+
+	for i := 0; i < 9; i++ {
+		_, err = seq.Next()
+		assert.NoError(t, err)
+	}
+	num, err = seq.Next()
+	assert.Error(t, err)
+	assert.Equal(t, uint64(0), num)
+}
+
+// sequenceFailingBackend fails to get sequences
+type sequenceFailingBackend struct {
+	Backend
+	closed bool
+}
+
+func (b *sequenceFailingBackend) GetSequence(name string, bandwidth uint64) (Sequence, error) {
+	return nil, errors.New("no sequence")
+}
+
+func (b *sequenceFailingBackend) Close() error {
+	b.closed = true
+	return b.Backend.Close()
+}
+
+func TestQueue_StartSequenceError(t *testing.T) {
+	backend := &sequenceFailingBackend{Backend: NewMemoryBackend()}
+	opts := DefaultOptions("")
+	opts.Backend = backend
+	q := newQueue(opts.queueOpts())
+	assert.EqualError(t, q.start(), "no sequence")
+	assert.True(t, backend.closed)
+}
+
+func testBackendJobs(t *testing.T, b Backend) {
+	opts := DefaultOptions("")
+	opts.Backend = b
+	q := newQueue(opts.queueOpts())
+	assert.NoError(t, q.start())
+	defer q.stop()
+
+	j1ID, err := q.enqueueJob(&Job{Name: "TestJob1", Data: []byte("data1")})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), j1ID)
+	j2ID, err := q.enqueueJob(&Job{Name: "TestJob2"})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), j2ID)
+
+	j, status, err := q.getJob(j1ID)
+	assert.NoError(t, err)
+	assert.Equal(t, JobPending, status)
+	assert.Equal(t, "TestJob1", j.Name)
+	assert.Equal(t, []byte("data1"), j.Data)
+
+	// dequeue in order
+	j, err = q.dequeueJob()
+	assert.NoError(t, err)
+	assert.Equal(t, j1ID, j.ID)
+
+	_, status, err = q.getJob(j1ID)
+	assert.NoError(t, err)
+	assert.Equal(t, JobInProgress, status)
+
+	assert.NoError(t, q.markJobDone(j1ID, JobComplete))
+	_, status, err = q.getJob(j1ID)
+	assert.NoError(t, err)
+	assert.Equal(t, JobComplete, status)
+
+	j, err = q.dequeueJob()
+	assert.NoError(t, err)
+	assert.Equal(t, j2ID, j.ID)
+	assert.NoError(t, q.markJobDone(j2ID, JobFailed))
+
+	// nothing left
+	j, err = q.dequeueJob()
+	assert.NoError(t, err)
+	assert.Nil(t, j)
+
+	err = q.markJobDone(j2ID, JobComplete)
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	_, _, err = q.getJob(1234)
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	var names []string
+	for _, s := range jobStatuses {
+		err = q.iterateJobs(s, func(j *Job) (bool, error) {
+			names = append(names, s.String()+":"+j.Name)
+			return true, nil
+		})
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []string{"complete:TestJob1", "failed:TestJob2"}, names)
+}
+
+func TestBlero_Encryption(t *testing.T) {
+	dbPath := t.TempDir()
+	key := []byte("0123456789abcdef0123456789abcdef")
+	secret := []byte("customer card number 4242")
+
+	opts := DefaultOptions(dbPath)
+	opts.EncryptionKey = key
+	opts.Logger = slog.New(slog.DiscardHandler)
+	bl, err := NewWithOptions(opts)
+	assert.NoError(t, err)
+	assert.NoError(t, bl.Start())
+	jID, err := bl.EnqueueJob("TestJob", secret)
+	assert.NoError(t, err)
+	assert.NoError(t, bl.Stop())
+
+	// the payload isn't stored in clear
+	files, err := os.ReadDir(dbPath)
+	assert.NoError(t, err)
+	for _, f := range files {
+		b, err := os.ReadFile(filepath.Join(dbPath, f.Name()))
+		assert.NoError(t, err)
+		assert.False(t, bytes.Contains(b, secret), f.Name())
+	}
+
+	// wrong key
+	opts.EncryptionKey = []byte("fedcba9876543210fedcba9876543210")
+	bl, err = NewWithOptions(opts)
+	assert.NoError(t, err)
+	err = bl.Start()
+	assert.True(t, errors.Is(err, ErrEncryptionKeyMismatch))
+	assert.EqualError(t, err, "Cannot open "+dbPath+": Encryption key mismatch, the db was created with another EncryptionKey or with encryption disabled/enabled")
+
+	// no key
+	opts.EncryptionKey = nil
+	bl, err = NewWithOptions(opts)
+	assert.NoError(t, err)
+	assert.True(t, errors.Is(bl.Start(), ErrEncryptionKeyMismatch))
+
+	opts.EncryptionKey = key
+	bl, err = NewWithOptions(opts)
+	assert.NoError(t, err)
+	assert.NoError(t, bl.Start())
+	defer bl.Stop()
+	j, _, err := bl.GetJob(jID)
+	assert.NoError(t, err)
+	assert.Equal(t, secret, j.Data)
+}
+
+func TestRotateEncryptionKey(t *testing.T) {
+	dbPath := t.TempDir()
+	oldKey := []byte("0123456789abcdef")
+	newKey := []byte("fedcba9876543210fedcba98")
+
+	opts := DefaultOptions(dbPath)
+	opts.EncryptionKey = oldKey
+	opts.Logger = slog.New(slog.DiscardHandler)
+	bl, err := NewWithOptions(opts)
+	assert.NoError(t, err)
+	assert.NoError(t, bl.Start())
+	jID, err := bl.EnqueueJob("TestJob", []byte("data"))
+	assert.NoError(t, err)
+	assert.NoError(t, bl.Stop())
+
+	err = RotateEncryptionKey(dbPath, newKey, oldKey)
+	assert.True(t, errors.Is(err, ErrEncryptionKeyMismatch))
+	err = RotateEncryptionKey(dbPath, oldKey, []byte("short"))
+	assert.EqualError(t, err, "EncryptionKey must be 16, 24 or 32 bytes long, got 5")
+
+	assert.NoError(t, RotateEncryptionKey(dbPath, oldKey, newKey))
+
+	// the old key doesn't open the db anymore
+	bl, err = NewWithOptions(opts)
+	assert.NoError(t, err)
+	assert.True(t, errors.Is(bl.Start(), ErrEncryptionKeyMismatch))
+
+	opts.EncryptionKey = newKey
+	bl, err = NewWithOptions(opts)
+	assert.NoError(t, err)
+	assert.NoError(t, bl.Start())
+	defer bl.Stop()
+	j, _, err := bl.GetJob(jID)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("data"), j.Data)
+}
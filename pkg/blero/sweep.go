@@ -0,0 +1,71 @@
+package blero
+
+import "time"
+
+// sweepBatchSize is the max number of jobs deleted per sweep transaction
+const sweepBatchSize = 1000
+
+// startSweepLoop periodically deletes the jobs past their retention
+func (q *queue) startSweepLoop() {
+	go func() {
+		ticker := time.NewTicker(q.opts.SweepInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				n, err := q.sweepJobs(timeNow().Add(-q.opts.Retention))
+				if err != nil {
+					q.opts.Logger.Error("Cannot sweep jobs", "error", err)
+				} else if n > 0 {
+					q.opts.Logger.Debug("Swept jobs", "count", n)
+				}
+			case <-q.quitCh: // queue was stopped
+				return
+			}
+		}
+	}()
+}
+
+// sweepJobs deletes the complete and failed jobs finished before t and returns the number of deleted jobs
+// Jobs finished before FinishedAt was recorded have a zero FinishedAt and are always swept
+func (q *queue) sweepJobs(before time.Time) (int, error) {
+	total := 0
+	for _, status := range []JobStatus{JobComplete, JobFailed} {
+		prefix := []byte(getQueueKeyPrefix(status))
+
+		var cursor []byte
+		done := false
+		for !done {
+			err := q.backend.Update(func(tx Tx) error {
+				n := 0
+				done = true
+				return tx.Iterate(prefix, cursor, func(k, v []byte) (bool, error) {
+					if n == sweepBatchSize {
+						// resume from this key in the next batch
+						cursor = k
+						done = false
+						return false, nil
+					}
+					n++
+
+					j, err := decodeJob(v)
+					if err != nil {
+						return false, err
+					}
+					if !j.FinishedAt.Before(before) {
+						return true, nil
+					}
+
+					total++
+					return true, deleteJobRecord(tx, j, status)
+				})
+			})
+			if err != nil {
+				return total, err
+			}
+		}
+	}
+
+	return total, nil
+}
@@ -0,0 +1,75 @@
+package blero
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlero_SweepJobs(t *testing.T) {
+	bl := NewWithBackend(NewMemoryBackend())
+	err := bl.Start()
+	assert.NoError(t, err)
+	defer bl.Stop()
+
+	q := bl.queue
+
+	// finish 3 jobs at different times
+	defer func(f func() time.Time) { timeNow = f }(timeNow)
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, status := range []JobStatus{JobComplete, JobFailed, JobComplete} {
+		timeNow = func() time.Time { return start.Add(time.Duration(i) * time.Hour) }
+		_, err := q.enqueueJob(&Job{Name: "TestJob"})
+		assert.NoError(t, err)
+		j, err := q.dequeueJob()
+		assert.NoError(t, err)
+		assert.NoError(t, q.markJobDone(j.ID, status))
+	}
+	// pending jobs are never swept
+	_, err = q.enqueueJob(&Job{Name: "TestJob"})
+	assert.NoError(t, err)
+
+	n, err := q.sweepJobs(start.Add(90 * time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	_, _, err = q.getJob(1)
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, _, err = q.getJob(2)
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, status, err := q.getJob(3)
+	assert.NoError(t, err)
+	assert.Equal(t, JobComplete, status)
+	_, status, err = q.getJob(4)
+	assert.NoError(t, err)
+	assert.Equal(t, JobPending, status)
+}
+
+func TestBlero_SweepLoop(t *testing.T) {
+	opts := DefaultOptions("")
+	opts.Backend = NewMemoryBackend()
+	opts.Retention = time.Millisecond
+	opts.SweepInterval = 10 * time.Millisecond
+	bl, err := NewWithOptions(opts)
+	assert.NoError(t, err)
+
+	err = bl.Start()
+	assert.NoError(t, err)
+	defer bl.Stop()
+
+	done := make(chan struct{})
+	bl.RegisterProcessorFunc(func(j *Job) error {
+		close(done)
+		return nil
+	})
+
+	jID, err := bl.EnqueueJob("TestJob", nil)
+	assert.NoError(t, err)
+	<-done
+
+	// wait for the job to be swept
+	time.Sleep(50 * time.Millisecond)
+	_, _, err = bl.queue.getJob(jID)
+	assert.Equal(t, ErrKeyNotFound, err)
+}
@@ -0,0 +1,108 @@
+package blero
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation scope of the Blero spans
+const tracerName = "github.com/didil/goblero/pkg/blero"
+
+// span names
+const (
+	spanEnqueue   = "blero.enqueue"
+	spanQueueWait = "blero.queue_wait"
+	spanProcess   = "blero.process"
+)
+
+// tracing creates the Blero spans and carries the span contexts through the job metadata
+type tracing struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+func newTracing(tp trace.TracerProvider, propagator propagation.TextMapPropagator) *tracing {
+	return &tracing{tracer: tp.Tracer(tracerName), propagator: propagator}
+}
+
+// startEnqueue starts the enqueue span and stores its context in the job metadata
+func (t *tracing) startEnqueue(ctx context.Context, j *Job) (context.Context, trace.Span) {
+	ctx, span := t.tracer.Start(ctx, spanEnqueue,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(jobNameAttr(j.Name)),
+	)
+
+	if j.Meta == nil {
+		j.Meta = make(map[string]string)
+	}
+	t.propagator.Inject(ctx, propagation.MapCarrier(j.Meta))
+
+	return ctx, span
+}
+
+// startProcess restores the enqueue span context from the job metadata
+// and starts the queue wait span, which ends when processing starts, and the process span
+// attr identifies who runs the job, the local processor or the remote worker
+func (t *tracing) startProcess(j *Job, attr attribute.KeyValue) (context.Context, trace.Span) {
+	ctx := t.propagator.Extract(context.Background(), propagation.MapCarrier(j.Meta))
+	enqueueSC := trace.SpanContextFromContext(ctx)
+
+	attrs := []attribute.KeyValue{
+		jobIDAttr(j.ID),
+		jobNameAttr(j.Name),
+		attr,
+		attribute.Int("blero.job.attempt", j.Attempts),
+	}
+
+	_, waitSpan := t.tracer.Start(ctx, spanQueueWait,
+		trace.WithTimestamp(j.EnqueuedAt),
+		trace.WithAttributes(attrs...),
+	)
+	waitSpan.End()
+
+	var links []trace.Link
+	if enqueueSC.IsValid() {
+		links = append(links, trace.Link{SpanContext: enqueueSC})
+	}
+
+	return t.tracer.Start(ctx, spanProcess,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attrs...),
+		trace.WithLinks(links...),
+	)
+}
+
+// StartProcessSpan restores the trace of a leased job from its metadata and starts its process span as the dispatcher does,
+// Job.Context carries the span until end records the result of the processor, it's used by the workers running leased jobs
+// tp and propagator default to the global provider and W3C trace context like Options.TracerProvider and Options.Propagator
+func StartProcessSpan(tp trace.TracerProvider, propagator propagation.TextMapPropagator, j *Job) (end func(err error)) {
+	t := Options{TracerProvider: tp, Propagator: propagator}.tracing()
+	ctx, span := t.startProcess(j, attribute.String("blero.lease.owner", j.LeaseOwner))
+	j.ctx = ctx
+	return func(err error) {
+		endSpan(span, err)
+	}
+}
+
+// endSpan records the result of an operation and ends its span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		span.SetStatus(codes.Ok, "")
+	}
+	span.End()
+}
+
+func jobIDAttr(id uint64) attribute.KeyValue {
+	return attribute.Int64("blero.job.id", int64(id))
+}
+
+func jobNameAttr(name string) attribute.KeyValue {
+	return attribute.String("blero.job.name", name)
+}
@@ -0,0 +1,76 @@
+package blero
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestBlero_Tracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	opts := DefaultOptions("")
+	opts.Backend = NewMemoryBackend()
+	opts.TracerProvider = tp
+	bl, err := NewWithOptions(opts)
+	assert.NoError(t, err)
+
+	err = bl.Start()
+	assert.NoError(t, err)
+	defer bl.Stop()
+
+	ch := make(chan trace.SpanContext)
+	bl.RegisterProcessorFunc(func(j *Job) error {
+		ch <- trace.SpanContextFromContext(j.Context())
+		return errors.New("boom")
+	})
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "request")
+	jID, err := bl.EnqueueJobContext(ctx, "MyJob", nil)
+	assert.NoError(t, err)
+	parent.End()
+
+	// the processor continues the trace
+	processSC := <-ch
+	assert.Equal(t, parent.SpanContext().TraceID(), processSC.TraceID())
+
+	// wait for the process span to end
+	assert.Eventually(t, func() bool { return len(exporter.GetSpans()) == 4 }, time.Second, 10*time.Millisecond)
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, s := range exporter.GetSpans() {
+		spans[s.Name] = s
+	}
+
+	enqueue := spans[spanEnqueue]
+	assert.Equal(t, parent.SpanContext().SpanID(), enqueue.Parent.SpanID())
+	assert.Equal(t, trace.SpanKindProducer, enqueue.SpanKind)
+	assert.Contains(t, enqueue.Attributes, jobIDAttr(jID))
+	assert.Equal(t, codes.Ok, enqueue.Status.Code)
+
+	wait := spans[spanQueueWait]
+	assert.Equal(t, enqueue.SpanContext.SpanID(), wait.Parent.SpanID())
+
+	process := spans[spanProcess]
+	assert.Equal(t, processSC.SpanID(), process.SpanContext.SpanID())
+	assert.Equal(t, enqueue.SpanContext.SpanID(), process.Parent.SpanID())
+	assert.Equal(t, trace.SpanKindConsumer, process.SpanKind)
+	assert.Len(t, process.Links, 1)
+	assert.Equal(t, enqueue.SpanContext.SpanID(), process.Links[0].SpanContext.SpanID())
+	assert.Contains(t, process.Attributes, jobNameAttr("MyJob"))
+	assert.Equal(t, codes.Error, process.Status.Code)
+	assert.Equal(t, "boom", process.Status.Description)
+}
+
+func TestJob_ContextDefault(t *testing.T) {
+	j := &Job{}
+	assert.Equal(t, context.Background(), j.Context())
+}
@@ -0,0 +1,115 @@
+package blero
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/dgraph-io/badger/v4/pb"
+)
+
+// ErrTxnNotSupported is returned when enqueuing in a badger transaction with another backend
+var ErrTxnNotSupported = errors.New("Badger transactions are only supported by the badger backends")
+
+// enqueueJobTx enqueues a new Job in a transaction of the caller, its blob is written in the same transaction
+func (q *queue) enqueueJobTx(tx Tx, j *Job) (uint64, error) {
+	j.EnqueuedAt = timeNow()
+	j.StatusChangedAt = j.EnqueuedAt
+
+	if j.Key != "" {
+		// skip storing the blob of a duplicate
+		id, err := getJobIDForKey(tx, j.Key)
+		if err == nil {
+			return id, nil
+		}
+		if err != ErrKeyNotFound {
+			return 0, err
+		}
+	}
+
+	num, err := q.seq.Next()
+	if err != nil {
+		return 0, err
+	}
+	j.ID = num + 1
+
+	_, err = q.writeBlob(j, tx.Set)
+	if err != nil {
+		return 0, err
+	}
+	_, err = q.writeJob(tx, j, JobPending)
+	if err != nil {
+		return 0, err
+	}
+	return j.ID, nil
+}
+
+// EnqueueJobTxn enqueues a new Job in txn, a transaction of the shared BadgerDB, and returns the job id
+// The job is only stored if txn commits, so it can be enqueued atomically with the application writes
+// The dispatcher is notified once txn commits, whether with txn.Commit, Update or CommitTxn
+func (bl *Blero) EnqueueJobTxn(ctx context.Context, txn *badger.Txn, name string, data []byte, opts EnqueueOptions) (uint64, error) {
+	if _, ok := bl.queue.badgerBackend(); !ok {
+		return 0, ErrTxnNotSupported
+	}
+	tx := newNamespacedTx(&badgerTx{txn: txn}, bl.queue.opts.Namespace)
+	return bl.enqueue(ctx, name, data, opts, func(j *Job) (uint64, error) {
+		return bl.queue.enqueueJobTx(tx, j)
+	})
+}
+
+// startCommitWatch calls committed when a transaction writing to the dispatch indexes of a badger db commits,
+// so that the jobs enqueued with EnqueueJobTxn are dispatched however the application commits the transaction
+func (q *queue) startCommitWatch() {
+	b, ok := q.badgerBackend()
+	if !ok || q.committed == nil {
+		return
+	}
+	matches := []pb.Match{
+		{Prefix: []byte(q.opts.Namespace + readyIndexPrefix)},
+		{Prefix: []byte(q.opts.Namespace + scheduledIndexPrefix)},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-q.quitCh // queue was stopped
+		cancel()
+	}()
+	go func() {
+		err := b.db.Subscribe(ctx, func(*badger.KVList) error {
+			q.committed()
+			return nil
+		}, matches)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			q.opts.Logger.Error("Cannot watch the committed jobs", "error", err)
+		}
+	}()
+}
+
+// Update runs fn in a read-write transaction of the badger db and notifies the dispatcher once it's committed,
+// so that the jobs enqueued by fn with EnqueueJobTxn are processed
+func (bl *Blero) Update(fn func(txn *badger.Txn) error) error {
+	b, ok := bl.queue.badgerBackend()
+	if !ok {
+		return ErrTxnNotSupported
+	}
+	err := b.db.Update(fn)
+	if err != nil {
+		return err
+	}
+
+	// signal that jobs might have been enqueued
+	bl.dispatcher.signalLoop()
+	return nil
+}
+
+// CommitTxn commits a transaction in which jobs were enqueued with EnqueueJobTxn and notifies the dispatcher
+func (bl *Blero) CommitTxn(txn *badger.Txn) error {
+	err := txn.Commit()
+	if err != nil {
+		return err
+	}
+
+	// signal that jobs might have been enqueued
+	bl.dispatcher.signalLoop()
+	return nil
+}
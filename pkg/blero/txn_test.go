@@ -0,0 +1,188 @@
+package blero
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// newSharedTestBlero starts a Blero sharing a badger db under the "blero/" namespace
+func newSharedTestBlero(t *testing.T) (*Blero, *badger.DB) {
+	badgerOpts := badger.DefaultOptions(t.TempDir())
+	badgerOpts.Logger = nil
+	db, err := badger.Open(badgerOpts)
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	opts := DefaultOptions("")
+	opts.BadgerDB = db
+	opts.Namespace = "blero/"
+	opts.Logger = slog.New(slog.DiscardHandler)
+	bl, err := NewWithOptions(opts)
+	assert.NoError(t, err)
+	assert.NoError(t, bl.Start())
+	return bl, db
+}
+
+func TestBlero_EnqueueJobTxn(t *testing.T) {
+	bl, db := newSharedTestBlero(t)
+	defer bl.Stop()
+	ctx := t.Context()
+
+	processed := make(chan *Job, 1)
+	bl.RegisterProcessorFunc(func(j *Job) error {
+		processed <- j
+		return nil
+	})
+
+	// the order and its job are written atomically
+	var id uint64
+	err := bl.Update(func(txn *badger.Txn) error {
+		err := txn.Set([]byte("order:1"), []byte("order"))
+		if err != nil {
+			return err
+		}
+		id, err = bl.EnqueueJobTxn(ctx, txn, "SendConfirmation", []byte("order:1"), EnqueueOptions{})
+		return err
+	})
+	assert.NoError(t, err)
+
+	select {
+	case j := <-processed:
+		assert.Equal(t, id, j.ID)
+		assert.Equal(t, []byte("order:1"), j.Data)
+	case <-time.After(time.Second):
+		t.Fatal("job not processed")
+	}
+
+	// a rolled back transaction enqueues nothing
+	err = bl.Update(func(txn *badger.Txn) error {
+		_, err := bl.EnqueueJobTxn(ctx, txn, "SendConfirmation", nil, EnqueueOptions{})
+		assert.NoError(t, err)
+		return errors.New("payment declined")
+	})
+	assert.EqualError(t, err, "payment declined")
+	select {
+	case j := <-processed:
+		t.Fatalf("job %v processed", j.ID)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// the Blero keys are in the namespace
+	err = db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			k := string(it.Item().Key())
+			assert.True(t, k == "order:1" || strings.HasPrefix(k, "blero/"), k)
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestBlero_CommitTxn(t *testing.T) {
+	bl, db := newSharedTestBlero(t)
+	ctx := t.Context()
+
+	opts := EnqueueOptions{Key: "order-1", Compression: CompressionNone}
+	txn := db.NewTransaction(true)
+	id, err := bl.EnqueueJobTxn(ctx, txn, "SendConfirmation", nil, opts)
+	assert.NoError(t, err)
+	// the job is enqueued with the same key in the transaction
+	again, err := bl.EnqueueJobTxn(ctx, txn, "SendConfirmation", nil, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, id, again)
+
+	// not visible until committed
+	_, _, err = bl.GetJob(id)
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.NoError(t, bl.CommitTxn(txn))
+	j, status, err := bl.GetJobByKey("order-1")
+	assert.NoError(t, err)
+	assert.Equal(t, JobPending, status)
+	assert.Equal(t, id, j.ID)
+
+	// the shared db isn't closed by Blero
+	assert.NoError(t, bl.Stop())
+	assert.False(t, db.IsClosed())
+	_, err = bl.Backup(&bytes.Buffer{}, 0)
+	assert.Equal(t, ErrBackupNotSupported, err)
+}
+
+func TestBlero_EnqueueJobTxnCommit(t *testing.T) {
+	bl, db := newSharedTestBlero(t)
+	defer bl.Stop()
+
+	processed := make(chan *Job, 1)
+	bl.RegisterProcessorFunc(func(j *Job) error {
+		processed <- j
+		return nil
+	})
+
+	// the dispatcher is notified of a plain commit of the application
+	txn := db.NewTransaction(true)
+	defer txn.Discard()
+	id, err := bl.EnqueueJobTxn(t.Context(), txn, "SendConfirmation", nil, EnqueueOptions{})
+	assert.NoError(t, err)
+	// let the dispatcher handle the signal of the processor registration first
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(t, txn.Commit())
+
+	select {
+	case j := <-processed:
+		assert.Equal(t, id, j.ID)
+	case <-time.After(time.Second):
+		t.Fatal("job not processed")
+	}
+}
+
+func TestBlero_EnqueueJobTxnNotSupported(t *testing.T) {
+	bl := NewWithBackend(NewMemoryBackend())
+	assert.NoError(t, bl.Start())
+	defer bl.Stop()
+
+	_, err := bl.EnqueueJobTxn(t.Context(), nil, "TestJob", nil, EnqueueOptions{})
+	assert.Equal(t, ErrTxnNotSupported, err)
+	assert.Equal(t, ErrTxnNotSupported, bl.Update(func(txn *badger.Txn) error { return nil }))
+}
+
+func TestBlero_Namespace(t *testing.T) {
+	backend := NewMemoryBackend()
+	opts := DefaultOptions("")
+	opts.Backend = backend
+	opts.Namespace = "a/"
+	a, err := NewWithOptions(opts)
+	assert.NoError(t, err)
+	assert.NoError(t, a.Start())
+	defer a.Stop()
+	opts.Namespace = "b/"
+	b, err := NewWithOptions(opts)
+	assert.NoError(t, err)
+	assert.NoError(t, b.Start())
+	defer b.Stop()
+
+	// two Bleros share a backend without seeing each other's jobs
+	_, err = a.EnqueueJobOptions(t.Context(), "TestJob", nil, EnqueueOptions{Tags: []string{"a"}})
+	assert.NoError(t, err)
+	jobs, err := a.ListJobs(ListOptions{Tags: []string{"a"}})
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+	counts, err := b.CountJobs()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, counts[JobPending])
+}
+
+func TestOptions_ValidateBadgerDB(t *testing.T) {
+	opts := DefaultOptions(testDBPath)
+	opts.BadgerDB = &badger.DB{}
+	opts.EncryptionKey = bytes.Repeat([]byte("k"), 16)
+	assert.EqualError(t, opts.validate(), "BadgerDB cannot be set along with DBPath or Backend\n"+
+		"EncryptionKey is only supported by the default badger backend")
+}
@@ -0,0 +1,405 @@
+// Package client is a Go client for the Blero server
+// It offers the same enqueue API as blero.Blero and a Worker running Processors in a separate process
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/didil/goblero/pkg/blero"
+	"github.com/didil/goblero/pkg/server"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Error is returned when the server responds with an error status
+// It unwraps to blero.ErrKeyNotFound, blero.ErrLeaseLost or blero.ErrJobStatus when applicable
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the Blero error matching the response
+func (e *Error) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusNotFound:
+		return blero.ErrKeyNotFound
+	case e.StatusCode == http.StatusConflict && e.Message == blero.ErrLeaseLost.Error():
+		return blero.ErrLeaseLost
+	case e.StatusCode == http.StatusConflict:
+		return blero.ErrJobStatus
+	}
+	return nil
+}
+
+// Client struct
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	token      string
+}
+
+// New creates a client for the server at addr, a URL such as "http://localhost:7070" or a Unix socket such as "unix:/run/blero.sock"
+func New(addr string) *Client {
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		if !strings.Contains(addr, "://") {
+			addr = "http://" + addr
+		}
+		return NewWithHTTPClient(addr, &http.Client{})
+	}
+
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}
+	return NewWithHTTPClient("http://blero", &http.Client{Transport: transport})
+}
+
+// NewWithHTTPClient creates a client for the server at baseURL sending requests with httpClient
+func NewWithHTTPClient(baseURL string, httpClient *http.Client) *Client {
+	return &Client{baseURL: strings.TrimSuffix(baseURL, "/"), httpClient: httpClient}
+}
+
+// WithToken returns a copy of the client sending token as a bearer token, for servers using server.RequireToken
+func (c *Client) WithToken(token string) *Client {
+	cc := *c
+	cc.token = token
+	return &cc
+}
+
+// EnqueueJob enqueues a new Job and returns the job id
+func (c *Client) EnqueueJob(name string, data []byte) (uint64, error) {
+	return c.EnqueueJobContext(context.Background(), name, data)
+}
+
+// EnqueueJobContext enqueues a new Job and returns the job id
+// The span context of ctx is sent to the server so the processing span continues the trace
+func (c *Client) EnqueueJobContext(ctx context.Context, name string, data []byte) (uint64, error) {
+	return c.EnqueueJobOptions(ctx, name, data, blero.EnqueueOptions{})
+}
+
+// EnqueueJobOptions enqueues a new Job with per job options and returns the job id
+func (c *Client) EnqueueJobOptions(ctx context.Context, name string, data []byte, opts blero.EnqueueOptions) (uint64, error) {
+	req := server.EnqueueRequest{Name: name, Data: data, Headers: opts.Headers, Tags: opts.Tags, Key: opts.Key}
+	if opts.Compression != blero.CompressionDefault {
+		req.Compression = opts.Compression.String()
+	}
+
+	var resp server.EnqueueResponse
+	err := c.do(ctx, "POST", "/v1/jobs", req, &resp)
+	if err != nil {
+		return 0, err
+	}
+	return resp.ID, nil
+}
+
+// GetJob fetches a job by ID and returns its status
+func (c *Client) GetJob(ctx context.Context, id uint64) (*blero.Job, blero.JobStatus, error) {
+	return c.getJob(ctx, strconv.FormatUint(id, 10))
+}
+
+// GetJobByKey fetches a job by the key it was enqueued with and returns its status
+func (c *Client) GetJobByKey(ctx context.Context, key string) (*blero.Job, blero.JobStatus, error) {
+	return c.getJob(ctx, url.PathEscape(key))
+}
+
+func (c *Client) getJob(ctx context.Context, id string) (*blero.Job, blero.JobStatus, error) {
+	var resp server.JobResponse
+	err := c.do(ctx, "GET", "/v1/jobs/"+id, nil, &resp)
+	if err != nil {
+		return nil, 0, err
+	}
+	status, err := blero.ParseJobStatus(resp.Status)
+	if err != nil {
+		return nil, 0, err
+	}
+	return resp.Job, status, nil
+}
+
+// JobHistory returns the status changes of a job in order
+func (c *Client) JobHistory(ctx context.Context, id uint64) ([]blero.Transition, error) {
+	var resp server.HistoryResponse
+	err := c.do(ctx, "GET", "/v1/jobs/"+strconv.FormatUint(id, 10)+"/history", nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.History, nil
+}
+
+// ListJobs lists the jobs in a status in ID order, the server returns at most 100 jobs when opts.Limit is 0
+// Header names used as filters cannot contain ':'
+func (c *Client) ListJobs(ctx context.Context, opts blero.ListOptions) ([]*blero.Job, error) {
+	query := url.Values{}
+	query.Set("status", opts.Status.String())
+	query.Set("after", strconv.FormatUint(opts.After, 10))
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	for _, tag := range opts.Tags {
+		query.Add("tag", tag)
+	}
+	for name, value := range opts.Headers {
+		query.Add("header", name+":"+value)
+	}
+	if opts.Name != "" {
+		query.Set("name", opts.Name)
+	}
+	for param, t := range map[string]time.Time{
+		"enqueued_since":  opts.EnqueuedSince,
+		"enqueued_before": opts.EnqueuedBefore,
+		"changed_since":   opts.ChangedSince,
+		"changed_before":  opts.ChangedBefore,
+	} {
+		if !t.IsZero() {
+			query.Set(param, t.Format(time.RFC3339Nano))
+		}
+	}
+
+	var resp server.JobsResponse
+	err := c.do(ctx, "GET", "/v1/jobs?"+query.Encode(), nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Jobs, nil
+}
+
+// CountJobs returns the number of jobs per status
+func (c *Client) CountJobs(ctx context.Context) (map[blero.JobStatus]int, error) {
+	var resp map[string]int
+	err := c.do(ctx, "GET", "/v1/stats", nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[blero.JobStatus]int, len(resp))
+	for name, n := range resp {
+		status, err := blero.ParseJobStatus(name)
+		if err != nil {
+			return nil, err
+		}
+		counts[status] = n
+	}
+	return counts, nil
+}
+
+// DeleteJob deletes a job, jobs in progress cannot be deleted
+func (c *Client) DeleteJob(ctx context.Context, id uint64) error {
+	return c.do(ctx, "DELETE", "/v1/jobs/"+strconv.FormatUint(id, 10), nil, nil)
+}
+
+// RequeueJob moves a complete or failed job back to pending so it runs again
+func (c *Client) RequeueJob(ctx context.Context, id uint64) error {
+	return c.do(ctx, "POST", "/v1/jobs/"+strconv.FormatUint(id, 10)+"/requeue", nil, nil)
+}
+
+// LeaseJobs leases up to max pending jobs for the worker identified by owner
+func (c *Client) LeaseJobs(ctx context.Context, owner string, max int) ([]*blero.Job, error) {
+	var resp server.JobsResponse
+	err := c.do(ctx, "POST", "/v1/leases", server.LeaseRequest{Owner: owner, Max: max}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Jobs, nil
+}
+
+// ExtendLease extends the lease of a job attempt and returns the new expiry
+func (c *Client) ExtendLease(ctx context.Context, id uint64, attempt int) (time.Time, error) {
+	var resp server.HeartbeatResponse
+	err := c.do(ctx, "POST", "/v1/jobs/"+strconv.FormatUint(id, 10)+"/heartbeat", server.AttemptRequest{Attempt: attempt}, &resp)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return resp.LeaseExpiresAt, nil
+}
+
+// AckJob marks a leased job attempt complete
+func (c *Client) AckJob(ctx context.Context, id uint64, attempt int) error {
+	return c.do(ctx, "POST", "/v1/jobs/"+strconv.FormatUint(id, 10)+"/ack", server.AttemptRequest{Attempt: attempt}, nil)
+}
+
+// NackJob marks a leased job attempt failed, reason is logged by the server and recorded in the job history
+// The job is retried according to the server retry policy, reason can override it with blero.Permanent, blero.RetryAfter and blero.Snooze
+// The stack trace of a *blero.PanicError is sent along and kept on the job
+func (c *Client) NackJob(ctx context.Context, id uint64, attempt int, reason error) error {
+	req := server.AttemptRequest{Attempt: attempt}
+	if reason != nil {
+		req.Error = reason.Error()
+	}
+	var panicErr *blero.PanicError
+	if errors.As(reason, &panicErr) {
+		req.Panic = fmt.Sprint(panicErr.Value)
+		req.Stack = string(panicErr.Stack)
+	}
+	var snoozeErr *blero.SnoozeError
+	var permanentErr *blero.PermanentError
+	var retryErr *blero.RetryAfterError
+	switch {
+	case errors.As(reason, &snoozeErr):
+		req.Retry = server.RetrySnooze
+		req.DelayMs = snoozeErr.Delay.Milliseconds()
+	case errors.As(reason, &permanentErr):
+		req.Retry = server.RetryPermanent
+	case errors.As(reason, &retryErr):
+		req.Retry = server.RetryAfterDelay
+		req.DelayMs = retryErr.Delay.Milliseconds()
+	}
+	return c.do(ctx, "POST", "/v1/jobs/"+strconv.FormatUint(id, 10)+"/nack", req, nil)
+}
+
+// Pause stops starting jobs until Resume is called
+func (c *Client) Pause(ctx context.Context) error {
+	return c.do(ctx, "POST", "/v1/pause", nil, nil)
+}
+
+// Resume starts jobs again after Pause
+func (c *Client) Resume(ctx context.Context) error {
+	return c.do(ctx, "POST", "/v1/resume", nil, nil)
+}
+
+// PauseJob stops starting the jobs with a given name until ResumeJob is called
+func (c *Client) PauseJob(ctx context.Context, name string) error {
+	return c.do(ctx, "POST", "/v1/pause/"+url.PathEscape(name), nil, nil)
+}
+
+// ResumeJob starts the jobs with a given name again after PauseJob
+func (c *Client) ResumeJob(ctx context.Context, name string) error {
+	return c.do(ctx, "POST", "/v1/resume/"+url.PathEscape(name), nil, nil)
+}
+
+// Paused returns whether all jobs are paused and the paused job names
+func (c *Client) Paused(ctx context.Context) (bool, []string, error) {
+	var resp server.PauseResponse
+	err := c.do(ctx, "GET", "/v1/pause", nil, &resp)
+	if err != nil {
+		return false, nil, err
+	}
+	return resp.Paused, resp.JobNames, nil
+}
+
+// Backup streams a backup of the server db to w and returns the backup version
+// Only the changes since a previous backup version are written when since isn't 0, see blero.RestoreBackup
+func (c *Client) Backup(ctx context.Context, w io.Writer, since uint64) (uint64, error) {
+	resp, err := c.send(ctx, "GET", "/v1/backup?since="+strconv.FormatUint(since, 10), nil, "")
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(w, resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	version, err := strconv.ParseUint(resp.Trailer.Get(server.BackupVersionTrailer), 10, 64)
+	if err != nil {
+		return 0, errors.New("Truncated backup, the server failed while writing it")
+	}
+	return version, nil
+}
+
+// ExportJobs writes the jobs of the server in all statuses to w as JSON lines and returns the number of exported jobs
+func (c *Client) ExportJobs(ctx context.Context, w io.Writer) (int, error) {
+	resp, err := c.send(ctx, "GET", "/v1/export", nil, "")
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(w, resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(resp.Trailer.Get(server.ExportedJobsTrailer))
+	if err != nil {
+		return 0, errors.New("Truncated export, the server failed while writing it")
+	}
+	return n, nil
+}
+
+// ImportJobs imports jobs written by ExportJobs or blero.Blero.ExportJobs and returns the number of imported jobs
+func (c *Client) ImportJobs(ctx context.Context, r io.Reader) (int, error) {
+	resp, err := c.send(ctx, "POST", "/v1/import", r, "application/x-ndjson")
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var out server.ImportResponse
+	err = json.NewDecoder(resp.Body).Decode(&out)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid response body: %w", err)
+	}
+	return out.Imported, nil
+}
+
+// do sends a JSON request and decodes the JSON response in out
+func (c *Client) do(ctx context.Context, method, path string, body any, out any) error {
+	var r bytes.Buffer
+	if body != nil {
+		err := json.NewEncoder(&r).Encode(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	resp, err := c.send(ctx, method, path, &r, "application/json")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		return nil
+	}
+	err = json.NewDecoder(resp.Body).Decode(out)
+	if err != nil {
+		return fmt.Errorf("Invalid response body: %w", err)
+	}
+	return nil
+}
+
+// send sends a request and returns the response, error statuses are returned as *Error
+func (c *Client) send(ctx context.Context, method, path string, body io.Reader, contentType string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	// W3C trace context, as stored in the job metadata by the server
+	propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		var errResp server.ErrorResponse
+		err := json.NewDecoder(resp.Body).Decode(&errResp)
+		if err != nil {
+			return nil, fmt.Errorf("Unexpected response status %v", resp.StatusCode)
+		}
+		return nil, &Error{StatusCode: resp.StatusCode, Message: errResp.Error}
+	}
+	return resp, nil
+}
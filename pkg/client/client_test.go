@@ -0,0 +1,307 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/didil/goblero/pkg/blero"
+	"github.com/didil/goblero/pkg/server"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestServer starts a server backed by an in-memory Blero and returns a client for it
+func newTestServer(t *testing.T, opts blero.Options) (*blero.Blero, *Client) {
+	opts.Backend = blero.NewMemoryBackend()
+	opts.Logger = slog.New(slog.DiscardHandler)
+	bl, err := blero.NewWithOptions(opts)
+	assert.NoError(t, err)
+	assert.NoError(t, bl.Start())
+
+	srv := httptest.NewServer(server.NewHandler(bl, opts.Logger))
+	t.Cleanup(func() {
+		srv.Close()
+		bl.Stop()
+	})
+	return bl, NewWithHTTPClient(srv.URL+"/", srv.Client())
+}
+
+func TestClient_EnqueueJob(t *testing.T) {
+	bl, c := newTestServer(t, blero.DefaultOptions(""))
+	ctx := context.Background()
+
+	jID, err := c.EnqueueJob("TestJob", []byte("data"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), jID)
+
+	j, status, err := c.GetJob(ctx, jID)
+	assert.NoError(t, err)
+	assert.Equal(t, blero.JobPending, status)
+	assert.Equal(t, "TestJob", j.Name)
+	assert.Equal(t, []byte("data"), j.Data)
+
+	// the job is stored by the server
+	j, _, err = bl.GetJob(jID)
+	assert.NoError(t, err)
+	assert.Equal(t, "TestJob", j.Name)
+
+	// enqueue with a key twice
+	opts := blero.EnqueueOptions{Key: "order/42"}
+	keyID, err := c.EnqueueJobOptions(ctx, "TestJob", nil, opts)
+	assert.NoError(t, err)
+	again, err := c.EnqueueJobOptions(ctx, "TestJob", nil, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, keyID, again)
+	j, _, err = c.GetJobByKey(ctx, "order/42")
+	assert.NoError(t, err)
+	assert.Equal(t, keyID, j.ID)
+	_, _, err = c.GetJobByKey(ctx, "unknown")
+	assert.True(t, errors.Is(err, blero.ErrKeyNotFound))
+
+	_, _, err = c.GetJob(ctx, 42)
+	assert.True(t, errors.Is(err, blero.ErrKeyNotFound))
+	assert.EqualError(t, err, "Job not found")
+
+	_, err = c.EnqueueJob("", nil)
+	var cErr *Error
+	assert.True(t, errors.As(err, &cErr))
+	assert.Equal(t, http.StatusBadRequest, cErr.StatusCode)
+	assert.Equal(t, "Job name is required", cErr.Message)
+	assert.Nil(t, cErr.Unwrap())
+}
+
+func TestClient_Inspection(t *testing.T) {
+	_, c := newTestServer(t, blero.DefaultOptions(""))
+	ctx := context.Background()
+
+	for i := 0; i < 4; i++ {
+		_, err := c.EnqueueJob("TestJob", nil)
+		assert.NoError(t, err)
+	}
+
+	jobs, err := c.ListJobs(ctx, blero.ListOptions{Status: blero.JobPending, After: 1, Limit: 2})
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 2)
+	assert.Equal(t, uint64(2), jobs[0].ID)
+
+	leased, err := c.LeaseJobs(ctx, "worker-1", 2)
+	assert.NoError(t, err)
+	assert.Len(t, leased, 2)
+	assert.NoError(t, c.NackJob(ctx, leased[0].ID, leased[0].Attempts, errors.New("boom")))
+	_, err = c.ExtendLease(ctx, leased[1].ID, leased[1].Attempts)
+	assert.NoError(t, err)
+
+	counts, err := c.CountJobs(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, map[blero.JobStatus]int{blero.JobPending: 2, blero.JobInProgress: 1, blero.JobComplete: 0, blero.JobFailed: 1}, counts)
+
+	err = c.DeleteJob(ctx, leased[1].ID)
+	assert.True(t, errors.Is(err, blero.ErrJobStatus))
+
+	assert.NoError(t, c.AckJob(ctx, leased[1].ID, leased[1].Attempts))
+	err = c.AckJob(ctx, leased[1].ID, leased[1].Attempts)
+	assert.True(t, errors.Is(err, blero.ErrLeaseLost))
+	_, err = c.ExtendLease(ctx, leased[1].ID, leased[1].Attempts)
+	assert.True(t, errors.Is(err, blero.ErrLeaseLost))
+
+	history, err := c.JobHistory(ctx, leased[0].ID)
+	assert.NoError(t, err)
+	if assert.Len(t, history, 3) {
+		assert.Equal(t, "boom", history[2].Error)
+	}
+
+	assert.NoError(t, c.RequeueJob(ctx, leased[0].ID))
+	assert.NoError(t, c.DeleteJob(ctx, leased[1].ID))
+	_, status, err := c.GetJob(ctx, leased[0].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, blero.JobPending, status)
+}
+
+func TestClient_NackRetry(t *testing.T) {
+	opts := blero.DefaultOptions("")
+	opts.RetryPolicy = blero.RetryPolicy{MaxAttempts: 3, Backoff: time.Hour}
+	bl, c := newTestServer(t, opts)
+	ctx := context.Background()
+
+	errs := []error{
+		errors.New("boom"),
+		blero.Permanent(errors.New("invalid card")),
+		blero.RetryAfter(errors.New("rate limited"), time.Minute),
+		blero.Snooze(time.Minute),
+	}
+	for range errs {
+		_, err := c.EnqueueJob("TestJob", nil)
+		assert.NoError(t, err)
+	}
+	leased, err := c.LeaseJobs(ctx, "worker-1", len(errs))
+	assert.NoError(t, err)
+	if !assert.Len(t, leased, len(errs)) {
+		return
+	}
+	for i, err := range errs {
+		assert.NoError(t, c.NackJob(ctx, leased[i].ID, leased[i].Attempts, err))
+	}
+
+	// the server retry policy applies to nacks, and the error wrappers override it
+	j, status, err := bl.GetJob(leased[0].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, blero.JobPending, status)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), j.RunAt, time.Minute)
+
+	_, status, err = bl.GetJob(leased[1].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, blero.JobFailed, status)
+
+	j, status, err = bl.GetJob(leased[2].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, blero.JobPending, status)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), j.RunAt, 10*time.Second)
+
+	// snoozed attempts are not counted
+	j, status, err = bl.GetJob(leased[3].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, blero.JobPending, status)
+	assert.Equal(t, 0, j.Attempts)
+	history, err := bl.JobHistory(leased[3].ID)
+	assert.NoError(t, err)
+	if assert.Len(t, history, 3) {
+		assert.Equal(t, "Snoozed for 1m0s", history[2].Error)
+	}
+}
+
+func TestClient_UnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blero.sock")
+	l, err := server.Listen("unix:" + path)
+	assert.NoError(t, err)
+
+	bl := blero.NewWithBackend(blero.NewMemoryBackend())
+	assert.NoError(t, bl.Start())
+	defer bl.Stop()
+	srv := &http.Server{Handler: server.NewHandler(bl, slog.New(slog.DiscardHandler))}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	c := New("unix:" + path)
+	jID, err := c.EnqueueJob("TestJob", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), jID)
+}
+
+func TestClient_Token(t *testing.T) {
+	bl := blero.NewWithBackend(blero.NewMemoryBackend())
+	assert.NoError(t, bl.Start())
+	defer bl.Stop()
+	srv := httptest.NewServer(server.RequireToken("secret", server.NewHandler(bl, slog.New(slog.DiscardHandler))))
+	defer srv.Close()
+
+	c := NewWithHTTPClient(srv.URL, srv.Client())
+	_, err := c.EnqueueJob("TestJob", nil)
+	var respErr *Error
+	assert.ErrorAs(t, err, &respErr)
+	assert.Equal(t, http.StatusUnauthorized, respErr.StatusCode)
+
+	jID, err := c.WithToken("secret").EnqueueJob("TestJob", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), jID)
+}
+
+func TestClient_Unreachable(t *testing.T) {
+	c := New("unix:" + filepath.Join(t.TempDir(), "missing.sock"))
+	_, err := c.EnqueueJob("TestJob", nil)
+	assert.Error(t, err)
+
+	c = New("127.0.0.1:1")
+	assert.Equal(t, "http://127.0.0.1:1", c.baseURL)
+}
+
+func TestClient_PauseResume(t *testing.T) {
+	bl, c := newTestServer(t, blero.DefaultOptions(""))
+	ctx := context.Background()
+
+	assert.NoError(t, c.Pause(ctx))
+	assert.NoError(t, c.PauseJob(ctx, "Send Email"))
+	paused, names, err := c.Paused(ctx)
+	assert.NoError(t, err)
+	assert.True(t, paused)
+	assert.Equal(t, []string{"Send Email"}, names)
+
+	assert.NoError(t, c.Resume(ctx))
+	assert.NoError(t, c.ResumeJob(ctx, "Send Email"))
+	paused, names = bl.Paused()
+	assert.False(t, paused)
+	assert.Len(t, names, 0)
+}
+
+func TestClient_ExportImportBackup(t *testing.T) {
+	_, srcClient := newTestServer(t, blero.DefaultOptions(""))
+	dst, dstClient := newTestServer(t, blero.DefaultOptions(""))
+	ctx := context.Background()
+
+	_, err := srcClient.EnqueueJob("TestJob", []byte("data"))
+	assert.NoError(t, err)
+
+	var export bytes.Buffer
+	n, err := srcClient.ExportJobs(ctx, &export)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	n, err = dstClient.ImportJobs(ctx, &export)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	j, _, err := dst.GetJob(1)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("data"), j.Data)
+
+	_, err = dstClient.ImportJobs(ctx, bytes.NewBufferString("{"))
+	assert.EqualError(t, err, "Job 1: unexpected EOF, 0 jobs imported")
+
+	// the in-memory backend can't be backed up
+	_, err = srcClient.Backup(ctx, &bytes.Buffer{}, 0)
+	var cErr *Error
+	assert.True(t, errors.As(err, &cErr))
+	assert.Equal(t, http.StatusNotImplemented, cErr.StatusCode)
+}
+
+func TestClient_HeadersTags(t *testing.T) {
+	bl, c := newTestServer(t, blero.DefaultOptions(""))
+	ctx := context.Background()
+
+	opts := blero.EnqueueOptions{Headers: map[string]string{"tenant": "acme"}, Tags: []string{"billing"}, Compression: blero.CompressionSnappy}
+	id, err := c.EnqueueJobOptions(ctx, "TestJob", []byte("data"), opts)
+	assert.NoError(t, err)
+	_, err = c.EnqueueJob("TestJob", nil)
+	assert.NoError(t, err)
+
+	j, _, err := bl.GetJob(id)
+	assert.NoError(t, err)
+	assert.Equal(t, opts.Headers, j.Headers)
+	assert.Equal(t, opts.Tags, j.Tags)
+
+	jobs, err := c.ListJobs(ctx, blero.ListOptions{Tags: []string{"billing"}, Headers: map[string]string{"tenant": "acme"}})
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, id, jobs[0].ID)
+	assert.Equal(t, []byte("data"), jobs[0].Data)
+
+	// by name and enqueue time
+	_, err = c.EnqueueJob("OtherJob", nil)
+	assert.NoError(t, err)
+	jobs, err = c.ListJobs(ctx, blero.ListOptions{Name: "TestJob", EnqueuedSince: j.EnqueuedAt, EnqueuedBefore: time.Now().Add(time.Minute)})
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 2)
+	jobs, err = c.ListJobs(ctx, blero.ListOptions{ChangedBefore: j.StatusChangedAt})
+	assert.NoError(t, err)
+	assert.Empty(t, jobs)
+
+	_, err = c.EnqueueJobOptions(ctx, "TestJob", nil, blero.EnqueueOptions{Tags: []string{""}})
+	var cErr *Error
+	assert.True(t, errors.As(err, &cErr))
+	assert.Equal(t, http.StatusBadRequest, cErr.StatusCode)
+	assert.Equal(t, "Invalid enqueue options: Tag cannot be empty", cErr.Message)
+}
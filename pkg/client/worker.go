@@ -0,0 +1,199 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/didil/goblero/pkg/blero"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WorkerOptions configures a Worker
+type WorkerOptions struct {
+	// Owner identifies the worker in the job leases, defaults to hostname-pid
+	Owner string
+	// Concurrency is the max number of jobs run at once
+	Concurrency int
+	// PollInterval is how long the worker waits before leasing again when no jobs are pending
+	PollInterval time.Duration
+	// HeartbeatInterval is how often the leases of running jobs are extended, it must be lower than the server lease timeout
+	HeartbeatInterval time.Duration
+	// Logger receives the worker logs, defaults to slog.Default
+	Logger *slog.Logger
+	// TracerProvider creates the queue wait and processing spans, defaults to the global provider
+	TracerProvider trace.TracerProvider
+	// Propagator reads the span contexts stored in the job metadata by the server, defaults to W3C trace context
+	Propagator propagation.TextMapPropagator
+}
+
+// DefaultWorkerOptions returns the default worker options
+func DefaultWorkerOptions() WorkerOptions {
+	return WorkerOptions{
+		Concurrency:       1,
+		PollInterval:      time.Second,
+		HeartbeatInterval: 10 * time.Second,
+	}
+}
+
+// validate checks the worker options and reports all invalid values
+func (opts WorkerOptions) validate() error {
+	var errs []error
+	if opts.Concurrency < 1 {
+		errs = append(errs, fmt.Errorf("Concurrency must be at least 1, got %v", opts.Concurrency))
+	}
+	if opts.PollInterval <= 0 {
+		errs = append(errs, fmt.Errorf("PollInterval must be greater than 0, got %v", opts.PollInterval))
+	}
+	if opts.HeartbeatInterval <= 0 {
+		errs = append(errs, fmt.Errorf("HeartbeatInterval must be greater than 0, got %v", opts.HeartbeatInterval))
+	}
+	return errors.Join(errs...)
+}
+
+// Worker leases jobs from a Blero server and runs them with a local Processor
+type Worker struct {
+	c      *Client
+	p      blero.Processor
+	opts   WorkerOptions
+	logger *slog.Logger
+}
+
+// NewWorker creates a worker running the jobs leased from the server with p
+func (c *Client) NewWorker(p blero.Processor, opts WorkerOptions) (*Worker, error) {
+	err := opts.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Owner == "" {
+		hostname, _ := os.Hostname()
+		opts.Owner = fmt.Sprintf("%v-%v", hostname, os.Getpid())
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &Worker{c: c, p: p, opts: opts, logger: logger.With("owner", opts.Owner)}, nil
+}
+
+// Run leases and runs jobs until ctx is done, then waits for the running jobs and returns
+// Lease errors are logged and retried after PollInterval
+func (w *Worker) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	// slots holds a token per free slot, doneCh wakes the loop when a job is done
+	slots := make(chan struct{}, w.opts.Concurrency)
+	for i := 0; i < w.opts.Concurrency; i++ {
+		slots <- struct{}{}
+	}
+	doneCh := make(chan struct{}, 1)
+
+	for ctx.Err() == nil {
+		free := len(slots)
+		leased := 0
+		if free > 0 {
+			// leases are not cancelled with ctx so that leased jobs are never lost in a cancelled response
+			jobs, err := w.c.LeaseJobs(context.Background(), w.opts.Owner, free)
+			if err != nil {
+				w.logger.Error("Cannot lease jobs", "error", err)
+			}
+			for _, j := range jobs {
+				<-slots
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					w.runJob(j)
+					slots <- struct{}{}
+					select {
+					case doneCh <- struct{}{}:
+					default: // the loop is already woken up
+					}
+				}()
+			}
+			leased = len(jobs)
+		}
+
+		// lease again right away while jobs are pending and slots are free
+		if free > 0 && leased == free {
+			continue
+		}
+
+		timer := time.NewTimer(w.opts.PollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-doneCh:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+
+	return nil
+}
+
+// runJob runs a leased job, extends its lease while it runs and acks or nacks the attempt
+// The processing span continues the trace of the enqueue, jobs are finished even when the worker is stopping
+func (w *Worker) runJob(j *blero.Job) {
+	logger := w.logger.With("job_id", j.ID, "job_name", j.Name, "attempt", j.Attempts)
+	endSpan := blero.StartProcessSpan(w.opts.TracerProvider, w.opts.Propagator, j)
+	ctx := j.Context()
+
+	stopCh := make(chan struct{})
+	heartbeatDone := make(chan struct{})
+	go func() {
+		defer close(heartbeatDone)
+		ticker := time.NewTicker(w.opts.HeartbeatInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				_, err := w.c.ExtendLease(ctx, j.ID, j.Attempts)
+				if errors.Is(err, blero.ErrLeaseLost) {
+					logger.Warn("Job lease lost")
+					return
+				}
+				if err != nil {
+					logger.Error("Cannot extend job lease", "error", err)
+				}
+			case <-stopCh: // job is done
+				return
+			}
+		}
+	}()
+
+	logger.Debug("Job started")
+	err := blero.RunProcessor(w.p, j)
+	close(stopCh)
+	<-heartbeatDone
+	endSpan(err)
+
+	if err != nil {
+		var panicErr *blero.PanicError
+		if errors.As(err, &panicErr) {
+			logger.Error("Job panicked", "error", err, "stack", string(panicErr.Stack))
+		} else {
+			logger.Warn("Job failed", "error", err)
+		}
+		err := w.c.NackJob(ctx, j.ID, j.Attempts, err)
+		if err != nil {
+			logger.Error("Cannot mark job failed", "error", err)
+		}
+		return
+	}
+
+	logger.Debug("Job complete")
+	err = w.c.AckJob(ctx, j.ID, j.Attempts)
+	if err != nil {
+		logger.Error("Cannot mark job complete", "error", err)
+	}
+}
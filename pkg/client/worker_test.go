@@ -0,0 +1,190 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/didil/goblero/pkg/blero"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestWorker_Run(t *testing.T) {
+	opts := blero.DefaultOptions("")
+	opts.LeaseTimeout = 100 * time.Millisecond
+	opts.HeartbeatInterval = 30 * time.Millisecond
+	opts.ReapInterval = 20 * time.Millisecond
+	bl, c := newTestServer(t, opts)
+
+	ids := make(map[string]uint64)
+	for _, name := range []string{"SlowJob", "FailingJob", "PanickingJob", "TestJob", "TestJob", "TestJob"} {
+		id, err := c.EnqueueJob(name, nil)
+		assert.NoError(t, err)
+		ids[name] = id
+	}
+
+	var l sync.Mutex
+	attempts := make(map[uint64]int)
+	p := blero.ProcessorFunc(func(j *blero.Job) error {
+		l.Lock()
+		attempts[j.ID]++
+		l.Unlock()
+
+		switch j.Name {
+		case "SlowJob":
+			// the worker heartbeats keep the lease past the lease timeout
+			time.Sleep(300 * time.Millisecond)
+		case "FailingJob":
+			return errors.New("boom")
+		case "PanickingJob":
+			// the panic fails the job without crashing the worker
+			panic("boom")
+		}
+		return nil
+	})
+
+	wOpts := DefaultWorkerOptions()
+	wOpts.Owner = "worker-1"
+	wOpts.Concurrency = 2
+	wOpts.PollInterval = 10 * time.Millisecond
+	wOpts.HeartbeatInterval = 20 * time.Millisecond
+	w, err := c.NewWorker(p, wOpts)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Run(ctx) }()
+
+	assert.Eventually(t, func() bool {
+		counts, err := bl.CountJobs()
+		return err == nil && counts[blero.JobComplete] == 4 && counts[blero.JobFailed] == 2
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// a job enqueued later is picked up
+	jID, err := c.EnqueueJob("TestJob", nil)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		_, status, err := bl.GetJob(jID)
+		return err == nil && status == blero.JobComplete
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	assert.NoError(t, <-done)
+
+	// the stack trace of the remote panic is kept on the job
+	j, _, err := bl.GetJob(ids["PanickingJob"])
+	assert.NoError(t, err)
+	assert.Contains(t, j.PanicStack(), "worker_test.go")
+	history, err := bl.JobHistory(ids["PanickingJob"])
+	assert.NoError(t, err)
+	if assert.Len(t, history, 3) {
+		assert.Equal(t, "Processor panicked: boom", history[2].Error)
+	}
+
+	// each job ran once
+	l.Lock()
+	defer l.Unlock()
+	assert.Len(t, attempts, 7)
+	for id, n := range attempts {
+		assert.Equal(t, 1, n, id)
+	}
+}
+
+func TestWorker_Tracing(t *testing.T) {
+	_, c := newTestServer(t, blero.DefaultOptions(""))
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	// the client sends the span context of the enqueue request to the server
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "request")
+	jID, err := c.EnqueueJobContext(ctx, "TestJob", nil)
+	assert.NoError(t, err)
+	parent.End()
+
+	ch := make(chan trace.SpanContext, 1)
+	wOpts := DefaultWorkerOptions()
+	wOpts.Owner = "worker-1"
+	wOpts.PollInterval = 10 * time.Millisecond
+	wOpts.TracerProvider = tp
+	w, err := c.NewWorker(blero.ProcessorFunc(func(j *blero.Job) error {
+		ch <- trace.SpanContextFromContext(j.Context())
+		return errors.New("boom")
+	}), wOpts)
+	assert.NoError(t, err)
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Run(runCtx) }()
+
+	// the remote processor continues the trace
+	processSC := <-ch
+	assert.Equal(t, parent.SpanContext().TraceID(), processSC.TraceID())
+	assert.Eventually(t, func() bool { return len(exporter.GetSpans()) == 3 }, time.Second, 10*time.Millisecond)
+	cancel()
+	assert.NoError(t, <-done)
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, s := range exporter.GetSpans() {
+		spans[s.Name] = s
+	}
+	process := spans["blero.process"]
+	assert.Equal(t, processSC.SpanID(), process.SpanContext.SpanID())
+	assert.Equal(t, trace.SpanKindConsumer, process.SpanKind)
+	assert.Contains(t, process.Attributes, attribute.Int64("blero.job.id", int64(jID)))
+	assert.Contains(t, process.Attributes, attribute.String("blero.lease.owner", "worker-1"))
+	assert.Equal(t, codes.Error, process.Status.Code)
+	assert.Equal(t, parent.SpanContext().TraceID(), spans["blero.queue_wait"].SpanContext.TraceID())
+}
+
+func TestWorker_StopWaitsForRunningJobs(t *testing.T) {
+	bl, c := newTestServer(t, blero.DefaultOptions(""))
+
+	jID, err := c.EnqueueJob("TestJob", nil)
+	assert.NoError(t, err)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	w, err := c.NewWorker(blero.ProcessorFunc(func(j *blero.Job) error {
+		close(started)
+		<-release
+		return nil
+	}), DefaultWorkerOptions())
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Run(ctx) }()
+
+	<-started
+	cancel()
+	select {
+	case <-done:
+		t.Fatal("Run returned before the running job was done")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	assert.NoError(t, <-done)
+	_, status, err := bl.GetJob(jID)
+	assert.NoError(t, err)
+	assert.Equal(t, blero.JobComplete, status)
+}
+
+func TestWorker_InvalidOptions(t *testing.T) {
+	c := New("localhost:7070")
+	_, err := c.NewWorker(blero.ProcessorFunc(func(j *blero.Job) error { return nil }), WorkerOptions{})
+	assert.EqualError(t, err, "Concurrency must be at least 1, got 0\n"+
+		"PollInterval must be greater than 0, got 0s\n"+
+		"HeartbeatInterval must be greater than 0, got 0s")
+
+	w, err := c.NewWorker(blero.ProcessorFunc(func(j *blero.Job) error { return nil }), DefaultWorkerOptions())
+	assert.NoError(t, err)
+	assert.NotEmpty(t, w.opts.Owner)
+}
@@ -0,0 +1,673 @@
+// Package server exposes a Blero instance over an HTTP/JSON API
+// so that separate processes can enqueue, lease and inspect jobs of a single Blero DB
+//
+// The API is unauthenticated, anyone reaching it can read and delete jobs and download the decrypted db with GET /v1/backup.
+// Listen on localhost or a Unix socket, or wrap the handler with RequireToken.
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/didil/goblero/pkg/blero"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// list limits
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+// request body limits, job data over the blob threshold is stored in chunks so the JSON bodies can be large
+var (
+	maxBodySize       int64 = 64 << 20
+	maxImportBodySize int64 = 1 << 30
+)
+
+// EnqueueRequest is the body of POST /v1/jobs
+type EnqueueRequest struct {
+	Name    string            `json:"name"`
+	Data    []byte            `json:"data,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Tags    []string          `json:"tags,omitempty"`
+	// Compression is "none", "snappy" or "zstd", the server default applies when empty
+	Compression string `json:"compression,omitempty"`
+	// Key is a unique ID of the job, retried requests with the same key return the ID of the job enqueued by the first request
+	Key string `json:"key,omitempty"`
+}
+
+// EnqueueResponse is returned by POST /v1/jobs
+type EnqueueResponse struct {
+	ID uint64 `json:"id"`
+}
+
+// JobResponse is returned by GET /v1/jobs/{id}
+type JobResponse struct {
+	Job    *blero.Job `json:"job"`
+	Status string     `json:"status"`
+}
+
+// JobsResponse is returned by GET /v1/jobs and POST /v1/leases
+type JobsResponse struct {
+	Jobs []*blero.Job `json:"jobs"`
+}
+
+// LeaseRequest is the body of POST /v1/leases
+type LeaseRequest struct {
+	// Owner identifies the worker leasing the jobs
+	Owner string `json:"owner"`
+	// Max is the max number of leased jobs
+	Max int `json:"max"`
+}
+
+// AttemptRequest is the body of the heartbeat, ack and nack requests
+type AttemptRequest struct {
+	Attempt int `json:"attempt"`
+	// Error is the reason of a nack
+	Error string `json:"error,omitempty"`
+	// Panic is the value a processor panicked with, Stack is its stack trace kept on the job
+	Panic string `json:"panic,omitempty"`
+	Stack string `json:"stack,omitempty"`
+	// Retry overrides the retry policy of a nack like the blero error wrappers, see the Retry constants
+	Retry string `json:"retry,omitempty"`
+	// DelayMs is the delay in milliseconds of a retry_after or snooze nack
+	DelayMs int64 `json:"delay_ms,omitempty"`
+}
+
+// Retry values of a nack
+const (
+	// RetryPermanent fails the job without retrying it, see blero.Permanent
+	RetryPermanent = "permanent"
+	// RetryAfterDelay retries the job after DelayMs, see blero.RetryAfter
+	RetryAfterDelay = "retry_after"
+	// RetrySnooze returns the job to pending for DelayMs without counting the attempt, see blero.Snooze
+	RetrySnooze = "snooze"
+)
+
+// err returns the error of a nack, the panic of a processor and the retry wrappers are rebuilt into blero errors
+func (req AttemptRequest) err() error {
+	var err error
+	if req.Stack != "" {
+		err = &blero.PanicError{Value: req.Panic, Stack: []byte(req.Stack)}
+	} else if req.Error != "" {
+		err = errors.New(req.Error)
+	}
+
+	delay := time.Duration(req.DelayMs) * time.Millisecond
+	switch req.Retry {
+	case RetryPermanent:
+		return blero.Permanent(err)
+	case RetryAfterDelay:
+		return blero.RetryAfter(err, delay)
+	case RetrySnooze:
+		return blero.Snooze(delay)
+	}
+	return err
+}
+
+// validateRetry checks the retry values of a nack
+func (req AttemptRequest) validateRetry() error {
+	switch req.Retry {
+	case "", RetryPermanent, RetryAfterDelay, RetrySnooze:
+	default:
+		return fmt.Errorf("Invalid retry %q, expected %v, %v or %v", req.Retry, RetryPermanent, RetryAfterDelay, RetrySnooze)
+	}
+	if req.DelayMs < 0 {
+		return fmt.Errorf("DelayMs cannot be negative, got %v", req.DelayMs)
+	}
+	if (req.Retry == RetryPermanent || req.Retry == RetryAfterDelay) && req.Error == "" && req.Stack == "" {
+		return fmt.Errorf("Error is required when retry is %v", req.Retry)
+	}
+	return nil
+}
+
+// HeartbeatResponse is returned by POST /v1/jobs/{id}/heartbeat
+type HeartbeatResponse struct {
+	LeaseExpiresAt time.Time `json:"lease_expires_at"`
+}
+
+// PauseResponse is returned by GET /v1/pause
+type PauseResponse struct {
+	// Paused is true when all jobs are paused
+	Paused bool `json:"paused"`
+	// JobNames are the paused job names
+	JobNames []string `json:"job_names"`
+}
+
+// HistoryResponse is returned by GET /v1/jobs/{id}/history
+type HistoryResponse struct {
+	History []blero.Transition `json:"history"`
+}
+
+// ImportResponse is returned by POST /v1/import
+type ImportResponse struct {
+	// Imported is the number of imported jobs
+	Imported int `json:"imported"`
+}
+
+// streaming response trailers, they are only sent when the whole body was written
+const (
+	// BackupVersionTrailer holds the version of a backup, to request the next incremental backup
+	BackupVersionTrailer = "Blero-Backup-Version"
+	// ExportedJobsTrailer holds the number of exported jobs
+	ExportedJobsTrailer = "Blero-Exported-Jobs"
+)
+
+// ErrorResponse is returned with all error statuses
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// handler struct
+type handler struct {
+	bl     *blero.Blero
+	logger *slog.Logger
+}
+
+// NewHandler returns the HTTP handler of the API backed by bl, the API is unauthenticated, see RequireToken
+func NewHandler(bl *blero.Blero, logger *slog.Logger) http.Handler {
+	h := &handler{bl: bl, logger: logger}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", h.health)
+	mux.HandleFunc("POST /v1/jobs", h.enqueue)
+	mux.HandleFunc("GET /v1/jobs", h.listJobs)
+	mux.HandleFunc("GET /v1/jobs/{id}", h.getJob)
+	mux.HandleFunc("GET /v1/jobs/{id}/history", h.jobHistory)
+	mux.HandleFunc("DELETE /v1/jobs/{id}", h.deleteJob)
+	mux.HandleFunc("POST /v1/jobs/{id}/requeue", h.requeueJob)
+	mux.HandleFunc("POST /v1/jobs/{id}/heartbeat", h.heartbeat)
+	mux.HandleFunc("POST /v1/jobs/{id}/ack", h.ack)
+	mux.HandleFunc("POST /v1/jobs/{id}/nack", h.nack)
+	mux.HandleFunc("POST /v1/leases", h.lease)
+	mux.HandleFunc("GET /v1/stats", h.stats)
+	mux.HandleFunc("GET /v1/pause", h.paused)
+	mux.HandleFunc("POST /v1/pause", h.pause)
+	mux.HandleFunc("POST /v1/resume", h.resume)
+	mux.HandleFunc("POST /v1/pause/{name}", h.pauseJob)
+	mux.HandleFunc("POST /v1/resume/{name}", h.resumeJob)
+	mux.HandleFunc("GET /v1/backup", h.backup)
+	mux.HandleFunc("GET /v1/export", h.export)
+	mux.HandleFunc("POST /v1/import", h.importJobs)
+	return mux
+}
+
+// RequireToken wraps the API handler so that requests must send token in an "Authorization: Bearer" header
+// Health checks don't require the token
+func RequireToken(token string, next http.Handler) http.Handler {
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if r.URL.Path != "/healthz" && subtle.ConstantTimeCompare(got, want) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(ErrorResponse{Error: "Invalid or missing bearer token"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Listen listens on a TCP address such as ":7070" or on a Unix socket with the "unix:" prefix such as "unix:/run/blero.sock"
+// A stale Unix socket left by a previous server is removed
+func Listen(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+
+	fi, err := os.Stat(path)
+	if err == nil && fi.Mode()&os.ModeSocket != 0 {
+		err = os.Remove(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+func (h *handler) health(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) enqueue(w http.ResponseWriter, r *http.Request) {
+	var req EnqueueRequest
+	if !h.decode(w, r, &req) {
+		return
+	}
+	if req.Name == "" {
+		h.error(w, http.StatusBadRequest, errors.New("Job name is required"))
+		return
+	}
+
+	opts := blero.EnqueueOptions{Headers: req.Headers, Tags: req.Tags, Key: req.Key}
+	if req.Compression != "" {
+		var err error
+		opts.Compression, err = blero.ParseCompression(req.Compression)
+		if err != nil {
+			h.error(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	// continue the trace of the client
+	ctx := propagation.TraceContext{}.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	id, err := h.bl.EnqueueJobOptions(ctx, req.Name, req.Data, opts)
+	if errors.Is(err, blero.ErrInvalidEnqueueOptions) {
+		h.error(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		h.blError(w, err)
+		return
+	}
+	h.json(w, http.StatusCreated, EnqueueResponse{ID: id})
+}
+
+func (h *handler) listJobs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	opts := blero.ListOptions{Status: blero.JobPending, Limit: defaultListLimit}
+
+	var err error
+	if s := query.Get("status"); s != "" {
+		opts.Status, err = blero.ParseJobStatus(s)
+		if err != nil {
+			h.error(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if s := query.Get("after"); s != "" {
+		opts.After, err = strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			h.error(w, http.StatusBadRequest, fmt.Errorf("Invalid after %q", s))
+			return
+		}
+	}
+	opts.Tags = query["tag"]
+	for _, s := range query["header"] {
+		name, value, ok := strings.Cut(s, ":")
+		if !ok {
+			h.error(w, http.StatusBadRequest, fmt.Errorf("Invalid header %q, expected name:value", s))
+			return
+		}
+		if opts.Headers == nil {
+			opts.Headers = make(map[string]string)
+		}
+		opts.Headers[name] = value
+	}
+	opts.Name = query.Get("name")
+	for _, p := range []struct {
+		name string
+		t    *time.Time
+	}{
+		{"enqueued_since", &opts.EnqueuedSince},
+		{"enqueued_before", &opts.EnqueuedBefore},
+		{"changed_since", &opts.ChangedSince},
+		{"changed_before", &opts.ChangedBefore},
+	} {
+		if s := query.Get(p.name); s != "" {
+			*p.t, err = time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				h.error(w, http.StatusBadRequest, fmt.Errorf("Invalid %v %q, expected an RFC 3339 time", p.name, s))
+				return
+			}
+		}
+	}
+	if s := query.Get("limit"); s != "" {
+		opts.Limit, err = strconv.Atoi(s)
+		if err != nil || opts.Limit < 1 || opts.Limit > maxListLimit {
+			h.error(w, http.StatusBadRequest, fmt.Errorf("Limit must be between 1 and %v, got %q", maxListLimit, s))
+			return
+		}
+	}
+
+	jobs, err := h.bl.ListJobs(opts)
+	if err != nil {
+		h.blError(w, err)
+		return
+	}
+	h.json(w, http.StatusOK, JobsResponse{Jobs: jobs})
+}
+
+func (h *handler) getJob(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.jobID(w, r)
+	if !ok {
+		return
+	}
+
+	j, status, err := h.bl.GetJob(id)
+	if err != nil {
+		h.blError(w, err)
+		return
+	}
+	h.json(w, http.StatusOK, JobResponse{Job: j, Status: status.String()})
+}
+
+func (h *handler) jobHistory(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.jobID(w, r)
+	if !ok {
+		return
+	}
+
+	history, err := h.bl.JobHistory(id)
+	if err != nil {
+		h.blError(w, err)
+		return
+	}
+	h.json(w, http.StatusOK, HistoryResponse{History: history})
+}
+
+func (h *handler) deleteJob(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.jobID(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.bl.DeleteJob(id)
+	if err != nil {
+		h.blError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) requeueJob(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.jobID(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.bl.RequeueJob(id)
+	if err != nil {
+		h.blError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) lease(w http.ResponseWriter, r *http.Request) {
+	var req LeaseRequest
+	if !h.decode(w, r, &req) {
+		return
+	}
+	if req.Owner == "" {
+		h.error(w, http.StatusBadRequest, errors.New("Lease owner is required"))
+		return
+	}
+	if req.Max < 1 || req.Max > maxListLimit {
+		h.error(w, http.StatusBadRequest, fmt.Errorf("Max must be between 1 and %v, got %v", maxListLimit, req.Max))
+		return
+	}
+
+	jobs, err := h.bl.LeaseJobs(req.Owner, req.Max)
+	if err != nil {
+		h.blError(w, err)
+		return
+	}
+	if jobs == nil {
+		jobs = []*blero.Job{}
+	}
+	h.json(w, http.StatusOK, JobsResponse{Jobs: jobs})
+}
+
+func (h *handler) heartbeat(w http.ResponseWriter, r *http.Request) {
+	id, req, ok := h.attempt(w, r)
+	if !ok {
+		return
+	}
+
+	expiresAt, err := h.bl.ExtendLease(id, req.Attempt)
+	if err != nil {
+		h.blError(w, err)
+		return
+	}
+	h.json(w, http.StatusOK, HeartbeatResponse{LeaseExpiresAt: expiresAt})
+}
+
+func (h *handler) ack(w http.ResponseWriter, r *http.Request) {
+	id, req, ok := h.attempt(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.bl.AckJob(id, req.Attempt)
+	if err != nil {
+		h.blError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) nack(w http.ResponseWriter, r *http.Request) {
+	id, req, ok := h.attempt(w, r)
+	if !ok {
+		return
+	}
+
+	err := req.validateRetry()
+	if err != nil {
+		h.error(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = h.bl.NackJobError(id, req.Attempt, req.err())
+	if err != nil {
+		h.blError(w, err)
+		return
+	}
+	if req.Retry == RetrySnooze {
+		h.logger.Debug("Job snoozed", "job_id", id, "attempt", req.Attempt, "delay_ms", req.DelayMs)
+	} else {
+		h.logger.Warn("Job failed", "job_id", id, "attempt", req.Attempt, "error", req.Error)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) stats(w http.ResponseWriter, r *http.Request) {
+	counts, err := h.bl.CountJobs()
+	if err != nil {
+		h.blError(w, err)
+		return
+	}
+
+	stats := make(map[string]int, len(counts))
+	for s, n := range counts {
+		stats[s.String()] = n
+	}
+	h.json(w, http.StatusOK, stats)
+}
+
+func (h *handler) paused(w http.ResponseWriter, r *http.Request) {
+	paused, names := h.bl.Paused()
+	h.json(w, http.StatusOK, PauseResponse{Paused: paused, JobNames: names})
+}
+
+func (h *handler) pause(w http.ResponseWriter, r *http.Request) {
+	h.noContent(w, h.bl.Pause())
+}
+
+func (h *handler) resume(w http.ResponseWriter, r *http.Request) {
+	h.noContent(w, h.bl.Resume())
+}
+
+func (h *handler) pauseJob(w http.ResponseWriter, r *http.Request) {
+	h.noContent(w, h.bl.PauseJob(r.PathValue("name")))
+}
+
+func (h *handler) resumeJob(w http.ResponseWriter, r *http.Request) {
+	h.noContent(w, h.bl.ResumeJob(r.PathValue("name")))
+}
+
+func (h *handler) backup(w http.ResponseWriter, r *http.Request) {
+	var since uint64
+	if s := r.URL.Query().Get("since"); s != "" {
+		var err error
+		since, err = strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			h.error(w, http.StatusBadRequest, fmt.Errorf("Invalid since %q", s))
+			return
+		}
+	}
+
+	w.Header().Set("Trailer", BackupVersionTrailer)
+	sw := &streamWriter{w: w, contentType: "application/octet-stream"}
+	version, err := h.bl.Backup(sw, since)
+	if h.streamError(sw, err) {
+		return
+	}
+	w.Header().Set(BackupVersionTrailer, strconv.FormatUint(version, 10))
+}
+
+func (h *handler) export(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Trailer", ExportedJobsTrailer)
+	sw := &streamWriter{w: w, contentType: "application/x-ndjson"}
+	n, err := h.bl.ExportJobs(sw)
+	if h.streamError(sw, err) {
+		return
+	}
+	w.Header().Set(ExportedJobsTrailer, strconv.Itoa(n))
+}
+
+func (h *handler) importJobs(w http.ResponseWriter, r *http.Request) {
+	n, err := h.bl.ImportJobs(http.MaxBytesReader(w, r.Body, maxImportBodySize))
+	var maxErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxErr):
+		h.error(w, http.StatusRequestEntityTooLarge, fmt.Errorf("Request body is larger than %v bytes, %v jobs imported", maxErr.Limit, n))
+		return
+	case errors.Is(err, blero.ErrInvalidImport):
+		h.error(w, http.StatusBadRequest, fmt.Errorf("%w, %v jobs imported", err, n))
+		return
+	case err != nil:
+		h.logger.Error("Request failed", "error", err)
+		h.error(w, http.StatusInternalServerError, fmt.Errorf("%w, %v jobs imported", err, n))
+		return
+	}
+	h.json(w, http.StatusOK, ImportResponse{Imported: n})
+}
+
+// streamWriter sets the response content type on the first write
+type streamWriter struct {
+	w           http.ResponseWriter
+	contentType string
+	wrote       bool
+}
+
+func (sw *streamWriter) Write(b []byte) (int, error) {
+	if !sw.wrote {
+		sw.w.Header().Set("Content-Type", sw.contentType)
+		sw.wrote = true
+	}
+	return sw.w.Write(b)
+}
+
+// streamError writes the error of a streaming response, or only logs it when the body was partially written
+// The trailers aren't sent in that case so that clients can detect the truncated body
+func (h *handler) streamError(sw *streamWriter, err error) bool {
+	if err == nil {
+		return false
+	}
+	if !sw.wrote {
+		sw.w.Header().Del("Trailer")
+		h.blError(sw.w, err)
+		return true
+	}
+	h.logger.Error("Streaming response failed", "error", err)
+	return true
+}
+
+// noContent writes an empty response or the Blero error
+func (h *handler) noContent(w http.ResponseWriter, err error) {
+	if err != nil {
+		h.blError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// jobID parses the job ID path value
+func (h *handler) jobID(w http.ResponseWriter, r *http.Request) (uint64, bool) {
+	s := r.PathValue("id")
+	id, err := strconv.ParseUint(s, 10, 64)
+	if err == nil {
+		return id, true
+	}
+
+	// keys can't be numbers, look the job up by key
+	id, err = h.bl.JobID(s)
+	if err != nil {
+		h.blError(w, err)
+		return 0, false
+	}
+	return id, true
+}
+
+// attempt parses the job ID and the attempt of heartbeat, ack and nack requests
+func (h *handler) attempt(w http.ResponseWriter, r *http.Request) (uint64, AttemptRequest, bool) {
+	var req AttemptRequest
+	id, ok := h.jobID(w, r)
+	if !ok || !h.decode(w, r, &req) {
+		return 0, req, false
+	}
+	if req.Attempt < 1 {
+		h.error(w, http.StatusBadRequest, fmt.Errorf("Attempt must be at least 1, got %v", req.Attempt))
+		return 0, req, false
+	}
+	return id, req, true
+}
+
+// decode decodes a JSON request body
+func (h *handler) decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(v)
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		h.error(w, http.StatusRequestEntityTooLarge, fmt.Errorf("Request body is larger than %v bytes", maxErr.Limit))
+		return false
+	}
+	if err != nil {
+		h.error(w, http.StatusBadRequest, fmt.Errorf("Invalid request body: %w", err))
+		return false
+	}
+	return true
+}
+
+// blError writes a Blero error with the matching status
+func (h *handler) blError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, blero.ErrKeyNotFound):
+		h.error(w, http.StatusNotFound, errors.New("Job not found"))
+	case errors.Is(err, blero.ErrLeaseLost), errors.Is(err, blero.ErrJobStatus):
+		h.error(w, http.StatusConflict, err)
+	case errors.Is(err, blero.ErrBackupNotSupported):
+		h.error(w, http.StatusNotImplemented, err)
+	default:
+		h.logger.Error("Request failed", "error", err)
+		h.error(w, http.StatusInternalServerError, err)
+	}
+}
+
+// error writes an error response
+func (h *handler) error(w http.ResponseWriter, status int, err error) {
+	h.json(w, status, ErrorResponse{Error: err.Error()})
+}
+
+// json writes a JSON response
+func (h *handler) json(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		h.logger.Error("Cannot write response", "error", err)
+	}
+}
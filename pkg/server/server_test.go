@@ -0,0 +1,536 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/didil/goblero/pkg/blero"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestServer starts a server backed by an in-memory Blero
+func newTestServer(t *testing.T) (*blero.Blero, *httptest.Server) {
+	bl := blero.NewWithBackend(blero.NewMemoryBackend())
+	assert.NoError(t, bl.Start())
+	srv := httptest.NewServer(NewHandler(bl, slog.New(slog.DiscardHandler)))
+	t.Cleanup(func() {
+		srv.Close()
+		bl.Stop()
+	})
+	return bl, srv
+}
+
+// doJSON sends a JSON request, decodes the JSON response in out and returns the status code
+func doJSON(t *testing.T, c *http.Client, method, url string, body any, out any) int {
+	var r *bytes.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		assert.NoError(t, err)
+		r = bytes.NewReader(b)
+	} else {
+		r = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, url, r)
+	assert.NoError(t, err)
+	resp, err := c.Do(req)
+	if !assert.NoError(t, err) {
+		return 0
+	}
+	defer resp.Body.Close()
+
+	if out != nil {
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(out))
+	}
+	return resp.StatusCode
+}
+
+func TestServer_EnqueueGetJob(t *testing.T) {
+	_, srv := newTestServer(t)
+	c := srv.Client()
+
+	var enqueued EnqueueResponse
+	status := doJSON(t, c, "POST", srv.URL+"/v1/jobs", EnqueueRequest{Name: "TestJob", Data: []byte("data")}, &enqueued)
+	assert.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, uint64(1), enqueued.ID)
+
+	var job JobResponse
+	status = doJSON(t, c, "GET", srv.URL+"/v1/jobs/1", nil, &job)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "pending", job.Status)
+	assert.Equal(t, "TestJob", job.Job.Name)
+	assert.Equal(t, []byte("data"), job.Job.Data)
+
+	var errResp ErrorResponse
+	status = doJSON(t, c, "GET", srv.URL+"/v1/jobs/2", nil, &errResp)
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Equal(t, "Job not found", errResp.Error)
+}
+
+func TestServer_HeadersTags(t *testing.T) {
+	bl, srv := newTestServer(t)
+	c := srv.Client()
+
+	req := EnqueueRequest{Name: "TestJob", Headers: map[string]string{"tenant": "acme"}, Tags: []string{"billing", "eu"}, Compression: "zstd"}
+	var enqueued EnqueueResponse
+	status := doJSON(t, c, "POST", srv.URL+"/v1/jobs", req, &enqueued)
+	assert.Equal(t, http.StatusCreated, status)
+	_, err := bl.EnqueueJob("TestJob", nil)
+	assert.NoError(t, err)
+
+	var jobs JobsResponse
+	status = doJSON(t, c, "GET", srv.URL+"/v1/jobs?tag=billing&tag=eu&header=tenant:acme", nil, &jobs)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, jobs.Jobs, 1)
+	assert.Equal(t, enqueued.ID, jobs.Jobs[0].ID)
+	assert.Equal(t, req.Headers, jobs.Jobs[0].Headers)
+	assert.Equal(t, req.Tags, jobs.Jobs[0].Tags)
+	enqueuedAt := jobs.Jobs[0].EnqueuedAt
+
+	status = doJSON(t, c, "GET", srv.URL+"/v1/jobs?header=tenant:other", nil, &jobs)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Empty(t, jobs.Jobs)
+
+	// by name and enqueue time
+	_, err = bl.EnqueueJob("OtherJob", nil)
+	assert.NoError(t, err)
+	since := url.QueryEscape(enqueuedAt.Format(time.RFC3339Nano))
+	status = doJSON(t, c, "GET", srv.URL+"/v1/jobs?name=TestJob&enqueued_since="+since, nil, &jobs)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, jobs.Jobs, 2)
+}
+
+func TestServer_ListJobs(t *testing.T) {
+	bl, srv := newTestServer(t)
+	c := srv.Client()
+
+	for i := 0; i < 5; i++ {
+		_, err := bl.EnqueueJob("TestJob", nil)
+		assert.NoError(t, err)
+	}
+	_, err := bl.LeaseJobs("worker-1", 1)
+	assert.NoError(t, err)
+
+	var list JobsResponse
+	status := doJSON(t, c, "GET", srv.URL+"/v1/jobs?after=2&limit=2", nil, &list)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, list.Jobs, 2)
+	assert.Equal(t, uint64(3), list.Jobs[0].ID)
+	assert.Equal(t, uint64(4), list.Jobs[1].ID)
+
+	status = doJSON(t, c, "GET", srv.URL+"/v1/jobs?status=inprogress", nil, &list)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, list.Jobs, 1)
+	assert.Equal(t, "worker-1", list.Jobs[0].LeaseOwner)
+
+	var stats map[string]int
+	status = doJSON(t, c, "GET", srv.URL+"/v1/stats", nil, &stats)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, map[string]int{"pending": 4, "inprogress": 1, "complete": 0, "failed": 0}, stats)
+}
+
+func TestServer_LeaseAckNack(t *testing.T) {
+	_, srv := newTestServer(t)
+	c := srv.Client()
+
+	for i := 0; i < 3; i++ {
+		status := doJSON(t, c, "POST", srv.URL+"/v1/jobs", EnqueueRequest{Name: "TestJob"}, nil)
+		assert.Equal(t, http.StatusCreated, status)
+	}
+
+	var leased JobsResponse
+	status := doJSON(t, c, "POST", srv.URL+"/v1/leases", LeaseRequest{Owner: "worker-1", Max: 2}, &leased)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, leased.Jobs, 2)
+	j1, j2 := leased.Jobs[0], leased.Jobs[1]
+	assert.Equal(t, 1, j1.Attempts)
+
+	var hb HeartbeatResponse
+	status = doJSON(t, c, "POST", srv.URL+"/v1/jobs/1/heartbeat", AttemptRequest{Attempt: j1.Attempts}, &hb)
+	assert.Equal(t, http.StatusOK, status)
+	assert.False(t, hb.LeaseExpiresAt.IsZero())
+
+	status = doJSON(t, c, "POST", srv.URL+"/v1/jobs/1/ack", AttemptRequest{Attempt: j1.Attempts}, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	status = doJSON(t, c, "POST", srv.URL+"/v1/jobs/2/nack", AttemptRequest{Attempt: j2.Attempts, Error: "boom"}, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+
+	// the lease was released
+	var errResp ErrorResponse
+	status = doJSON(t, c, "POST", srv.URL+"/v1/jobs/1/ack", AttemptRequest{Attempt: j1.Attempts}, &errResp)
+	assert.Equal(t, http.StatusConflict, status)
+	assert.Equal(t, "Job lease lost", errResp.Error)
+
+	var job JobResponse
+	doJSON(t, c, "GET", srv.URL+"/v1/jobs/2", nil, &job)
+	assert.Equal(t, "failed", job.Status)
+
+	// the nack reason is recorded in the history
+	var history HistoryResponse
+	status = doJSON(t, c, "GET", srv.URL+"/v1/jobs/2/history", nil, &history)
+	assert.Equal(t, http.StatusOK, status)
+	if assert.Len(t, history.History, 3) {
+		assert.Equal(t, "failed", history.History[2].To)
+		assert.Equal(t, "worker-1", history.History[2].LeaseOwner)
+		assert.Equal(t, "boom", history.History[2].Error)
+	}
+	status = doJSON(t, c, "GET", srv.URL+"/v1/jobs/42/history", nil, &errResp)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	// no more than the pending jobs
+	status = doJSON(t, c, "POST", srv.URL+"/v1/leases", LeaseRequest{Owner: "worker-1", Max: 10}, &leased)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, leased.Jobs, 1)
+	status = doJSON(t, c, "POST", srv.URL+"/v1/leases", LeaseRequest{Owner: "worker-1", Max: 10}, &leased)
+	assert.Equal(t, http.StatusOK, status)
+	assert.NotNil(t, leased.Jobs)
+	assert.Len(t, leased.Jobs, 0)
+}
+
+func TestServer_Admin(t *testing.T) {
+	bl, srv := newTestServer(t)
+	c := srv.Client()
+
+	for i := 0; i < 2; i++ {
+		_, err := bl.EnqueueJob("TestJob", nil)
+		assert.NoError(t, err)
+	}
+	jobs, err := bl.LeaseJobs("worker-1", 1)
+	assert.NoError(t, err)
+
+	var errResp ErrorResponse
+	status := doJSON(t, c, "DELETE", srv.URL+"/v1/jobs/1", nil, &errResp)
+	assert.Equal(t, http.StatusConflict, status)
+	assert.Equal(t, "Cannot delete job 1 with status inprogress: Invalid job status", errResp.Error)
+
+	assert.NoError(t, bl.NackJob(1, jobs[0].Attempts))
+	status = doJSON(t, c, "POST", srv.URL+"/v1/jobs/1/requeue", nil, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	_, s, err := bl.GetJob(1)
+	assert.NoError(t, err)
+	assert.Equal(t, blero.JobPending, s)
+
+	status = doJSON(t, c, "DELETE", srv.URL+"/v1/jobs/2", nil, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	status = doJSON(t, c, "DELETE", srv.URL+"/v1/jobs/2", nil, nil)
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestServer_JobKeys(t *testing.T) {
+	_, srv := newTestServer(t)
+	c := srv.Client()
+
+	// a retried request doesn't enqueue another job
+	var first, retried EnqueueResponse
+	status := doJSON(t, c, "POST", srv.URL+"/v1/jobs", EnqueueRequest{Name: "TestJob", Key: "order 42"}, &first)
+	assert.Equal(t, http.StatusCreated, status)
+	status = doJSON(t, c, "POST", srv.URL+"/v1/jobs", EnqueueRequest{Name: "TestJob", Key: "order 42"}, &retried)
+	assert.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, first.ID, retried.ID)
+
+	// jobs are looked up by either ID
+	var job JobResponse
+	status = doJSON(t, c, "GET", srv.URL+"/v1/jobs/order%2042", nil, &job)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, first.ID, job.Job.ID)
+	assert.Equal(t, "order 42", job.Job.Key)
+	var history HistoryResponse
+	status = doJSON(t, c, "GET", srv.URL+"/v1/jobs/order%2042/history", nil, &history)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, history.History, 1)
+
+	var errResp ErrorResponse
+	status = doJSON(t, c, "GET", srv.URL+"/v1/jobs/unknown", nil, &errResp)
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Equal(t, "Job not found", errResp.Error)
+}
+
+func TestServer_BadRequests(t *testing.T) {
+	_, srv := newTestServer(t)
+	c := srv.Client()
+
+	tests := []struct {
+		method, path string
+		body         any
+		err          string
+	}{
+		{"POST", "/v1/jobs", EnqueueRequest{}, "Job name is required"},
+		{"POST", "/v1/jobs", "not an object", "Invalid request body: json: cannot unmarshal string into Go value of type server.EnqueueRequest"},
+		{"GET", "/v1/jobs?status=done", nil, `Unknown job status "done"`},
+		{"GET", "/v1/jobs?after=-1", nil, `Invalid after "-1"`},
+		{"GET", "/v1/jobs?limit=0", nil, `Limit must be between 1 and 1000, got "0"`},
+		{"GET", "/v1/jobs?header=tenant", nil, `Invalid header "tenant", expected name:value`},
+		{"GET", "/v1/jobs?changed_before=yesterday", nil, `Invalid changed_before "yesterday", expected an RFC 3339 time`},
+		{"POST", "/v1/jobs", EnqueueRequest{Name: "TestJob", Compression: "lz4"}, `Unknown compression "lz4"`},
+		{"POST", "/v1/jobs", EnqueueRequest{Name: "TestJob", Tags: []string{"a", "a"}}, `Invalid enqueue options: Duplicate tag "a"`},
+		{"POST", "/v1/jobs", EnqueueRequest{Name: "TestJob", Key: "42"}, `Invalid enqueue options: Key "42" cannot be a number, numbers are job IDs`},
+		{"POST", "/v1/leases", LeaseRequest{Max: 1}, "Lease owner is required"},
+		{"POST", "/v1/leases", LeaseRequest{Owner: "worker-1"}, "Max must be between 1 and 1000, got 0"},
+		{"POST", "/v1/jobs/1/ack", AttemptRequest{}, "Attempt must be at least 1, got 0"},
+		{"POST", "/v1/jobs/1/nack", AttemptRequest{Attempt: 1, Retry: "later"}, `Invalid retry "later", expected permanent, retry_after or snooze`},
+		{"POST", "/v1/jobs/1/nack", AttemptRequest{Attempt: 1, Retry: RetrySnooze, DelayMs: -1}, "DelayMs cannot be negative, got -1"},
+		{"POST", "/v1/jobs/1/nack", AttemptRequest{Attempt: 1, Retry: RetryPermanent}, "Error is required when retry is permanent"},
+	}
+	for _, tt := range tests {
+		var errResp ErrorResponse
+		status := doJSON(t, c, tt.method, srv.URL+tt.path, tt.body, &errResp)
+		assert.Equal(t, http.StatusBadRequest, status, tt.path)
+		assert.Equal(t, tt.err, errResp.Error, tt.path)
+	}
+}
+
+func TestServer_UnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blero.sock")
+
+	// a stale socket is removed
+	stale, err := net.Listen("unix", path)
+	assert.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	l, err := Listen("unix:" + path)
+	assert.NoError(t, err)
+
+	bl := blero.NewWithBackend(blero.NewMemoryBackend())
+	assert.NoError(t, bl.Start())
+	defer bl.Stop()
+	srv := &http.Server{Handler: NewHandler(bl, slog.New(slog.DiscardHandler))}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	c := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+
+	status := doJSON(t, c, "GET", "http://blero/healthz", nil, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+
+	var enqueued EnqueueResponse
+	status = doJSON(t, c, "POST", "http://blero/v1/jobs", EnqueueRequest{Name: "TestJob"}, &enqueued)
+	assert.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, uint64(1), enqueued.ID)
+}
+
+func TestServer_RequireToken(t *testing.T) {
+	bl := blero.NewWithBackend(blero.NewMemoryBackend())
+	assert.NoError(t, bl.Start())
+	defer bl.Stop()
+	srv := httptest.NewServer(RequireToken("secret", NewHandler(bl, slog.New(slog.DiscardHandler))))
+	defer srv.Close()
+	c := srv.Client()
+
+	status := doJSON(t, c, "GET", srv.URL+"/healthz", nil, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+
+	for _, auth := range []string{"", "Bearer wrong", "secret"} {
+		req, err := http.NewRequest("GET", srv.URL+"/v1/backup", nil)
+		assert.NoError(t, err)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := c.Do(req)
+		assert.NoError(t, err)
+		var errResp ErrorResponse
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&errResp))
+		resp.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, auth)
+		assert.Equal(t, "Bearer", resp.Header.Get("WWW-Authenticate"))
+		assert.Equal(t, "Invalid or missing bearer token", errResp.Error)
+	}
+
+	req, err := http.NewRequest("GET", srv.URL+"/v1/stats", nil)
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := c.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestServer_PauseResume(t *testing.T) {
+	bl, srv := newTestServer(t)
+	c := srv.Client()
+
+	status := doJSON(t, c, "POST", srv.URL+"/v1/pause", nil, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	status = doJSON(t, c, "POST", srv.URL+"/v1/pause/Migrate", nil, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+
+	var paused PauseResponse
+	status = doJSON(t, c, "GET", srv.URL+"/v1/pause", nil, &paused)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, PauseResponse{Paused: true, JobNames: []string{"Migrate"}}, paused)
+
+	// enqueues are accepted but paused jobs are not leased
+	status = doJSON(t, c, "POST", srv.URL+"/v1/jobs", EnqueueRequest{Name: "Resize"}, nil)
+	assert.Equal(t, http.StatusCreated, status)
+	jobs, err := bl.LeaseJobs("worker-1", 1)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 0)
+
+	status = doJSON(t, c, "POST", srv.URL+"/v1/resume", nil, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	status = doJSON(t, c, "POST", srv.URL+"/v1/resume/Migrate", nil, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	allPaused, names := bl.Paused()
+	assert.False(t, allPaused)
+	assert.Len(t, names, 0)
+}
+
+func TestServer_ExportImport(t *testing.T) {
+	bl, srv := newTestServer(t)
+	c := srv.Client()
+
+	_, err := bl.EnqueueJob("TestJob", []byte("data"))
+	assert.NoError(t, err)
+	_, err = bl.EnqueueJob("TestJob", nil)
+	assert.NoError(t, err)
+
+	resp, err := c.Get(srv.URL + "/v1/export")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+	var export bytes.Buffer
+	_, err = export.ReadFrom(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "2", resp.Trailer.Get(ExportedJobsTrailer))
+
+	var imported ImportResponse
+	req, err := http.NewRequest("POST", srv.URL+"/v1/import", &export)
+	assert.NoError(t, err)
+	resp, err = c.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&imported))
+	assert.Equal(t, 2, imported.Imported)
+
+	j, _, err := bl.GetJob(3)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("data"), j.Data)
+
+	var errResp ErrorResponse
+	req, err = http.NewRequest("POST", srv.URL+"/v1/import", bytes.NewBufferString(`{"status":"x"}`))
+	assert.NoError(t, err)
+	resp, err = c.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&errResp))
+	assert.Equal(t, `Job 1: Unknown job status "x", 0 jobs imported`, errResp.Error)
+}
+
+// failingBackend fails the read-write transactions while fail is set
+type failingBackend struct {
+	blero.Backend
+	fail atomic.Bool
+}
+
+func (b *failingBackend) Update(fn func(tx blero.Tx) error) error {
+	if b.fail.Load() {
+		return errors.New("disk full")
+	}
+	return b.Backend.Update(fn)
+}
+
+func TestServer_ImportStorageError(t *testing.T) {
+	backend := &failingBackend{Backend: blero.NewMemoryBackend()}
+	bl := blero.NewWithBackend(backend)
+	assert.NoError(t, bl.Start())
+	defer bl.Stop()
+	backend.fail.Store(true)
+	srv := httptest.NewServer(NewHandler(bl, slog.New(slog.DiscardHandler)))
+	defer srv.Close()
+
+	resp, err := srv.Client().Post(srv.URL+"/v1/import", "application/x-ndjson", strings.NewReader(`{"status":"pending","job":{"Name":"TestJob"}}`))
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	var errResp ErrorResponse
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&errResp))
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, "Job 1: disk full, 0 jobs imported", errResp.Error)
+}
+
+func TestServer_BodyLimits(t *testing.T) {
+	prevBodySize, prevImportBodySize := maxBodySize, maxImportBodySize
+	maxBodySize, maxImportBodySize = 100, 100
+	t.Cleanup(func() { maxBodySize, maxImportBodySize = prevBodySize, prevImportBodySize })
+
+	bl, srv := newTestServer(t)
+	c := srv.Client()
+
+	var errResp ErrorResponse
+	status := doJSON(t, c, "POST", srv.URL+"/v1/jobs", EnqueueRequest{Name: "TestJob", Data: make([]byte, 100)}, &errResp)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, status)
+	assert.Equal(t, "Request body is larger than 100 bytes", errResp.Error)
+
+	line := `{"status":"pending","job":{"Name":"TestJob"}}` + "\n"
+	resp, err := c.Post(srv.URL+"/v1/import", "application/x-ndjson", strings.NewReader(line+line+line))
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&errResp))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	assert.Equal(t, "Request body is larger than 100 bytes, 2 jobs imported", errResp.Error)
+
+	counts, err := bl.CountJobs()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, counts[blero.JobPending])
+}
+
+func TestServer_Backup(t *testing.T) {
+	_, srv := newTestServer(t)
+	c := srv.Client()
+
+	// the in-memory backend can't be backed up
+	var errResp ErrorResponse
+	status := doJSON(t, c, "GET", srv.URL+"/v1/backup", nil, &errResp)
+	assert.Equal(t, http.StatusNotImplemented, status)
+	assert.Equal(t, blero.ErrBackupNotSupported.Error(), errResp.Error)
+
+	status = doJSON(t, c, "GET", srv.URL+"/v1/backup?since=x", nil, &errResp)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, `Invalid since "x"`, errResp.Error)
+
+	dbPath := t.TempDir()
+	opts := blero.DefaultOptions(dbPath)
+	opts.Logger = slog.New(slog.DiscardHandler)
+	bl, err := blero.NewWithOptions(opts)
+	assert.NoError(t, err)
+	assert.NoError(t, bl.Start())
+	defer bl.Stop()
+	badgerSrv := httptest.NewServer(NewHandler(bl, opts.Logger))
+	defer badgerSrv.Close()
+
+	_, err = bl.EnqueueJob("TestJob", nil)
+	assert.NoError(t, err)
+
+	resp, err := badgerSrv.Client().Get(badgerSrv.URL + "/v1/backup")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/octet-stream", resp.Header.Get("Content-Type"))
+	var backup bytes.Buffer
+	_, err = backup.ReadFrom(resp.Body)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, backup.Bytes())
+	assert.NotEmpty(t, resp.Trailer.Get(BackupVersionTrailer))
+
+	restoreOpts := blero.DefaultOptions(filepath.Join(t.TempDir(), "restored"))
+	restoreOpts.Logger = opts.Logger
+	assert.NoError(t, blero.RestoreBackup(restoreOpts, &backup))
+}